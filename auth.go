@@ -38,6 +38,9 @@ func PasswordHash(username, password string) string {
 // does not match the "shm_session" cookie value then it redirects to
 // redirectPath. If redirectURL is empty then "/user_admin/login" is used
 // instead which is the default login URL for Shimmie.
+//
+// The request context is passed to the UserGetter so that canceled requests
+// also cancel the user query.
 func (shim *Shimmie) Auth(h http.Handler, redirectURL string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		const defaultLoginURL = "/user_admin/login"
@@ -56,7 +59,7 @@ func (shim *Shimmie) Auth(h http.Handler, redirectURL string) http.Handler {
 			return
 		}
 		username := usernameCookie.Value
-		user, err := shim.User.GetUserByName(username)
+		user, err := shim.User.GetUserByName(r.Context(), username)
 		if err != nil {
 			if err == sql.ErrNoRows {
 				log.Printf("shimmie: user %q does not exist", username)
@@ -102,10 +105,14 @@ func GetOriginalIP(r *http.Request) string {
 	x := r.Header.Get("X-Forwarded-For")
 	if x != "" && strings.Contains(r.RemoteAddr, "127.0.0.1") {
 		// format is comma separated
-		return strings.Split(x, ",")[0]
+		return strings.TrimSpace(strings.Split(x, ",")[0])
+	}
+	// it also contains the port, and IPv6 addresses are in brackets
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
 	}
-	// it also contains the port
-	return strings.Split(r.RemoteAddr, ":")[0]
+	return host
 }
 
 // CookieValue recreates the Shimmie session cookie value based on the user
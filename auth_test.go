@@ -1,6 +1,9 @@
 package shimmie_test
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	. "github.com/kusubooru/shimmie"
@@ -25,3 +28,32 @@ func TestCookieValue(t *testing.T) {
 		}
 	}
 }
+
+type ctxKey struct{}
+
+type userGetterFunc func(ctx context.Context, username string) (*User, error)
+
+func (fn userGetterFunc) GetUserByName(ctx context.Context, username string) (*User, error) {
+	return fn(ctx, username)
+}
+
+func TestAuthPassesRequestContext(t *testing.T) {
+	var got interface{}
+	shim := &Shimmie{
+		User: userGetterFunc(func(ctx context.Context, username string) (*User, error) {
+			got = ctx.Value(ctxKey{})
+			return &User{Name: username, Pass: PasswordHash(username, "pass")}, nil
+		}),
+	}
+	h := shim.Auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), "")
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req = req.WithContext(context.WithValue(req.Context(), ctxKey{}, "request"))
+	req.AddCookie(&http.Cookie{Name: "shm_user", Value: "bob"})
+	req.AddCookie(&http.Cookie{Name: "shm_session", Value: "session"})
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if want := "request"; got != want {
+		t.Errorf("Auth passed context with value %v to UserGetter, want %q", got, want)
+	}
+}
@@ -0,0 +1,101 @@
+package shimmie
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// ImageProgress reports the progress of a batch operation on images.
+type ImageProgress struct {
+	Done   int
+	Failed int
+	// Cursor resumes the operation after the images that are done. It is
+	// empty once all the images are done.
+	Cursor string
+}
+
+// BatchOptions configure the batch operations on images, like
+// RegenerateThumbs.
+type BatchOptions struct {
+	// Filter selects the images of the operation.
+	Filter ImageFilter
+	// Cursor resumes an operation from the Cursor of its last progress.
+	Cursor string
+	// Workers is the number of images processed at once. It defaults to the
+	// number of CPUs.
+	Workers int
+	// PageSize is the number of images that are listed at a time. It
+	// defaults to 100.
+	PageSize int
+	// Progress, if set, is called after each page of images.
+	Progress func(ImageProgress)
+	// OnError, if set, is called for each image that fails. It may be called
+	// by several workers at once.
+	OnError func(img Image, err error)
+}
+
+// forEachImage calls fn for the images of store, newest first, with a pool
+// of workers. Images that fail are counted and skipped. If ctx is canceled,
+// it returns the progress of the pages that were done.
+func forEachImage(ctx context.Context, store ImageStore, opts BatchOptions, fn func(Image) error) (ImageProgress, error) {
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.NumCPU()
+	}
+	if opts.PageSize <= 0 {
+		opts.PageSize = 100
+	}
+	progress := ImageProgress{Cursor: opts.Cursor}
+
+	jobs := make(chan Image)
+	results := make(chan error)
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for img := range jobs {
+				err := fn(img)
+				if err != nil && opts.OnError != nil {
+					opts.OnError(img, err)
+				}
+				results <- err
+			}
+		}()
+	}
+	defer func() {
+		close(jobs)
+		wg.Wait()
+	}()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return progress, err
+		}
+		images, next, err := store.ListImages(ctx, opts.Filter, opts.PageSize, progress.Cursor)
+		if err != nil {
+			return progress, err
+		}
+		// A page is sent and collected in full so that the cursor never
+		// skips images that are not done.
+		go func() {
+			for _, img := range images {
+				jobs <- img
+			}
+		}()
+		for range images {
+			if err := <-results; err != nil {
+				progress.Failed++
+			} else {
+				progress.Done++
+			}
+		}
+		progress.Cursor = next
+		if opts.Progress != nil {
+			opts.Progress(progress)
+		}
+		if next == "" {
+			return progress, nil
+		}
+	}
+}
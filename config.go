@@ -0,0 +1,290 @@
+package shimmie
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConfigValues holds config values by name and converts them the way Shimmie
+// does. Each getter returns def if the value is missing or malformed.
+type ConfigValues map[string]string
+
+// String returns the value of name or def if it is missing.
+func (v ConfigValues) String(name, def string) string {
+	s, ok := v[name]
+	if !ok {
+		return def
+	}
+	return s
+}
+
+// Int returns the value of name as an integer.
+func (v ConfigValues) Int(name string, def int) int {
+	n, err := strconv.Atoi(strings.TrimSpace(v[name]))
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+// Bool returns the value of name as a boolean. Shimmie stores booleans as "Y"
+// or "N" but also accepts values like "yes", "true", "on" and "1".
+func (v ConfigValues) Bool(name string, def bool) bool {
+	b, ok := ParseConfigBool(v[name])
+	if !ok {
+		return def
+	}
+	return b
+}
+
+// Duration returns the value of name as a duration. Shimmie stores durations
+// as a number of seconds.
+func (v ConfigValues) Duration(name string, def time.Duration) time.Duration {
+	n, err := strconv.ParseInt(strings.TrimSpace(v[name]), 10, 64)
+	if err != nil {
+		return def
+	}
+	return time.Duration(n) * time.Second
+}
+
+// List returns the value of name split on commas, the way Shimmie stores
+// arrays. Empty elements are left out.
+func (v ConfigValues) List(name string, def []string) []string {
+	s, ok := v[name]
+	if !ok {
+		return def
+	}
+	var list []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			list = append(list, e)
+		}
+	}
+	return list
+}
+
+// ParseConfigBool parses a boolean config value. It reports false if s is
+// not a boolean.
+func ParseConfigBool(s string) (value, ok bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "y", "yes", "t", "true", "on", "1":
+		return true, true
+	case "n", "no", "f", "false", "off", "0":
+		return false, true
+	}
+	return false, false
+}
+
+// FormatConfigBool formats a boolean config value as Shimmie does.
+func FormatConfigBool(b bool) string {
+	if b {
+		return "Y"
+	}
+	return "N"
+}
+
+// FormatConfigDuration formats a duration config value as a number of
+// seconds.
+func FormatConfigDuration(d time.Duration) string {
+	return strconv.FormatInt(int64(d/time.Second), 10)
+}
+
+// FormatConfigList formats a list config value as a comma separated string.
+func FormatConfigList(list []string) string {
+	return strings.Join(list, ",")
+}
+
+// ConfigChange describes a config value that was set, changed or removed.
+type ConfigChange struct {
+	Name    string
+	Old     string
+	New     string
+	Removed bool
+}
+
+// Config caches the config values of a ConfigStore and notifies watchers
+// when they change. The values are loaded again once they are older than the
+// TTL, either when they are requested or by Poll. Changes made through Set
+// are seen at once while changes made by Shimmie or other processes are seen
+// when the values are loaded again.
+type Config struct {
+	store ConfigStore
+	ttl   time.Duration
+
+	mu       sync.Mutex
+	values   ConfigValues
+	loaded   time.Time
+	watchers map[*configWatcher]struct{}
+}
+
+type configWatcher struct {
+	names map[string]bool
+	ch    chan ConfigChange
+}
+
+// NewConfig returns a Config that caches the values of store for ttl. A zero
+// ttl loads the values on every request.
+func NewConfig(store ConfigStore, ttl time.Duration) *Config {
+	return &Config{
+		store:    store,
+		ttl:      ttl,
+		watchers: make(map[*configWatcher]struct{}),
+	}
+}
+
+// Values returns all the config values, loading them if the cache has
+// expired. The returned values must not be modified.
+func (c *Config) Values(ctx context.Context) (ConfigValues, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.values != nil && c.ttl > 0 && time.Since(c.loaded) < c.ttl {
+		return c.values, nil
+	}
+	if err := c.load(ctx); err != nil {
+		return nil, err
+	}
+	return c.values, nil
+}
+
+// Refresh loads the config values regardless of their age and notifies the
+// watchers of the values that have changed.
+func (c *Config) Refresh(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.load(ctx)
+}
+
+func (c *Config) load(ctx context.Context) error {
+	m, err := c.store.GetConfig(ctx)
+	if err != nil {
+		return err
+	}
+	values := ConfigValues(m)
+	if c.values != nil {
+		for name, v := range values {
+			if old, ok := c.values[name]; !ok || old != v {
+				c.notify(ConfigChange{Name: name, Old: old, New: v})
+			}
+		}
+		for name, old := range c.values {
+			if _, ok := values[name]; !ok {
+				c.notify(ConfigChange{Name: name, Old: old, Removed: true})
+			}
+		}
+	}
+	c.values = values
+	c.loaded = time.Now()
+	return nil
+}
+
+// Set stores a config value and updates the cache.
+func (c *Config) Set(ctx context.Context, name, value string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.store.SetConfig(ctx, name, value); err != nil {
+		return err
+	}
+	if c.values == nil {
+		return nil
+	}
+	old, ok := c.values[name]
+	if ok && old == value {
+		return nil
+	}
+	// The previous values may still be in use so they are copied.
+	values := make(ConfigValues, len(c.values)+1)
+	for k, v := range c.values {
+		values[k] = v
+	}
+	values[name] = value
+	c.values = values
+	c.notify(ConfigChange{Name: name, Old: old, New: value})
+	return nil
+}
+
+// SetInt stores an integer config value.
+func (c *Config) SetInt(ctx context.Context, name string, n int) error {
+	return c.Set(ctx, name, strconv.Itoa(n))
+}
+
+// SetBool stores a boolean config value.
+func (c *Config) SetBool(ctx context.Context, name string, b bool) error {
+	return c.Set(ctx, name, FormatConfigBool(b))
+}
+
+// SetDuration stores a duration config value.
+func (c *Config) SetDuration(ctx context.Context, name string, d time.Duration) error {
+	return c.Set(ctx, name, FormatConfigDuration(d))
+}
+
+// SetList stores a list config value.
+func (c *Config) SetList(ctx context.Context, name string, list []string) error {
+	return c.Set(ctx, name, FormatConfigList(list))
+}
+
+// Watch returns a channel that receives the changes of the named config
+// values, or of all values if no names are given, until ctx is done. Changes
+// are dropped if the channel is not drained fast enough.
+func (c *Config) Watch(ctx context.Context, names ...string) <-chan ConfigChange {
+	w := &configWatcher{ch: make(chan ConfigChange, 16)}
+	if len(names) != 0 {
+		w.names = make(map[string]bool, len(names))
+		for _, n := range names {
+			w.names[n] = true
+		}
+	}
+	c.mu.Lock()
+	c.watchers[w] = struct{}{}
+	c.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		c.mu.Lock()
+		delete(c.watchers, w)
+		close(w.ch)
+		c.mu.Unlock()
+	}()
+	return w.ch
+}
+
+func (c *Config) notify(change ConfigChange) {
+	for w := range c.watchers {
+		if w.names != nil && !w.names[change.Name] {
+			continue
+		}
+		select {
+		case w.ch <- change:
+		default:
+		}
+	}
+}
+
+// Poll refreshes the config values every TTL, or every minute if the TTL is
+// zero, until ctx is done so that watchers see the changes made by other
+// processes. A failed refresh is passed to onError, if it is not nil, and
+// polling goes on. It returns the error of ctx.
+func (c *Config) Poll(ctx context.Context, onError func(error)) error {
+	interval := c.ttl
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	refresh := func() {
+		if err := c.Refresh(ctx); err != nil && ctx.Err() == nil && onError != nil {
+			onError(err)
+		}
+	}
+	refresh()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			refresh()
+		}
+	}
+}
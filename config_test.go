@@ -0,0 +1,196 @@
+package shimmie_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/kusubooru/shimmie"
+	"github.com/kusubooru/shimmie/shimmietest"
+)
+
+func TestConfigValues(t *testing.T) {
+	v := ConfigValues{
+		"thumb_width":  "192",
+		"bad_int":      "12px",
+		"anon_comment": "Y",
+		"upload_tos":   "off",
+		"bad_bool":     "maybe",
+		"login_memory": "3600",
+		"ext_list":     "jpg, png,,gif",
+		"empty_list":   "",
+		"site_title":   "",
+		"bad_duration": "1h",
+	}
+	if got, want := v.String("site_title", "def"), ""; got != want {
+		t.Errorf("String(site_title) = %q, want %q", got, want)
+	}
+	if got, want := v.String("missing", "def"), "def"; got != want {
+		t.Errorf("String(missing) = %q, want %q", got, want)
+	}
+	if got, want := v.Int("thumb_width", 0), 192; got != want {
+		t.Errorf("Int(thumb_width) = %d, want %d", got, want)
+	}
+	if got, want := v.Int("bad_int", 7), 7; got != want {
+		t.Errorf("Int(bad_int) = %d, want %d", got, want)
+	}
+	if got, want := v.Bool("anon_comment", false), true; got != want {
+		t.Errorf("Bool(anon_comment) = %v, want %v", got, want)
+	}
+	if got, want := v.Bool("upload_tos", true), false; got != want {
+		t.Errorf("Bool(upload_tos) = %v, want %v", got, want)
+	}
+	if got, want := v.Bool("bad_bool", true), true; got != want {
+		t.Errorf("Bool(bad_bool) = %v, want %v", got, want)
+	}
+	if got, want := v.Duration("login_memory", 0), time.Hour; got != want {
+		t.Errorf("Duration(login_memory) = %v, want %v", got, want)
+	}
+	if got, want := v.Duration("bad_duration", time.Minute), time.Minute; got != want {
+		t.Errorf("Duration(bad_duration) = %v, want %v", got, want)
+	}
+	if got, want := v.List("ext_list", nil), []string{"jpg", "png", "gif"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("List(ext_list) = %q, want %q", got, want)
+	}
+	if got := v.List("empty_list", []string{"def"}); len(got) != 0 {
+		t.Errorf("List(empty_list) = %q, want empty", got)
+	}
+	if got, want := v.List("missing", []string{"def"}), []string{"def"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("List(missing) = %q, want %q", got, want)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	ctx := context.Background()
+	store := shimmietest.New()
+	if err := store.SetConfig(ctx, "thumb_width", "192"); err != nil {
+		t.Fatal(err)
+	}
+	c := NewConfig(store, time.Hour)
+
+	v, err := c.Values(ctx)
+	if err != nil {
+		t.Fatalf("Values() failed: %v", err)
+	}
+	if got, want := v.Int("thumb_width", 0), 192; got != want {
+		t.Errorf("Int(thumb_width) = %d, want %d", got, want)
+	}
+
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	changes := c.Watch(wctx, "thumb_width", "thumb_height")
+
+	// Changes made elsewhere are only seen once the values are loaded again.
+	if err := store.SetConfig(ctx, "thumb_width", "250"); err != nil {
+		t.Fatal(err)
+	}
+	v, err = c.Values(ctx)
+	if err != nil {
+		t.Fatalf("Values() failed: %v", err)
+	}
+	if got, want := v.Int("thumb_width", 0), 192; got != want {
+		t.Errorf("cached Int(thumb_width) = %d, want %d", got, want)
+	}
+	if err := c.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh() failed: %v", err)
+	}
+	if got, want := <-changes, (ConfigChange{Name: "thumb_width", Old: "192", New: "250"}); got != want {
+		t.Errorf("change = %+v, want %+v", got, want)
+	}
+
+	if err := c.SetBool(ctx, "anon_comment", true); err != nil {
+		t.Fatalf("SetBool() failed: %v", err)
+	}
+	if err := c.SetInt(ctx, "thumb_height", 200); err != nil {
+		t.Fatalf("SetInt() failed: %v", err)
+	}
+	if got, want := <-changes, (ConfigChange{Name: "thumb_height", New: "200"}); got != want {
+		t.Errorf("change = %+v, want %+v", got, want)
+	}
+	v, err = c.Values(ctx)
+	if err != nil {
+		t.Fatalf("Values() failed: %v", err)
+	}
+	if !v.Bool("anon_comment", false) || v.Int("thumb_height", 0) != 200 {
+		t.Errorf("Values() = %v, want anon_comment and thumb_height set", v)
+	}
+	stored, err := store.GetConfig(ctx, "anon_comment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := stored["anon_comment"], "Y"; got != want {
+		t.Errorf("stored anon_comment = %q, want %q", got, want)
+	}
+
+	cancel()
+	if _, ok := <-changes; ok {
+		t.Error("Watch channel is not closed after the context is done")
+	}
+}
+
+// flakyConfigStore fails the first fails calls to GetConfig.
+type flakyConfigStore struct {
+	ConfigStore
+	mu    sync.Mutex
+	fails int
+}
+
+func (s *flakyConfigStore) GetConfig(ctx context.Context, keys ...string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fails > 0 {
+		s.fails--
+		return nil, errors.New("database is down")
+	}
+	return s.ConfigStore.GetConfig(ctx, keys...)
+}
+
+func TestConfigPoll(t *testing.T) {
+	ctx := context.Background()
+	store := &flakyConfigStore{ConfigStore: shimmietest.New()}
+	if err := store.SetConfig(ctx, "thumb_width", "192"); err != nil {
+		t.Fatal(err)
+	}
+	c := NewConfig(store, 10*time.Millisecond)
+	if err := c.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	store.mu.Lock()
+	store.fails = 2
+	store.mu.Unlock()
+
+	pctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make(chan error, 10)
+	done := make(chan error)
+	go func() { done <- c.Poll(pctx, func(err error) { errs <- err }) }()
+
+	// Polling goes on after the failed refreshes.
+	changes := c.Watch(pctx, "thumb_width")
+	deadline := time.After(5 * time.Second)
+	for n := 0; n < 2; n++ {
+		select {
+		case <-errs:
+		case <-deadline:
+			t.Fatalf("onError was called %d times, want 2", n)
+		}
+	}
+	if err := store.ConfigStore.SetConfig(ctx, "thumb_width", "250"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case change := <-changes:
+		if change.Old != "192" || change.New != "250" {
+			t.Errorf("change = %+v, want thumb_width from 192 to 250", change)
+		}
+	case <-deadline:
+		t.Fatal("change after the failed refreshes was not seen")
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Poll returned %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,367 @@
+package shimmie
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigType is the type of a config value.
+type ConfigType int
+
+// The types of config values. They are stored as described by the getters
+// of ConfigValues.
+const (
+	ConfigString ConfigType = iota
+	ConfigInt
+	ConfigBool
+	ConfigDuration
+	ConfigList
+)
+
+func (t ConfigType) String() string {
+	switch t {
+	case ConfigString:
+		return "string"
+	case ConfigInt:
+		return "int"
+	case ConfigBool:
+		return "bool"
+	case ConfigDuration:
+		return "duration"
+	case ConfigList:
+		return "list"
+	}
+	return fmt.Sprintf("ConfigType(%d)", int(t))
+}
+
+// check returns an error if value is not of type t.
+func (t ConfigType) check(value string) error {
+	switch t {
+	case ConfigInt:
+		if _, err := strconv.Atoi(strings.TrimSpace(value)); err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+	case ConfigBool:
+		if _, ok := ParseConfigBool(value); !ok {
+			return fmt.Errorf("%q is not a boolean", value)
+		}
+	case ConfigDuration:
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil || n < 0 {
+			return fmt.Errorf("%q is not a number of seconds", value)
+		}
+	}
+	return nil
+}
+
+// ConfigKey describes a known config key.
+type ConfigKey struct {
+	Name    string
+	Type    ConfigType
+	Default string
+	// Validate, if set, is called with the values that are of the right
+	// type.
+	Validate func(value string) error
+}
+
+// ConfigRange returns a validation that accepts the integers from min to max.
+func ConfigRange(min, max int) func(string) error {
+	return func(value string) error {
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		if n < min || n > max {
+			return fmt.Errorf("%d is not between %d and %d", n, min, max)
+		}
+		return nil
+	}
+}
+
+// ConfigOneOf returns a validation that accepts only the given values.
+func ConfigOneOf(values ...string) func(string) error {
+	return func(value string) error {
+		for _, v := range values {
+			if value == v {
+				return nil
+			}
+		}
+		return fmt.Errorf("%q is not one of %s", value, strings.Join(values, ", "))
+	}
+}
+
+// ConfigChars returns a validation that accepts the values made only of the
+// given characters, like the rating privileges of Shimmie.
+func ConfigChars(chars string) func(string) error {
+	return func(value string) error {
+		for _, r := range value {
+			if !strings.ContainsRune(chars, r) {
+				return fmt.Errorf("%q has %q which is not one of %q", value, r, chars)
+			}
+		}
+		return nil
+	}
+}
+
+// ConfigProblem is a config value that is unknown or malformed.
+type ConfigProblem struct {
+	Name  string
+	Value string
+	// Err is nil if the key is unknown.
+	Err error
+}
+
+func (p ConfigProblem) Error() string {
+	if p.Err == nil {
+		return fmt.Sprintf("config %s: unknown key", p.Name)
+	}
+	return fmt.Sprintf("config %s: %v", p.Name, p.Err)
+}
+
+// ConfigProblems is returned by ImportConfig when some of the values are
+// unknown or malformed.
+type ConfigProblems []ConfigProblem
+
+func (ps ConfigProblems) Error() string {
+	msgs := make([]string, len(ps))
+	for i, p := range ps {
+		msgs[i] = p.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// ConfigSchema is a registry of known config keys.
+type ConfigSchema struct {
+	keys map[string]ConfigKey
+}
+
+// NewConfigSchema returns a schema with the given keys.
+func NewConfigSchema(keys ...ConfigKey) *ConfigSchema {
+	s := &ConfigSchema{keys: make(map[string]ConfigKey, len(keys))}
+	for _, k := range keys {
+		s.Register(k)
+	}
+	return s
+}
+
+// Register adds a key to the schema. It panics if the key is already
+// registered or its default does not pass its own validation.
+func (s *ConfigSchema) Register(k ConfigKey) {
+	if _, ok := s.keys[k.Name]; ok {
+		panic("shimmie: config key " + k.Name + " registered twice")
+	}
+	s.keys[k.Name] = k
+	if k.Default != "" {
+		if err := s.Check(k.Name, k.Default); err != nil {
+			panic("shimmie: default of " + err.Error())
+		}
+	}
+}
+
+// Lookup returns the key with the given name. The ext_<name>_version keys,
+// where Shimmie records the version of each extension that it has set up,
+// are known without being registered.
+func (s *ConfigSchema) Lookup(name string) (ConfigKey, bool) {
+	k, ok := s.keys[name]
+	if !ok && isExtVersionKey(name) {
+		return ConfigKey{Name: name, Type: ConfigString}, true
+	}
+	return k, ok
+}
+
+func isExtVersionKey(name string) bool {
+	ext := strings.TrimSuffix(strings.TrimPrefix(name, "ext_"), "_version")
+	return len(ext) != 0 && len(ext)+len("ext__version") == len(name)
+}
+
+// Keys returns the registered keys sorted by name.
+func (s *ConfigSchema) Keys() []ConfigKey {
+	keys := make([]ConfigKey, 0, len(s.keys))
+	for _, k := range s.keys {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Name < keys[j].Name })
+	return keys
+}
+
+// Check returns a *ConfigProblem if name is unknown or value is not valid
+// for it. Empty values are valid since Shimmie treats them as unset.
+func (s *ConfigSchema) Check(name, value string) error {
+	k, ok := s.Lookup(name)
+	if !ok {
+		return &ConfigProblem{Name: name, Value: value}
+	}
+	if value == "" {
+		return nil
+	}
+	err := k.Type.check(value)
+	if err == nil && k.Validate != nil {
+		err = k.Validate(value)
+	}
+	if err != nil {
+		return &ConfigProblem{Name: name, Value: value, Err: err}
+	}
+	return nil
+}
+
+// Defaults returns values with the defaults of the keys that are missing or
+// empty in them.
+func (s *ConfigSchema) Defaults(values ConfigValues) ConfigValues {
+	m := make(ConfigValues, len(s.keys)+len(values))
+	for name, k := range s.keys {
+		if k.Default != "" {
+			m[name] = k.Default
+		}
+	}
+	for name, v := range values {
+		if v != "" || m[name] == "" {
+			m[name] = v
+		}
+	}
+	return m
+}
+
+// Validate checks every value of the config table and returns the ones that
+// are unknown or malformed sorted by name.
+func (s *ConfigSchema) Validate(ctx context.Context, store ConfigStore) ([]ConfigProblem, error) {
+	values, err := store.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.validate(values), nil
+}
+
+func (s *ConfigSchema) validate(values map[string]string) ConfigProblems {
+	var problems ConfigProblems
+	for name, v := range values {
+		if err := s.Check(name, v); err != nil {
+			problems = append(problems, *err.(*ConfigProblem))
+		}
+	}
+	sort.Slice(problems, func(i, j int) bool { return problems[i].Name < problems[j].Name })
+	return problems
+}
+
+// ConfigFormat is a file format for exporting and importing config values.
+type ConfigFormat string
+
+// The supported config formats.
+const (
+	ConfigJSON ConfigFormat = "json"
+	ConfigYAML ConfigFormat = "yaml"
+)
+
+// ExportConfig writes all the config values to w as a mapping from name to
+// value, sorted by name.
+func ExportConfig(ctx context.Context, store ConfigStore, w io.Writer, format ConfigFormat) error {
+	values, err := store.GetConfig(ctx)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case ConfigJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(values)
+	case ConfigYAML:
+		enc := yaml.NewEncoder(w)
+		if err := enc.Encode(values); err != nil {
+			return err
+		}
+		return enc.Close()
+	}
+	return fmt.Errorf("unknown config format %q", format)
+}
+
+// ImportConfig reads config values written by ExportConfig from r and stores
+// them all at once with SetConfigs. If schema is not nil, nothing is stored
+// unless every value passes Check, otherwise ConfigProblems is returned.
+// Values that are not in r are left as they are.
+func ImportConfig(ctx context.Context, store ConfigStore, r io.Reader, format ConfigFormat, schema *ConfigSchema) error {
+	var values map[string]string
+	switch format {
+	case ConfigJSON:
+		if err := json.NewDecoder(r).Decode(&values); err != nil {
+			return fmt.Errorf("reading config: %v", err)
+		}
+	case ConfigYAML:
+		if err := yaml.NewDecoder(r).Decode(&values); err != nil && err != io.EOF {
+			return fmt.Errorf("reading config: %v", err)
+		}
+	default:
+		return fmt.Errorf("unknown config format %q", format)
+	}
+	if schema != nil {
+		if problems := schema.validate(values); len(problems) != 0 {
+			return problems
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return store.SetConfigs(ctx, values)
+}
+
+// DefaultConfigSchema has the keys of Shimmie core and of the extensions
+// that are enabled on kusubooru, with the defaults of Shimmie.
+var DefaultConfigSchema = NewConfigSchema(
+	// Site.
+	ConfigKey{Name: "title", Type: ConfigString, Default: "Shimmie"},
+	ConfigKey{Name: "site_description", Type: ConfigString},
+	ConfigKey{Name: "site_keywords", Type: ConfigString},
+	ConfigKey{Name: "site_email", Type: ConfigString},
+	ConfigKey{Name: "contact_link", Type: ConfigString},
+	ConfigKey{Name: "front_page", Type: ConfigString, Default: "post/list"},
+	ConfigKey{Name: "main_page", Type: ConfigString, Default: "post/list"},
+	ConfigKey{Name: "theme", Type: ConfigString, Default: "default"},
+	ConfigKey{Name: "google_analytics_id", Type: ConfigString},
+	ConfigKey{Name: "ga_profile_id", Type: ConfigString},
+	ConfigKey{Name: "db_version", Type: ConfigInt},
+	ConfigKey{Name: "anon_id", Type: ConfigInt, Default: "1", Validate: ConfigRange(1, 1<<31-1)},
+
+	// Images and thumbnails.
+	ConfigKey{Name: "index_images", Type: ConfigInt, Default: "24", Validate: ConfigRange(1, 1000)},
+	ConfigKey{Name: "thumb_engine", Type: ConfigString, Default: "gd", Validate: ConfigOneOf("gd", "convert")},
+	ConfigKey{Name: "thumb_width", Type: ConfigInt, Default: "192", Validate: ConfigRange(1, 2048)},
+	ConfigKey{Name: "thumb_height", Type: ConfigInt, Default: "192", Validate: ConfigRange(1, 2048)},
+	ConfigKey{Name: "thumb_quality", Type: ConfigInt, Default: "75", Validate: ConfigRange(1, 100)},
+	ConfigKey{Name: "thumb_mem_limit", Type: ConfigInt, Default: "8388608", Validate: ConfigRange(0, 1<<31-1)},
+	ConfigKey{Name: "image_ilink", Type: ConfigString},
+	ConfigKey{Name: "image_slink", Type: ConfigString},
+	ConfigKey{Name: "image_tlink", Type: ConfigString},
+	ConfigKey{Name: "image_tip", Type: ConfigString, Default: "$tags // $size // $filesize"},
+	ConfigKey{Name: "image_expires", Type: ConfigDuration, Default: "2678400"},
+	ConfigKey{Name: "image_show_meta", Type: ConfigBool, Default: "N"},
+	ConfigKey{Name: "upload_collision_handler", Type: ConfigString, Default: "error", Validate: ConfigOneOf("error", "merge")},
+
+	// Uploads.
+	ConfigKey{Name: "upload_count", Type: ConfigInt, Default: "3", Validate: ConfigRange(1, 100)},
+	ConfigKey{Name: "upload_size", Type: ConfigInt, Default: "1048576", Validate: ConfigRange(1, 1<<31-1)},
+	ConfigKey{Name: "upload_tlsource", Type: ConfigBool, Default: "Y"},
+	ConfigKey{Name: "transload_engine", Type: ConfigString, Default: "none", Validate: ConfigOneOf("none", "curl", "fopen", "wget")},
+
+	// Users and anonymous permissions.
+	ConfigKey{Name: "login_signup_enabled", Type: ConfigBool, Default: "Y"},
+	ConfigKey{Name: "login_tac", Type: ConfigString},
+	ConfigKey{Name: "upload_anon", Type: ConfigBool, Default: "N"},
+	ConfigKey{Name: "comment_anon", Type: ConfigBool, Default: "Y"},
+	ConfigKey{Name: "tag_edit_anon", Type: ConfigBool, Default: "Y"},
+	ConfigKey{Name: "source_edit_anon", Type: ConfigBool, Default: "Y"},
+	ConfigKey{Name: "wiki_edit_anon", Type: ConfigBool, Default: "N"},
+	ConfigKey{Name: "wiki_edit_user", Type: ConfigBool, Default: "N"},
+	ConfigKey{Name: "ext_rating_anon_privs", Type: ConfigString, Default: "squ", Validate: ConfigChars("sqeu")},
+	ConfigKey{Name: "ext_rating_user_privs", Type: ConfigString, Default: "sqeu", Validate: ConfigChars("sqeu")},
+	ConfigKey{Name: "ext_rating_admin_privs", Type: ConfigString, Default: "sqeu", Validate: ConfigChars("sqeu")},
+	ConfigKey{Name: "comment_captcha", Type: ConfigBool, Default: "N"},
+	ConfigKey{Name: "comment_limit", Type: ConfigInt, Default: "10", Validate: ConfigRange(0, 1000)},
+	ConfigKey{Name: "comment_window", Type: ConfigInt, Default: "5", Validate: ConfigRange(0, 1000)},
+	ConfigKey{Name: "comment_count", Type: ConfigInt, Default: "5", Validate: ConfigRange(0, 1000)},
+	ConfigKey{Name: "comment_list_count", Type: ConfigInt, Default: "10", Validate: ConfigRange(1, 1000)},
+)
@@ -0,0 +1,130 @@
+package shimmie_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	. "github.com/kusubooru/shimmie"
+	"github.com/kusubooru/shimmie/shimmietest"
+)
+
+func TestConfigSchemaCheck(t *testing.T) {
+	var tests = []struct {
+		name, value string
+		ok          bool
+	}{
+		{"thumb_width", "250", true},
+		{"thumb_width", "", true},
+		{"thumb_width", "25O", false},
+		{"thumb_width", "0", false},
+		{"thumb_quality", "101", false},
+		{"thumb_engine", "convert", true},
+		{"thumb_engine", "imagick", false},
+		{"image_show_meta", "Y", true},
+		{"image_show_meta", "sure", false},
+		{"image_expires", "-1", false},
+		{"upload_anon", "Y", true},
+		{"ext_rating_anon_privs", "sq", true},
+		{"ext_rating_anon_privs", "sqx", false},
+		{"thumb_widht", "250", false},
+		{"ext_tagger_version", "1", true},
+		{"ext_version", "1", false},
+		{"ext_tagger_versions", "1", false},
+	}
+	for _, tt := range tests {
+		err := DefaultConfigSchema.Check(tt.name, tt.value)
+		if got := err == nil; got != tt.ok {
+			t.Errorf("Check(%q, %q) = %v, want ok %v", tt.name, tt.value, err, tt.ok)
+		}
+	}
+}
+
+func TestConfigSchemaValidate(t *testing.T) {
+	ctx := context.Background()
+	store := shimmietest.New()
+	for name, value := range map[string]string{
+		"title":          "kusubooru",
+		"thumb_width":    "big",
+		"thumb_widht":    "250",
+		"index_images":   "24",
+		"ext_pm_version": "2",
+	} {
+		if err := store.SetConfig(ctx, name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	problems, err := DefaultConfigSchema.Validate(ctx, store)
+	if err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+	if len(problems) != 2 {
+		t.Fatalf("Validate() = %v, want 2 problems", problems)
+	}
+	if p := problems[0]; p.Name != "thumb_widht" || p.Err != nil {
+		t.Errorf("problems[0] = %v, want unknown thumb_widht", p)
+	}
+	if p := problems[1]; p.Name != "thumb_width" || p.Value != "big" || p.Err == nil {
+		t.Errorf("problems[1] = %v, want malformed thumb_width", p)
+	}
+}
+
+func TestConfigSchemaDefaults(t *testing.T) {
+	v := DefaultConfigSchema.Defaults(ConfigValues{"thumb_width": "250", "thumb_height": "", "custom": "x"})
+	if got, want := v.Int("thumb_width", 0), 250; got != want {
+		t.Errorf("thumb_width = %d, want %d", got, want)
+	}
+	if got, want := v.Int("thumb_height", 0), 192; got != want {
+		t.Errorf("thumb_height = %d, want %d", got, want)
+	}
+	if got, want := v.String("custom", ""), "x"; got != want {
+		t.Errorf("custom = %q, want %q", got, want)
+	}
+}
+
+func TestExportImportConfig(t *testing.T) {
+	ctx := context.Background()
+	values := map[string]string{
+		"title":              "kusubooru",
+		"thumb_width":        "250",
+		"image_show_meta":    "Y",
+		"site_keywords":      "anime: art, fan art",
+		"ext_rating_version": "2",
+	}
+	for _, format := range []ConfigFormat{ConfigJSON, ConfigYAML} {
+		src := shimmietest.New()
+		for name, value := range values {
+			if err := src.SetConfig(ctx, name, value); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var buf bytes.Buffer
+		if err := ExportConfig(ctx, src, &buf, format); err != nil {
+			t.Fatalf("ExportConfig(%s) failed: %v", format, err)
+		}
+		dst := shimmietest.New()
+		if err := ImportConfig(ctx, dst, &buf, format, DefaultConfigSchema); err != nil {
+			t.Fatalf("ImportConfig(%s) failed: %v", format, err)
+		}
+		got, err := dst.GetConfig(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, values) {
+			t.Errorf("%s: imported %v, want %v", format, got, values)
+		}
+	}
+
+	dst := shimmietest.New()
+	err := ImportConfig(ctx, dst, strings.NewReader("title: kusubooru\nthumb_width: wide\n"), ConfigYAML, DefaultConfigSchema)
+	var problems ConfigProblems
+	if !errors.As(err, &problems) || len(problems) != 1 || problems[0].Name != "thumb_width" {
+		t.Fatalf("ImportConfig(malformed) = %v, want a thumb_width problem", err)
+	}
+	if got, _ := dst.GetConfig(ctx); len(got) != 0 {
+		t.Errorf("ImportConfig(malformed) stored %v, want nothing", got)
+	}
+}
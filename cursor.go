@@ -0,0 +1,48 @@
+package shimmie
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrInvalidCursor is returned when a cursor token cannot be decoded.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor marks the position of the last entry of a page in a keyset paginated
+// listing. Only the fields relevant to the ordering of the listing are set.
+//
+// Clients should not inspect cursors. They should treat the token returned by
+// Encode as opaque and pass it back as it is to get the next page.
+type Cursor struct {
+	ID    int64      `json:"id,omitempty"`
+	Name  string     `json:"name,omitempty"`
+	Time  *time.Time `json:"time,omitempty"`
+	Score int        `json:"score,omitempty"`
+}
+
+// Encode returns the cursor as an opaque URL safe token.
+func (c Cursor) Encode() string {
+	// Marshaling a struct of basic types cannot fail.
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor decodes a token created by Cursor.Encode. An empty token means
+// that the listing should start from the beginning in which case nil is
+// returned. If the token is malformed then ErrInvalidCursor is returned.
+func DecodeCursor(token string) (*Cursor, error) {
+	if token == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
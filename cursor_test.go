@@ -0,0 +1,42 @@
+package shimmie_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	. "github.com/kusubooru/shimmie"
+)
+
+func TestCursor(t *testing.T) {
+	now := time.Date(2016, 8, 2, 11, 38, 42, 0, time.UTC)
+	var tests = []Cursor{
+		{ID: 42},
+		{Name: "old_tag"},
+		{ID: 7, Time: &now},
+		{ID: 3, Score: -2},
+	}
+	for _, c := range tests {
+		token := c.Encode()
+		got, err := DecodeCursor(token)
+		if err != nil {
+			t.Fatalf("DecodeCursor(%q) returned err: %v", token, err)
+		}
+		if want := &c; !reflect.DeepEqual(got, want) {
+			t.Errorf("DecodeCursor(%q) = %#v, want %#v", token, got, want)
+		}
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	c, err := DecodeCursor("")
+	if err != nil || c != nil {
+		t.Errorf("DecodeCursor(%q) = %#v, %v, want nil, nil", "", c, err)
+	}
+
+	for _, token := range []string{"!!!", "bm90IGpzb24"} {
+		if _, err := DecodeCursor(token); err != ErrInvalidCursor {
+			t.Errorf("DecodeCursor(%q) returned err = %v, want %v", token, err, ErrInvalidCursor)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package shimmie
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// ImageDeletion describes who deletes an image and why.
+type ImageDeletion struct {
+	// User is the user that deletes the image. It may be nil for deletions
+	// that are not made by a user.
+	User    *User
+	Address string
+	Reason  string
+	// BanHash adds the hash of the image to the ban list so that it cannot
+	// be uploaded again.
+	BanHash bool
+}
+
+// Username returns the name of the user of d or an empty string.
+func (d ImageDeletion) Username() string {
+	if d.User == nil {
+		return ""
+	}
+	return d.User.Name
+}
+
+// LogMessage returns the score_log message of the deletion of img, which
+// is logged in the "core-image" section like Shimmie does.
+func (d ImageDeletion) LogMessage(img *Image) string {
+	msg := fmt.Sprintf("Deleted Image #%d (%s)", img.ID, img.Hash)
+	if d.Reason != "" {
+		msg += ": " + d.Reason
+	}
+	return msg
+}
+
+// DeleteImage deletes an image with store.DeleteImage and, once the
+// deletion is committed, removes the image from shim.PHashes, if set, and
+// removes the file and thumbnail of the image. Files that are already
+// missing are ignored. If the files cannot be removed, the deleted image is
+// returned along with the error.
+func (shim *Shimmie) DeleteImage(ctx context.Context, store ImageStore, id int64, d ImageDeletion) (*Image, error) {
+	img, err := store.DeleteImage(ctx, id, d)
+	if err != nil {
+		return nil, err
+	}
+	if shim.PHashes != nil {
+		shim.PHashes.Remove(img.ID)
+	}
+	return img, shim.RemoveImageFiles(img.Hash)
+}
+
+// RemoveImageFiles removes the file and thumbnail of the image with the
+// given hash.
+func (shim *Shimmie) RemoveImageFiles(hash string) error {
+	for _, name := range []string{shim.ImageFile(hash), shim.ThumbFile(hash)} {
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package shimmie_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/kusubooru/shimmie"
+	"github.com/kusubooru/shimmie/shimmietest"
+)
+
+func TestDeleteImage(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	shim := &Shimmie{ImagePath: filepath.Join(dir, "images"), ThumbPath: filepath.Join(dir, "thumbs"), PHashes: NewPHashIndex()}
+	store := shimmietest.New()
+	if err := store.CreateUser(ctx, &User{Name: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, hash := range []string{"aa01", "ab02"} {
+		id, err := store.CreateImage(ctx, Image{OwnerID: 1, Hash: hash})
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeImage(t, shim, hash, 8, 8)
+		if _, err := shim.IndexImage(ctx, store, Image{ID: id, Hash: hash}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The second image has no thumbnail.
+	if err := shim.MakeThumb("aa01", ThumbOptions{Width: 4, Height: 4, Quality: 75}); err != nil {
+		t.Fatal(err)
+	}
+
+	for id, hash := range map[int64]string{1: "aa01", 2: "ab02"} {
+		img, err := shim.DeleteImage(ctx, store, id, ImageDeletion{Reason: "test"})
+		if err != nil {
+			t.Fatalf("DeleteImage(%d) failed: %v", id, err)
+		}
+		if img.Hash != hash {
+			t.Errorf("DeleteImage(%d) returned hash %q, want %q", id, img.Hash, hash)
+		}
+		for _, name := range []string{shim.ImageFile(hash), shim.ThumbFile(hash)} {
+			if _, err := os.Stat(name); !os.IsNotExist(err) {
+				t.Errorf("%s was not removed: %v", name, err)
+			}
+		}
+		if _, err := shim.PHashes.FindSimilar(id, 0); err != ErrNotFound {
+			t.Errorf("FindSimilar(%d) after delete returned err %v, want %v", id, err, ErrNotFound)
+		}
+	}
+	if n := shim.PHashes.Len(); n != 0 {
+		t.Errorf("index has %d images after deleting all, want 0", n)
+	}
+}
@@ -0,0 +1,35 @@
+package shimmie
+
+import (
+	"fmt"
+	"time"
+)
+
+// ImageBan is a banned image hash. Images with a banned hash cannot be
+// created.
+type ImageBan struct {
+	ID     int64
+	Hash   string
+	Date   time.Time
+	Reason string
+	// UserID and UserName are those of the user that banned the hash and
+	// are empty if it is unknown.
+	UserID   int64
+	UserName string
+}
+
+// HashBannedError is returned when an image with a banned hash is created.
+type HashBannedError struct {
+	Hash   string
+	Reason string
+}
+
+func (e *HashBannedError) Error() string {
+	return fmt.Sprintf("image hash %s is banned: %s", e.Hash, e.Reason)
+}
+
+// HashBanLogMessage returns the score_log message of a hash ban, which is
+// logged in the "image_hash_ban" section like Shimmie does.
+func HashBanLogMessage(hash, reason string) string {
+	return fmt.Sprintf("Banned hash %s because '%s'", hash, reason)
+}
@@ -0,0 +1,234 @@
+package shimmie
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Problems that CheckFiles can find. Files that exist but cannot be read,
+// e.g. for lack of permission, are FileUnreadable rather than FileMissing.
+const (
+	FileMissing      = "missing"
+	FileUnreadable   = "unreadable"
+	FileSizeMismatch = "size_mismatch"
+	FileHashMismatch = "hash_mismatch"
+	ThumbMissing     = "thumb_missing"
+	FileOrphan       = "orphan"
+)
+
+// FileIssue is a problem with the file of an image or its thumbnail.
+type FileIssue struct {
+	// ImageID is zero for orphan files.
+	ImageID int64  `json:"image_id,omitempty"`
+	Hash    string `json:"hash"`
+	Path    string `json:"path"`
+	Problem string `json:"problem"`
+	Detail  string `json:"detail,omitempty"`
+	// Repaired is set if the issue was repaired and RepairError if the
+	// repair failed.
+	Repaired    bool   `json:"repaired,omitempty"`
+	RepairError string `json:"repair_error,omitempty"`
+}
+
+// IntegrityReport is the result of CheckFiles.
+type IntegrityReport struct {
+	Started  time.Time   `json:"started"`
+	Finished time.Time   `json:"finished"`
+	Images   int         `json:"images"`
+	Issues   []FileIssue `json:"issues"`
+}
+
+// WriteJSON writes the report to w as indented JSON.
+func (r *IntegrityReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// CheckOptions configure CheckFiles.
+type CheckOptions struct {
+	// Workers is the number of images checked at once. It defaults to the
+	// number of CPUs.
+	Workers int
+	// PageSize is the number of images that are listed at a time. It
+	// defaults to 100.
+	PageSize int
+	// RepairThumbs regenerates the missing thumbnails of the images whose
+	// file is intact.
+	RepairThumbs bool
+	// Thumb is used to repair thumbnails.
+	Thumb ThumbOptions
+}
+
+// CheckFiles verifies that every image of store has a file under ImagePath
+// whose size and MD5 match the Filesize and Hash of the image, and a
+// thumbnail under ThumbPath. It also reports the files under ImagePath and
+// ThumbPath that belong to no image. Issues are sorted by image ID and
+// orphans come last.
+func (shim *Shimmie) CheckFiles(ctx context.Context, store ImageStore, opts CheckOptions) (*IntegrityReport, error) {
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.NumCPU()
+	}
+	if opts.PageSize <= 0 {
+		opts.PageSize = 100
+	}
+	report := &IntegrityReport{Started: time.Now(), Issues: []FileIssue{}}
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		hashes = make(map[string]bool)
+		jobs   = make(chan Image)
+	)
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for img := range jobs {
+				issues := shim.checkImage(img, opts)
+				mu.Lock()
+				report.Issues = append(report.Issues, issues...)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	var cursor string
+	err := func() error {
+		defer func() {
+			close(jobs)
+			wg.Wait()
+		}()
+		for {
+			images, next, err := store.ListImages(ctx, ImageFilter{}, opts.PageSize, cursor)
+			if err != nil {
+				return err
+			}
+			for _, img := range images {
+				hashes[img.Hash] = true
+				select {
+				case jobs <- img:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			report.Images += len(images)
+			if next == "" {
+				return nil
+			}
+			cursor = next
+		}
+	}()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(report.Issues, func(i, j int) bool {
+		a, b := report.Issues[i], report.Issues[j]
+		if a.ImageID != b.ImageID {
+			return a.ImageID < b.ImageID
+		}
+		return a.Path < b.Path
+	})
+
+	for _, dir := range []string{shim.ImagePath, shim.ThumbPath} {
+		orphans, err := findOrphans(ctx, dir, hashes)
+		if err != nil {
+			return nil, err
+		}
+		report.Issues = append(report.Issues, orphans...)
+	}
+	report.Finished = time.Now()
+	return report, nil
+}
+
+// checkImage checks the file and thumbnail of img and repairs the thumbnail
+// if asked to.
+func (shim *Shimmie) checkImage(img Image, opts CheckOptions) []FileIssue {
+	var issues []FileIssue
+	issue := func(path, problem, detail string) {
+		issues = append(issues, FileIssue{ImageID: img.ID, Hash: img.Hash, Path: path, Problem: problem, Detail: detail})
+	}
+
+	name := shim.ImageFile(img.Hash)
+	intact := false
+	switch size, sum, err := md5File(name); {
+	case os.IsNotExist(err):
+		issue(name, FileMissing, "")
+	case err != nil:
+		issue(name, FileUnreadable, err.Error())
+	case size != int64(img.Filesize):
+		issue(name, FileSizeMismatch, fmt.Sprintf("file has %d bytes, image has %d", size, img.Filesize))
+	case !strings.EqualFold(sum, img.Hash):
+		issue(name, FileHashMismatch, "file has MD5 "+sum)
+	default:
+		intact = true
+	}
+
+	thumb := shim.ThumbFile(img.Hash)
+	switch _, err := os.Stat(thumb); {
+	case err == nil:
+	case !os.IsNotExist(err):
+		issue(thumb, FileUnreadable, err.Error())
+	default:
+		issue(thumb, ThumbMissing, "")
+		if opts.RepairThumbs && intact {
+			i := &issues[len(issues)-1]
+			if err := shim.MakeThumb(img.Hash, opts.Thumb); err != nil {
+				i.RepairError = err.Error()
+			} else {
+				i.Repaired = true
+			}
+		}
+	}
+	return issues
+}
+
+// md5File returns the size and hex encoded MD5 of a file.
+func md5File(name string) (int64, string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	h := md5.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// findOrphans returns the files under dir that are not named after one of
+// hashes. Hidden files, like the temporary files of MakeThumb, are skipped.
+func findOrphans(ctx context.Context, dir string, hashes map[string]bool) ([]FileIssue, error) {
+	var orphans []FileIssue
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".") || hashes[d.Name()] {
+			return nil
+		}
+		orphans = append(orphans, FileIssue{Hash: d.Name(), Path: path, Problem: FileOrphan})
+		return nil
+	})
+	return orphans, err
+}
@@ -0,0 +1,143 @@
+package shimmie_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/kusubooru/shimmie"
+	"github.com/kusubooru/shimmie/shimmietest"
+)
+
+// pngFile returns a PNG image that is filled with c and its MD5.
+func pngFile(t *testing.T, c color.Color) ([]byte, string) {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 32))
+	for x := 0; x < 64; x++ {
+		for y := 0; y < 32; y++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	sum := md5.Sum(buf.Bytes())
+	return buf.Bytes(), hex.EncodeToString(sum[:])
+}
+
+func writeFile(t *testing.T, name string, data []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckFiles(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	shim := &Shimmie{ImagePath: filepath.Join(dir, "images"), ThumbPath: filepath.Join(dir, "thumbs")}
+	store := shimmietest.New()
+	if err := store.CreateUser(ctx, &User{Name: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	colors := []color.Color{color.White, color.Black, color.NRGBA{R: 255, A: 255}, color.NRGBA{G: 255, A: 255}, color.NRGBA{B: 255, A: 255}, color.NRGBA{R: 255, G: 255, A: 255}}
+	var hashes []string
+	for i, c := range colors {
+		data, hash := pngFile(t, c)
+		hashes = append(hashes, hash)
+		img := Image{OwnerID: 1, Hash: hash, Filesize: len(data)}
+		switch i {
+		case 0: // Intact with a thumbnail.
+			writeFile(t, shim.ThumbFile(hash), []byte("thumb"))
+		case 1: // Missing file and thumbnail.
+			data = nil
+		case 2: // Wrong size.
+			img.Filesize++
+		case 3: // Corrupted.
+			data = bytes.Repeat([]byte{0}, len(data))
+		case 4: // Intact without a thumbnail.
+		case 5: // A directory in place of the file.
+			data = nil
+			if err := os.MkdirAll(shim.ImageFile(hash), 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := store.CreateImage(ctx, img); err != nil {
+			t.Fatal(err)
+		}
+		if data != nil {
+			writeFile(t, shim.ImageFile(hash), data)
+		}
+		if i == 2 || i == 3 || i == 5 {
+			writeFile(t, shim.ThumbFile(hash), []byte("thumb"))
+		}
+	}
+	writeFile(t, filepath.Join(shim.ImagePath, "ff", "ffff"), []byte("orphan"))
+	writeFile(t, filepath.Join(shim.ThumbPath, "ee", "eeee"), []byte("orphan"))
+
+	report, err := shim.CheckFiles(ctx, store, CheckOptions{
+		Workers:      3,
+		PageSize:     2,
+		RepairThumbs: true,
+		Thumb:        ThumbOptions{Width: 32, Height: 32, Quality: 75},
+	})
+	if err != nil {
+		t.Fatalf("CheckFiles() failed: %v", err)
+	}
+	if report.Images != len(colors) {
+		t.Errorf("CheckFiles() checked %d images, want %d", report.Images, len(colors))
+	}
+
+	type issue struct {
+		id       int64
+		hash     string
+		problem  string
+		repaired bool
+	}
+	want := []issue{
+		{2, hashes[1], FileMissing, false},
+		{2, hashes[1], ThumbMissing, false},
+		{3, hashes[2], FileSizeMismatch, false},
+		{4, hashes[3], FileHashMismatch, false},
+		{5, hashes[4], ThumbMissing, true},
+		{6, hashes[5], FileUnreadable, false},
+		{0, "ffff", FileOrphan, false},
+		{0, "eeee", FileOrphan, false},
+	}
+	var got []issue
+	for _, i := range report.Issues {
+		got = append(got, issue{i.ImageID, i.Hash, i.Problem, i.Repaired})
+	}
+	if len(got) != len(want) {
+		t.Fatalf("CheckFiles() issues = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("issue %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if _, err := os.Stat(shim.ThumbFile(hashes[4])); err != nil {
+		t.Errorf("missing thumbnail was not repaired: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteJSON(&buf); err != nil {
+		t.Fatalf("WriteJSON() failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"problem": "hash_mismatch"`) {
+		t.Errorf("WriteJSON() = %s, want a hash_mismatch issue", buf.String())
+	}
+}
@@ -0,0 +1,214 @@
+package shimmie
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IPBan bans an IP address or a CIDR range of addresses.
+type IPBan struct {
+	ID int64
+	// IP is an address, like "10.0.0.1", or a range, like "10.0.0.0/24".
+	IP         string
+	Reason     string
+	BannerID   int64
+	BannerName string
+	Added      time.Time
+	// Expires is nil for bans that never expire.
+	Expires *time.Time
+}
+
+// Network returns the range of addresses that are banned. A single address
+// is a range with a full mask.
+func (b IPBan) Network() (*net.IPNet, error) {
+	if strings.Contains(b.IP, "/") {
+		_, n, err := net.ParseCIDR(b.IP)
+		return n, err
+	}
+	ip := net.ParseIP(b.IP)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %q", b.IP)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// NormalizeIPBan returns the canonical form of an address or CIDR range, as
+// stored by the IPBanStore implementations, with the host bits of ranges
+// cleared. Single addresses are returned without a mask.
+func NormalizeIPBan(ip string) (string, error) {
+	n, err := IPBan{IP: strings.TrimSpace(ip)}.Network()
+	if err != nil {
+		return "", err
+	}
+	if ones, bits := n.Mask.Size(); ones == bits {
+		return n.IP.String(), nil
+	}
+	return n.String(), nil
+}
+
+// Active reports whether the ban has not expired at t.
+func (b IPBan) Active(t time.Time) bool {
+	return b.Expires == nil || b.Expires.After(t)
+}
+
+// Message returns the message shown to the banned users.
+func (b IPBan) Message(ip string) string {
+	until := "forever"
+	if b.Expires != nil {
+		until = "until " + b.Expires.UTC().Format("2006-01-02 15:04:05 MST")
+	}
+	return fmt.Sprintf("IP %s has been banned %s because of %s", ip, until, b.Reason)
+}
+
+// ipBanKey is a masked address of a bucket of ipBanIndex.
+type ipBanKey [net.IPv6len]byte
+
+// ipBanIndex finds the bans of an address with one map lookup per distinct
+// prefix length of the banned ranges.
+type ipBanIndex struct {
+	// buckets holds the bans by prefix length, in the 16 byte form of
+	// net.IP, and masked address.
+	buckets map[int]map[ipBanKey][]IPBan
+	lengths []int
+}
+
+func newIPBanIndex(bans []IPBan) *ipBanIndex {
+	x := &ipBanIndex{buckets: make(map[int]map[ipBanKey][]IPBan)}
+	for _, b := range bans {
+		n, err := b.Network()
+		if err != nil {
+			continue
+		}
+		ones, bits := n.Mask.Size()
+		// IPv4 addresses are kept in their IPv6 form.
+		ones += net.IPv6len*8 - bits
+		bucket, ok := x.buckets[ones]
+		if !ok {
+			bucket = make(map[ipBanKey][]IPBan)
+			x.buckets[ones] = bucket
+			x.lengths = append(x.lengths, ones)
+		}
+		k := maskedKey(n.IP.To16(), ones)
+		bucket[k] = append(bucket[k], b)
+	}
+	return x
+}
+
+func maskedKey(ip net.IP, ones int) ipBanKey {
+	var k ipBanKey
+	copy(k[:], ip.Mask(net.CIDRMask(ones, net.IPv6len*8)))
+	return k
+}
+
+// lookup returns an active ban of ip at t or nil.
+func (x *ipBanIndex) lookup(ip net.IP, t time.Time) *IPBan {
+	ip = ip.To16()
+	if ip == nil {
+		return nil
+	}
+	for _, ones := range x.lengths {
+		for _, b := range x.buckets[ones][maskedKey(ip, ones)] {
+			if b.Active(t) {
+				return &b
+			}
+		}
+	}
+	return nil
+}
+
+// IPBanList keeps the active IP bans of a store in memory so that requests
+// can be checked without querying the store. The bans are loaded by Refresh
+// and Poll. Until they are first loaded no address is banned.
+type IPBanList struct {
+	store IPBanStore
+
+	mu    sync.RWMutex
+	index *ipBanIndex
+}
+
+// NewIPBanList returns an empty list of the bans of store.
+func NewIPBanList(store IPBanStore) *IPBanList {
+	return &IPBanList{store: store}
+}
+
+// Refresh loads the active bans of the store.
+func (l *IPBanList) Refresh(ctx context.Context) error {
+	bans, err := l.store.ActiveIPBans(ctx)
+	if err != nil {
+		return err
+	}
+	index := newIPBanIndex(bans)
+	l.mu.Lock()
+	l.index = index
+	l.mu.Unlock()
+	return nil
+}
+
+// Poll refreshes the bans every interval until ctx is done. A failed refresh
+// is passed to onError, if it is not nil, and the bans that were loaded last
+// are kept until a refresh succeeds. It returns the error of ctx.
+func (l *IPBanList) Poll(ctx context.Context, interval time.Duration, onError func(error)) error {
+	refresh := func() {
+		if err := l.Refresh(ctx); err != nil && ctx.Err() == nil && onError != nil {
+			onError(err)
+		}
+	}
+	refresh()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			refresh()
+		}
+	}
+}
+
+// Lookup returns the ban of an address or nil if it is not banned. Bans that
+// have expired since the last refresh are ignored.
+func (l *IPBanList) Lookup(ip string) *IPBan {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil
+	}
+	l.mu.RLock()
+	index := l.index
+	l.mu.RUnlock()
+	if index == nil {
+		return nil
+	}
+	return index.lookup(addr, time.Now())
+}
+
+// BanCheck is a handler wrapper that responds with 403 Forbidden and the
+// reason of the ban to the requests whose original IP, as returned by
+// GetOriginalIP, is banned by shim.IPBans. If shim.IPBans is nil, all
+// requests are allowed. It is meant to wrap the handlers of Auth as well as
+// the public ones.
+func (shim *Shimmie) BanCheck(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if shim.IPBans != nil {
+			ip := GetOriginalIP(r)
+			if b := shim.IPBans.Lookup(ip); b != nil {
+				http.Error(w, b.Message(ip), http.StatusForbidden)
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// BanCheckFunc is like BanCheck for a handler function.
+func (shim *Shimmie) BanCheckFunc(fn http.HandlerFunc) http.Handler {
+	return shim.BanCheck(fn)
+}
@@ -0,0 +1,239 @@
+package shimmie_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/kusubooru/shimmie"
+	"github.com/kusubooru/shimmie/shimmietest"
+)
+
+func TestNormalizeIPBan(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		err  bool
+	}{
+		{in: "10.0.0.1", want: "10.0.0.1"},
+		{in: " 10.0.0.1 ", want: "10.0.0.1"},
+		{in: "10.1.2.3/8", want: "10.0.0.0/8"},
+		{in: "10.0.0.1/32", want: "10.0.0.1"},
+		{in: "2001:DB8::1", want: "2001:db8::1"},
+		{in: "2001:db8::1/32", want: "2001:db8::/32"},
+		{in: "10.0.0", err: true},
+		{in: "10.0.0.1/33", err: true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeIPBan(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("NormalizeIPBan(%q) err = %v, want error %v", tt.in, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizeIPBan(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestIPBanList(t *testing.T) {
+	ctx := context.Background()
+	store := shimmietest.New()
+	if err := store.CreateUser(ctx, &User{Name: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	soon := time.Now().Add(50 * time.Millisecond)
+	for _, b := range []IPBan{
+		{IP: "10.0.0.1", Reason: "spam"},
+		{IP: "192.168.0.0/16", Reason: "range"},
+		{IP: "192.168.5.0/24", Reason: "soon", Expires: &soon},
+		{IP: "2001:db8::/32", Reason: "v6"},
+	} {
+		b.BannerID = 1
+		if err := store.AddIPBan(ctx, &b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list := NewIPBanList(store)
+	if b := list.Lookup("10.0.0.1"); b != nil {
+		t.Errorf("Lookup before Refresh = %+v, want nil", b)
+	}
+	if err := list.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		ip     string
+		reason string
+	}{
+		{"10.0.0.1", "spam"},
+		{"10.0.0.2", ""},
+		{"::ffff:10.0.0.1", "spam"},
+		{"192.168.200.1", "range"},
+		{"192.169.0.1", ""},
+		{"2001:db8:1::5", "v6"},
+		{"2001:db9::5", ""},
+		{"garbage", ""},
+	}
+	for _, tt := range tests {
+		var reason string
+		if b := list.Lookup(tt.ip); b != nil {
+			reason = b.Reason
+		}
+		if reason != tt.reason {
+			t.Errorf("Lookup(%q) reason = %q, want %q", tt.ip, reason, tt.reason)
+		}
+	}
+	// The address is in two banned ranges.
+	if b := list.Lookup("192.168.5.5"); b == nil {
+		t.Errorf("Lookup(%q) = nil, want a ban", "192.168.5.5")
+	}
+
+	// Expired bans are ignored without a refresh.
+	time.Sleep(time.Until(soon))
+	if err := store.AddIPBan(ctx, &IPBan{IP: "10.9.9.9", BannerID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if b := list.Lookup("192.168.5.5"); b == nil || b.Reason != "range" {
+		t.Errorf("Lookup(%q) after expiry = %+v, want the range ban", "192.168.5.5", b)
+	}
+	if b := list.Lookup("10.9.9.9"); b != nil {
+		t.Errorf("Lookup(%q) before refresh = %+v, want nil", "10.9.9.9", b)
+	}
+
+	pctx, cancel := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() { done <- list.Poll(pctx, 10*time.Millisecond, nil) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for list.Lookup("10.9.9.9") == nil && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Poll returned %v, want %v", err, context.Canceled)
+	}
+	if list.Lookup("10.9.9.9") == nil {
+		t.Errorf("Lookup(%q) after Poll = nil, want a ban", "10.9.9.9")
+	}
+}
+
+// flakyIPBanStore fails the first fails calls to ActiveIPBans.
+type flakyIPBanStore struct {
+	IPBanStore
+	mu    sync.Mutex
+	fails int
+}
+
+func (s *flakyIPBanStore) ActiveIPBans(ctx context.Context) ([]IPBan, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fails > 0 {
+		s.fails--
+		return nil, errors.New("database is down")
+	}
+	return s.IPBanStore.ActiveIPBans(ctx)
+}
+
+func TestIPBanListPollError(t *testing.T) {
+	ctx := context.Background()
+	mem := shimmietest.New()
+	if err := mem.CreateUser(ctx, &User{Name: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := mem.AddIPBan(ctx, &IPBan{IP: "10.0.0.1", BannerID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	store := &flakyIPBanStore{IPBanStore: mem}
+	list := NewIPBanList(store)
+	if err := list.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	store.mu.Lock()
+	store.fails = 2
+	store.mu.Unlock()
+
+	pctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make(chan error, 10)
+	done := make(chan error)
+	go func() { done <- list.Poll(pctx, 10*time.Millisecond, func(err error) { errs <- err }) }()
+
+	// The loaded bans are kept while refreshing fails and polling goes on.
+	deadline := time.After(5 * time.Second)
+	for n := 0; n < 2; n++ {
+		select {
+		case <-errs:
+		case <-deadline:
+			t.Fatalf("onError was called %d times, want 2", n)
+		}
+	}
+	if list.Lookup("10.0.0.1") == nil {
+		t.Errorf("Lookup(%q) after failed refreshes = nil, want a ban", "10.0.0.1")
+	}
+	if err := mem.AddIPBan(ctx, &IPBan{IP: "10.0.0.2", BannerID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	until := time.Now().Add(5 * time.Second)
+	for list.Lookup("10.0.0.2") == nil && time.Now().Before(until) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if list.Lookup("10.0.0.2") == nil {
+		t.Errorf("Lookup(%q) after failed refreshes = nil, want a ban", "10.0.0.2")
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Poll returned %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestBanCheck(t *testing.T) {
+	ctx := context.Background()
+	store := shimmietest.New()
+	if err := store.CreateUser(ctx, &User{Name: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, ip := range []string{"10.0.0.0/8", "2001:db8::/32"} {
+		if err := store.AddIPBan(ctx, &IPBan{IP: ip, Reason: "flooding", BannerID: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	shim := &Shimmie{IPBans: NewIPBanList(store)}
+	if err := shim.IPBans.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	h := shim.BanCheckFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+
+	tests := []struct {
+		remoteAddr   string
+		forwardedFor string
+		code         int
+		bodyContains string
+	}{
+		{"10.1.2.3:1234", "", http.StatusForbidden, "flooding"},
+		{"11.1.2.3:1234", "", http.StatusOK, "ok"},
+		{"127.0.0.1:1234", "10.5.5.5", http.StatusForbidden, "IP 10.5.5.5 has been banned forever because of flooding"},
+		{"127.0.0.1:1234", "11.5.5.5", http.StatusOK, "ok"},
+		{"127.0.0.1:1234", " 10.5.5.5 , 11.5.5.5", http.StatusForbidden, "flooding"},
+		{"[2001:db8::1]:443", "", http.StatusForbidden, "flooding"},
+		{"[2001:db9::1]:443", "", http.StatusOK, "ok"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remoteAddr
+		if tt.forwardedFor != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwardedFor)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.code || !strings.Contains(w.Body.String(), tt.bodyContains) {
+			t.Errorf("request from %q (%q) = %d %q, want %d containing %q", tt.remoteAddr, tt.forwardedFor, w.Code, w.Body.String(), tt.code, tt.bodyContains)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package shimmie
+
+import (
+	"context"
+	"database/sql"
+	"image"
+	"math"
+	"math/bits"
+	"os"
+	"sort"
+	"sync"
+
+	"golang.org/x/image/draw"
+)
+
+// ImagePHash is the perceptual hash of an image.
+type ImagePHash struct {
+	ImageID int64
+	PHash   uint64
+}
+
+// SimilarImage is an image found by a PHashIndex along with the distance of
+// its perceptual hash.
+type SimilarImage struct {
+	ImageID  int64
+	Distance int
+}
+
+// PerceptualHash returns the pHash of img. The image is reduced to 32x32
+// grayscale and each bit of the hash tells whether one of the 64 lowest
+// frequencies of its discrete cosine transform is above their median.
+// Resized or re-encoded copies of an image get hashes that differ in a few
+// bits only.
+func PerceptualHash(img image.Image) uint64 {
+	const size, low = 32, 8
+	gray := image.NewGray(image.Rect(0, 0, size, size))
+	draw.ApproxBiLinear.Scale(gray, gray.Bounds(), img, img.Bounds(), draw.Src, nil)
+
+	var pixels [size][size]float64
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			pixels[y][x] = float64(gray.GrayAt(x, y).Y)
+		}
+	}
+	var cos [low][size]float64
+	for u := 0; u < low; u++ {
+		for x := 0; x < size; x++ {
+			cos[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / (2 * size))
+		}
+	}
+	// Only the low frequencies of the transform are needed.
+	var rows [size][low]float64
+	for y := 0; y < size; y++ {
+		for u := 0; u < low; u++ {
+			var sum float64
+			for x := 0; x < size; x++ {
+				sum += pixels[y][x] * cos[u][x]
+			}
+			rows[y][u] = sum
+		}
+	}
+	coefs := make([]float64, 0, low*low)
+	for v := 0; v < low; v++ {
+		for u := 0; u < low; u++ {
+			var sum float64
+			for y := 0; y < size; y++ {
+				sum += rows[y][u] * cos[v][y]
+			}
+			coefs = append(coefs, sum)
+		}
+	}
+
+	// The first coefficient is the average brightness and is left out of
+	// the median so that it does not skew it.
+	sorted := append([]float64(nil), coefs[1:]...)
+	sort.Float64s(sorted)
+	median := (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+	var hash uint64
+	for i, c := range coefs {
+		if c > median {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash
+}
+
+// HammingDistance returns the number of bits that differ between two
+// perceptual hashes.
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// ImagePHash returns the perceptual hash of the file of the image with the
+// given hash.
+func (shim *Shimmie) ImagePHash(hash string) (uint64, error) {
+	f, err := os.Open(shim.ImageFile(hash))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return 0, err
+	}
+	return PerceptualHash(img), nil
+}
+
+// IndexImage computes the perceptual hash of an image, saves it in store and
+// adds it to shim.PHashes, if set. ImageStore.CreateImage only stores the
+// row of an image and its file is written by the caller, so callers must
+// call IndexImage once both exist for the image to be found as a duplicate.
+func (shim *Shimmie) IndexImage(ctx context.Context, store PHashStore, img Image) (uint64, error) {
+	phash, err := shim.ImagePHash(img.Hash)
+	if err != nil {
+		return 0, err
+	}
+	if err := store.SetImagePHash(ctx, img.ID, phash); err != nil {
+		return 0, err
+	}
+	if shim.PHashes != nil {
+		shim.PHashes.Add(img.ID, phash)
+	}
+	return phash, nil
+}
+
+// BackfillPHashes computes the perceptual hashes of the images that do not
+// have one yet, with the same progress and resume behavior as
+// RegenerateThumbs.
+func (shim *Shimmie) BackfillPHashes(ctx context.Context, images ImageStore, phashes PHashStore, opts BatchOptions) (ImageProgress, error) {
+	return forEachImage(ctx, images, opts, func(img Image) error {
+		_, err := phashes.GetImagePHash(ctx, img.ID)
+		if err == nil {
+			return nil
+		}
+		if err != sql.ErrNoRows {
+			return err
+		}
+		_, err = shim.IndexImage(ctx, phashes, img)
+		return err
+	})
+}
+
+// PHashIndex finds images with similar perceptual hashes. It keeps the
+// hashes in a BK-tree so that a search only visits the hashes that can be
+// within the distance. It is safe for concurrent use.
+type PHashIndex struct {
+	mu     sync.RWMutex
+	root   *bkNode
+	hashes map[int64]uint64
+}
+
+// bkNode holds the images with the same hash and the children whose hashes
+// are at each distance from it.
+type bkNode struct {
+	phash    uint64
+	images   []int64
+	children map[int]*bkNode
+}
+
+// NewPHashIndex returns an empty index.
+func NewPHashIndex() *PHashIndex {
+	return &PHashIndex{hashes: make(map[int64]uint64)}
+}
+
+// LoadPHashIndex returns an index of all the perceptual hashes of store.
+func LoadPHashIndex(ctx context.Context, store PHashStore) (*PHashIndex, error) {
+	x := NewPHashIndex()
+	var cursor string
+	for {
+		phashes, next, err := store.ListImagePHashes(ctx, 1000, cursor)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range phashes {
+			x.Add(p.ImageID, p.PHash)
+		}
+		if next == "" {
+			return x, nil
+		}
+		cursor = next
+	}
+}
+
+// Len returns the number of indexed images.
+func (x *PHashIndex) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.hashes)
+}
+
+// Add indexes the perceptual hash of an image, replacing its previous one.
+func (x *PHashIndex) Add(imageID int64, phash uint64) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if old, ok := x.hashes[imageID]; ok {
+		if old == phash {
+			return
+		}
+		x.remove(imageID, old)
+	}
+	x.hashes[imageID] = phash
+
+	if x.root == nil {
+		x.root = &bkNode{phash: phash, images: []int64{imageID}}
+		return
+	}
+	n := x.root
+	for {
+		d := HammingDistance(n.phash, phash)
+		if d == 0 {
+			n.images = append(n.images, imageID)
+			return
+		}
+		child, ok := n.children[d]
+		if !ok {
+			if n.children == nil {
+				n.children = make(map[int]*bkNode)
+			}
+			n.children[d] = &bkNode{phash: phash, images: []int64{imageID}}
+			return
+		}
+		n = child
+	}
+}
+
+// Remove removes an image from the index.
+func (x *PHashIndex) Remove(imageID int64) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if phash, ok := x.hashes[imageID]; ok {
+		x.remove(imageID, phash)
+		delete(x.hashes, imageID)
+	}
+}
+
+// remove takes imageID out of the node of phash. The node is kept, even if
+// empty, since it links its children to the tree.
+func (x *PHashIndex) remove(imageID int64, phash uint64) {
+	n := x.root
+	for n != nil {
+		d := HammingDistance(n.phash, phash)
+		if d == 0 {
+			for i, id := range n.images {
+				if id == imageID {
+					n.images = append(n.images[:i], n.images[i+1:]...)
+					break
+				}
+			}
+			return
+		}
+		n = n.children[d]
+	}
+}
+
+// Search returns the indexed images whose perceptual hash is within
+// maxDistance of phash, closest first and then by ID.
+func (x *PHashIndex) Search(phash uint64, maxDistance int) []SimilarImage {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	var found []SimilarImage
+	stack := []*bkNode{}
+	if x.root != nil {
+		stack = append(stack, x.root)
+	}
+	for len(stack) != 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		d := HammingDistance(n.phash, phash)
+		if d <= maxDistance {
+			for _, id := range n.images {
+				found = append(found, SimilarImage{ImageID: id, Distance: d})
+			}
+		}
+		// By the triangle inequality only the children at a distance
+		// within maxDistance of d can hold matches.
+		for cd, child := range n.children {
+			if cd >= d-maxDistance && cd <= d+maxDistance {
+				stack = append(stack, child)
+			}
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].Distance != found[j].Distance {
+			return found[i].Distance < found[j].Distance
+		}
+		return found[i].ImageID < found[j].ImageID
+	})
+	return found
+}
+
+// FindSimilar returns the images whose perceptual hash is within
+// maxDistance of the hash of imageID, leaving out imageID itself. It
+// returns ErrNotFound if imageID is not indexed.
+func (x *PHashIndex) FindSimilar(imageID int64, maxDistance int) ([]SimilarImage, error) {
+	x.mu.RLock()
+	phash, ok := x.hashes[imageID]
+	x.mu.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	found := x.Search(phash, maxDistance)
+	for i, s := range found {
+		if s.ImageID == imageID {
+			found = append(found[:i], found[i+1:]...)
+			break
+		}
+	}
+	return found, nil
+}
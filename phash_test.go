@@ -0,0 +1,175 @@
+package shimmie_test
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	. "github.com/kusubooru/shimmie"
+	"github.com/kusubooru/shimmie/shimmietest"
+	"golang.org/x/image/draw"
+)
+
+// gradient returns an image with a diagonal gradient and a dark square.
+func gradient(width, height int, flip bool) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := uint8(255 * (x + y) / (width + height))
+			if flip {
+				v = 255 - v
+			}
+			if x > width/4 && x < width/2 && y > height/4 && y < height/2 {
+				v /= 4
+			}
+			img.Set(x, y, color.RGBA{v, v, v, 255})
+		}
+	}
+	return img
+}
+
+func TestPerceptualHash(t *testing.T) {
+	orig := gradient(400, 300, false)
+	small := image.NewRGBA(image.Rect(0, 0, 120, 90))
+	draw.BiLinear.Scale(small, small.Bounds(), orig, orig.Bounds(), draw.Src, nil)
+	other := gradient(400, 300, true)
+
+	h := PerceptualHash(orig)
+	if d := HammingDistance(h, PerceptualHash(small)); d > 4 {
+		t.Errorf("distance to resized copy = %d, want at most 4", d)
+	}
+	if d := HammingDistance(h, PerceptualHash(other)); d < 16 {
+		t.Errorf("distance to different image = %d, want at least 16", d)
+	}
+}
+
+func TestPHashIndex(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	x := NewPHashIndex()
+	hashes := make(map[int64]uint64)
+	for id := int64(1); id <= 2000; id++ {
+		phash := r.Uint64()
+		// Make some near duplicates of earlier images.
+		if id > 1 && id%10 == 0 {
+			phash = hashes[id-1] ^ (1 << uint(r.Intn(64)))
+		}
+		hashes[id] = phash
+		x.Add(id, phash)
+	}
+	// Replacing a hash must move the image.
+	hashes[5] = hashes[7] ^ 3
+	x.Add(5, hashes[5])
+	x.Remove(8)
+	delete(hashes, 8)
+	if got, want := x.Len(), len(hashes); got != want {
+		t.Errorf("Len() = %d, want %d", got, want)
+	}
+
+	for _, id := range []int64{5, 7, 9, 10, 500} {
+		for _, maxDistance := range []int{0, 2, 20} {
+			got, err := x.FindSimilar(id, maxDistance)
+			if err != nil {
+				t.Fatalf("FindSimilar(%d) failed: %v", id, err)
+			}
+			var want []SimilarImage
+			for other, phash := range hashes {
+				if d := HammingDistance(hashes[id], phash); other != id && d <= maxDistance {
+					want = append(want, SimilarImage{ImageID: other, Distance: d})
+				}
+			}
+			sort.Slice(want, func(i, j int) bool {
+				if want[i].Distance != want[j].Distance {
+					return want[i].Distance < want[j].Distance
+				}
+				return want[i].ImageID < want[j].ImageID
+			})
+			if len(got) != 0 || len(want) != 0 {
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("FindSimilar(%d, %d) = %v, want %v", id, maxDistance, got, want)
+				}
+			}
+		}
+	}
+	if _, err := x.FindSimilar(8, 2); err != ErrNotFound {
+		t.Errorf("FindSimilar(removed) err = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestIndexImage(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	shim := &Shimmie{ImagePath: filepath.Join(dir, "images"), PHashes: NewPHashIndex()}
+	store := shimmietest.New()
+	if err := store.CreateUser(ctx, &User{Name: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	img := Image{OwnerID: 1, Hash: "aa01"}
+	id, err := store.CreateImage(ctx, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img.ID = id
+	writeImage(t, shim, img.Hash, 64, 64)
+
+	phash, err := shim.IndexImage(ctx, store, img)
+	if err != nil {
+		t.Fatalf("IndexImage() failed: %v", err)
+	}
+	if got, err := store.GetImagePHash(ctx, id); err != nil || got != phash {
+		t.Errorf("GetImagePHash() = %x, %v, want %x", got, err, phash)
+	}
+	if found := shim.PHashes.Search(phash, 0); len(found) != 1 || found[0].ImageID != id {
+		t.Errorf("index search after IndexImage() = %v, want image %d", found, id)
+	}
+}
+
+func TestBackfillPHashes(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	shim := &Shimmie{ImagePath: filepath.Join(dir, "images"), ThumbPath: filepath.Join(dir, "thumbs")}
+	store := shimmietest.New()
+	if err := store.CreateUser(ctx, &User{Name: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, hash := range []string{"aa01", "ab02", "ac03"} {
+		if _, err := store.CreateImage(ctx, Image{OwnerID: 1, Hash: hash}); err != nil {
+			t.Fatal(err)
+		}
+		writeImage(t, shim, hash, 64, 64)
+	}
+	// An image that was indexed at ingest keeps its hash.
+	if err := store.SetImagePHash(ctx, 1, 42); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := shim.BackfillPHashes(ctx, store, store, BatchOptions{Workers: 2})
+	if err != nil {
+		t.Fatalf("BackfillPHashes() failed: %v", err)
+	}
+	if p.Done != 3 || p.Failed != 0 {
+		t.Errorf("BackfillPHashes() progress = %+v, want 3 done", p)
+	}
+	x, err := LoadPHashIndex(ctx, store)
+	if err != nil {
+		t.Fatalf("LoadPHashIndex() failed: %v", err)
+	}
+	if x.Len() != 3 {
+		t.Errorf("index has %d images, want 3", x.Len())
+	}
+	if got, _ := store.GetImagePHash(ctx, 1); got != 42 {
+		t.Errorf("backfill replaced the hash of image 1 with %x", got)
+	}
+	// Images 2 and 3 have the same file.
+	similar, err := x.FindSimilar(2, 0)
+	if err != nil {
+		t.Fatalf("FindSimilar() failed: %v", err)
+	}
+	if want := []SimilarImage{{ImageID: 3}}; !reflect.DeepEqual(similar, want) {
+		t.Errorf("FindSimilar(2, 0) = %v, want %v", similar, want)
+	}
+}
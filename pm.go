@@ -0,0 +1,59 @@
+package shimmie
+
+import (
+	"errors"
+	"regexp"
+	"time"
+	"unicode/utf8"
+)
+
+// Limits of private messages. The subject and message lengths match the
+// private_message table, where subject is a VARCHAR(64) and message is a
+// TEXT of at most 65535 bytes.
+const (
+	MaxPMSubjectLength = 64
+	MaxPMMessageLength = 65535
+)
+
+// MaxPMLinks is the number of links above which a private message is flagged
+// for review. A negative value turns flagging off.
+var MaxPMLinks = 3
+
+// Errors returned by SendPM when a private message is rejected.
+var (
+	ErrPMSubjectTooLong = errors.New("private message subject is too long")
+	ErrPMMessageTooLong = errors.New("private message is too long")
+	ErrPMBlocked        = errors.New("sender is blocked by the recipient")
+	ErrPMRateLimited    = errors.New("sender has sent too many private messages")
+)
+
+// PMRateLimit is the number of private messages that a user is allowed to
+// send within Period. A zero or negative Messages means no limit.
+type PMRateLimit struct {
+	Messages int           `json:"messages"`
+	Period   time.Duration `json:"period"`
+}
+
+// DefaultPMRateLimit applies to the users that have no rate limit of their
+// own.
+var DefaultPMRateLimit = PMRateLimit{Messages: 10, Period: time.Hour}
+
+var linkRegexp = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s\[\]<>"]+`)
+
+// CountLinks returns the number of links in text.
+func CountLinks(text string) int {
+	return len(linkRegexp.FindAllStringIndex(text, -1))
+}
+
+// CheckPM returns an error if the subject or message of pm do not fit the
+// database and flags pm for review if it contains more than MaxPMLinks links.
+func CheckPM(pm *PM) error {
+	if utf8.RuneCountInString(pm.Subject) > MaxPMSubjectLength {
+		return ErrPMSubjectTooLong
+	}
+	if len(pm.Message) > MaxPMMessageLength {
+		return ErrPMMessageTooLong
+	}
+	pm.Flagged = MaxPMLinks >= 0 && CountLinks(pm.Subject)+CountLinks(pm.Message) > MaxPMLinks
+	return nil
+}
@@ -0,0 +1,71 @@
+package shimmie_test
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/kusubooru/shimmie"
+)
+
+func TestCountLinks(t *testing.T) {
+	var tests = []struct {
+		in   string
+		want int
+	}{
+		{"no links here", 0},
+		{"see https://www.example.com/a?b=c", 1},
+		{"http://a.com and www.b.com, HTTPS://C.COM", 3},
+		{"[url=http://a.com]a[/url] [url]http://b.com[/url]", 2},
+	}
+	for _, tt := range tests {
+		if got := CountLinks(tt.in); got != tt.want {
+			t.Errorf("CountLinks(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCheckPM(t *testing.T) {
+	var tests = []struct {
+		pm      PM
+		err     error
+		flagged bool
+	}{
+		{PM{Subject: "hi", Message: "hello"}, nil, false},
+		{PM{Subject: strings.Repeat("ä", 64)}, nil, false},
+		{PM{Subject: strings.Repeat("a", 65)}, ErrPMSubjectTooLong, false},
+		{PM{Message: strings.Repeat("a", 65536)}, ErrPMMessageTooLong, false},
+		{PM{Message: "a.com www.b.com www.c.com www.d.com"}, nil, false},
+		{PM{Subject: "www.a.com", Message: "www.b.com www.c.com www.d.com"}, nil, true},
+	}
+	for _, tt := range tests {
+		pm := tt.pm
+		if err := CheckPM(&pm); err != tt.err {
+			t.Errorf("CheckPM(%.20q) returned err %v, want %v", pm.Subject+pm.Message, err, tt.err)
+		}
+		if pm.Flagged != tt.flagged {
+			t.Errorf("CheckPM(%.20q) flagged = %t, want %t", pm.Subject+pm.Message, pm.Flagged, tt.flagged)
+		}
+	}
+}
+
+func TestCheckPMMaxLinks(t *testing.T) {
+	defer func(n int) { MaxPMLinks = n }(MaxPMLinks)
+
+	for _, tt := range []struct {
+		max     int
+		flagged bool
+	}{
+		{0, true},
+		{1, false},
+		{-1, false},
+	} {
+		MaxPMLinks = tt.max
+		pm := PM{Message: "see www.a.com"}
+		if err := CheckPM(&pm); err != nil {
+			t.Fatalf("CheckPM returned err: %v", err)
+		}
+		if pm.Flagged != tt.flagged {
+			t.Errorf("CheckPM with MaxPMLinks %d flagged = %t, want %t", tt.max, pm.Flagged, tt.flagged)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package shimmie
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Errors returned when creating or editing pools.
+var (
+	ErrPoolTitleEmpty = errors.New("pool title is empty")
+	ErrPoolTitleTaken = errors.New("pool title is already taken")
+)
+
+// Pool is an ordered collection of images, like the pages of a comic, that
+// is stored in the table "pools" of the Shimmie pools extension. Posts is
+// the number of images in the pool.
+type Pool struct {
+	ID          int64
+	UserID      int64
+	UserName    string
+	Public      bool
+	Title       string
+	Description string
+	Date        time.Time
+	Posts       int
+	LastUpdated time.Time
+}
+
+// PoolAction is the action of a PoolHistory entry. The values are the ones
+// stored by Shimmie.
+type PoolAction int
+
+// Possible pool actions.
+const (
+	PoolRemove PoolAction = 0
+	PoolAdd    PoolAction = 1
+)
+
+// PoolHistory records images being added to or removed from a pool. Count
+// is the number of images in the pool after the change.
+type PoolHistory struct {
+	ID       int64
+	PoolID   int64
+	UserID   int64
+	UserName string
+	Action   PoolAction
+	Images   []int64
+	Count    int
+	Date     time.Time
+}
+
+// FormatPoolImages returns the images of a pool history entry in the space
+// separated form of the images column.
+func FormatPoolImages(ids []int64) string {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(s, " ")
+}
+
+// ParsePoolImages parses the images column of a pool history entry. Values
+// that are not image IDs are skipped.
+func ParsePoolImages(s string) []int64 {
+	var ids []int64
+	for _, f := range strings.Fields(s) {
+		if id, err := strconv.ParseInt(strings.TrimPrefix(f, "#"), 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// ReorderPool returns the images of a pool, given in their current order,
+// after moving ids to the start of the pool in the given order. It returns
+// sql.ErrNoRows if one of ids is not in the pool.
+func ReorderPool(images, ids []int64) ([]int64, error) {
+	in := make(map[int64]bool, len(images))
+	for _, id := range images {
+		in[id] = true
+	}
+	moved := make(map[int64]bool, len(ids))
+	order := make([]int64, 0, len(images))
+	for _, id := range ids {
+		if !in[id] {
+			return nil, sql.ErrNoRows
+		}
+		if !moved[id] {
+			moved[id] = true
+			order = append(order, id)
+		}
+	}
+	for _, id := range images {
+		if !moved[id] {
+			order = append(order, id)
+		}
+	}
+	return order, nil
+}
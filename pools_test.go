@@ -0,0 +1,48 @@
+package shimmie_test
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	. "github.com/kusubooru/shimmie"
+)
+
+func TestPoolImagesFormat(t *testing.T) {
+	ids := []int64{3, 14, 15}
+	s := FormatPoolImages(ids)
+	if s != "3 14 15" {
+		t.Errorf("FormatPoolImages(%v) = %q, want %q", ids, s, "3 14 15")
+	}
+	if got := ParsePoolImages(s); fmt.Sprint(got) != fmt.Sprint(ids) {
+		t.Errorf("ParsePoolImages(%q) = %v, want %v", s, got, ids)
+	}
+	// Older Shimmie versions wrote the images as #id.
+	if got, want := ParsePoolImages(" #3 #14 x 15 "), ids; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("ParsePoolImages(old format) = %v, want %v", got, want)
+	}
+}
+
+func TestReorderPool(t *testing.T) {
+	images := []int64{1, 2, 3, 4, 5}
+	tests := []struct {
+		ids  []int64
+		want []int64
+		err  error
+	}{
+		{nil, []int64{1, 2, 3, 4, 5}, nil},
+		{[]int64{5, 3}, []int64{5, 3, 1, 2, 4}, nil},
+		{[]int64{2, 2, 1}, []int64{2, 1, 3, 4, 5}, nil},
+		{[]int64{2, 9}, nil, sql.ErrNoRows},
+	}
+	for _, tt := range tests {
+		got, err := ReorderPool(images, tt.ids)
+		if err != tt.err {
+			t.Errorf("ReorderPool(%v) err = %v, want %v", tt.ids, err, tt.err)
+			continue
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("ReorderPool(%v) = %v, want %v", tt.ids, got, tt.want)
+		}
+	}
+}
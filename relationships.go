@@ -0,0 +1,22 @@
+package shimmie
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrParentCycle is returned when an image would become the parent of one
+// of its ancestors or of itself.
+var ErrParentCycle = errors.New("image cannot be the parent of its ancestor")
+
+// SetParentLogMessage returns the score_log message of setting the parent
+// of an image, which is logged in the "relationships" section.
+func SetParentLogMessage(childID, parentID int64) string {
+	return fmt.Sprintf("Set parent of Image #%d to Image #%d", childID, parentID)
+}
+
+// RemoveParentLogMessage returns the score_log message of removing the
+// parent of an image, which is logged in the "relationships" section.
+func RemoveParentLogMessage(childID, parentID int64) string {
+	return fmt.Sprintf("Removed parent Image #%d of Image #%d", parentID, childID)
+}
@@ -0,0 +1,51 @@
+package shimmie
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrInvalidVote is returned for a numeric score vote other than -1, 0 or 1.
+var ErrInvalidVote = errors.New("vote must be -1, 0 or 1")
+
+// ValidVote reports whether score is a valid numeric score vote.
+func ValidVote(score int) bool {
+	return score >= -1 && score <= 1
+}
+
+// ScorePeriod is the period of a leaderboard of top images.
+type ScorePeriod int
+
+// Possible score periods.
+const (
+	ScoreAllTime ScorePeriod = iota
+	ScoreThisWeek
+	ScoreThisMonth
+)
+
+// Since returns the start of the period that contains now, which is the
+// zero time for ScoreAllTime. Weeks start on Monday. The result can be
+// passed to ScoreStore.TopImages.
+func (p ScorePeriod) Since(now time.Time) time.Time {
+	y, m, d := now.Date()
+	switch p {
+	case ScoreThisWeek:
+		// time.Sunday is 0, so Sunday goes back 6 days.
+		back := (int(now.Weekday()) + 6) % 7
+		return time.Date(y, m, d-back, 0, 0, 0, 0, now.Location())
+	case ScoreThisMonth:
+		return time.Date(y, m, 1, 0, 0, 0, 0, now.Location())
+	}
+	return time.Time{}
+}
+
+// String returns the name of the period.
+func (p ScorePeriod) String() string {
+	switch p {
+	case ScoreThisWeek:
+		return "week"
+	case ScoreThisMonth:
+		return "month"
+	}
+	return "all time"
+}
@@ -0,0 +1,38 @@
+package shimmie_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/kusubooru/shimmie"
+)
+
+func TestScorePeriodSince(t *testing.T) {
+	loc := time.FixedZone("test", 2*60*60)
+	tests := []struct {
+		period ScorePeriod
+		now    time.Time
+		want   time.Time
+	}{
+		{ScoreAllTime, time.Date(2024, 5, 15, 10, 0, 0, 0, loc), time.Time{}},
+		// 2024-05-15 is a Wednesday.
+		{ScoreThisWeek, time.Date(2024, 5, 15, 10, 0, 0, 0, loc), time.Date(2024, 5, 13, 0, 0, 0, 0, loc)},
+		{ScoreThisWeek, time.Date(2024, 5, 13, 0, 0, 0, 0, loc), time.Date(2024, 5, 13, 0, 0, 0, 0, loc)},
+		{ScoreThisWeek, time.Date(2024, 5, 19, 23, 0, 0, 0, loc), time.Date(2024, 5, 13, 0, 0, 0, 0, loc)},
+		{ScoreThisWeek, time.Date(2024, 6, 2, 12, 0, 0, 0, loc), time.Date(2024, 5, 27, 0, 0, 0, 0, loc)},
+		{ScoreThisMonth, time.Date(2024, 5, 15, 10, 0, 0, 0, loc), time.Date(2024, 5, 1, 0, 0, 0, 0, loc)},
+	}
+	for _, tt := range tests {
+		if got := tt.period.Since(tt.now); !got.Equal(tt.want) {
+			t.Errorf("%v.Since(%v) = %v, want %v", tt.period, tt.now, got, tt.want)
+		}
+	}
+}
+
+func TestValidVote(t *testing.T) {
+	for score, want := range map[int]bool{-2: false, -1: true, 0: true, 1: true, 2: false} {
+		if got := ValidVote(score); got != want {
+			t.Errorf("ValidVote(%d) = %v, want %v", score, got, want)
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package shimmie
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"net"
 	"strings"
 	"time"
 )
@@ -40,7 +43,7 @@ func ImageRating(rating string) string {
 
 // UserGetter represents a type that can get users from the db.
 type UserGetter interface {
-	GetUserByName(username string) (*User, error)
+	GetUserByName(ctx context.Context, username string) (*User, error)
 }
 
 // Shimmie represents an installed shimmie2 project.
@@ -48,6 +51,11 @@ type Shimmie struct {
 	ImagePath string
 	ThumbPath string
 	User      UserGetter
+	// IPBans is used by BanCheck to reject the requests of banned
+	// addresses.
+	IPBans *IPBanList
+	// PHashes, if set, is kept up to date by IndexImage.
+	PHashes *PHashIndex
 }
 
 // SCoreLog represents a log message in the shimmie log that is stored in the
@@ -62,6 +70,45 @@ type SCoreLog struct {
 	Message  string
 }
 
+// Priorities of the entries of the shimmie log. They match the SCORE_LOG_*
+// constants of Shimmie.
+const (
+	PriorityDebug    = 10
+	PriorityInfo     = 20
+	PriorityWarning  = 30
+	PriorityError    = 40
+	PriorityCritical = 50
+)
+
+// LogFilter narrows down the entries of the shimmie log. Fields that are left
+// empty are ignored.
+type LogFilter struct {
+	Section  string
+	Username string
+	// Address is either an IP address or a CIDR range like 10.0.0.0/8.
+	Address string
+	// MinPriority keeps the entries with at least this priority.
+	MinPriority int
+	// After and Before limit the entries to the ones sent in [After, Before).
+	After  *time.Time
+	Before *time.Time
+	// Message keeps the entries whose message contains it, ignoring case.
+	Message string
+}
+
+// Network returns the network of a CIDR Address or nil if Address is a
+// single address.
+func (f LogFilter) Network() (*net.IPNet, error) {
+	if !strings.Contains(f.Address, "/") {
+		return nil, nil
+	}
+	_, network, err := net.ParseCIDR(f.Address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log address filter: %v", err)
+	}
+	return network, nil
+}
+
 // RatedImage represents a shimmie image that also carries information about
 // who rated it and when.
 type RatedImage struct {
@@ -100,6 +147,31 @@ type Image struct {
 	Notes        int
 }
 
+// ImageOrder chooses the key used to order and paginate an image listing.
+// Images are always listed in descending order of the key and then by
+// descending ID for equal keys.
+type ImageOrder int
+
+// Possible image orders.
+const (
+	ImageOrderID ImageOrder = iota
+	ImageOrderPosted
+	ImageOrderScore
+)
+
+// ImageFilter narrows down the images of an image listing. Fields that are
+// left empty are ignored.
+type ImageFilter struct {
+	OwnerID int64
+	Rating  string
+	Ext     string
+	// PostedAfter and PostedBefore limit the listing to images posted in
+	// [PostedAfter, PostedBefore).
+	PostedAfter  *time.Time
+	PostedBefore *time.Time
+	Order        ImageOrder
+}
+
 // User represents a shimmie user.
 type User struct {
 	ID       int64
@@ -193,6 +265,61 @@ type PM struct {
 	Subject  string    `json:"subject"`
 	Message  string    `json:"message"`
 	IsRead   bool      `json:"is_read"`
+	ParentID int64     `json:"parent_id,omitempty"`
+	Flagged  bool      `json:"flagged,omitempty"`
+}
+
+// PMInbox summarizes the private messages that a user has received.
+type PMInbox struct {
+	Total   int               `json:"total"`
+	Unread  int               `json:"unread"`
+	Senders []PMSenderSummary `json:"senders"`
+}
+
+// PMSenderSummary summarizes the private messages that a user has received
+// from one sender along with a preview of the latest of them.
+type PMSenderSummary struct {
+	FromID     int64     `json:"from_id"`
+	FromUser   string    `json:"from_user"`
+	Total      int       `json:"total"`
+	Unread     int       `json:"unread"`
+	LatestID   int64     `json:"latest_id"`
+	LatestDate time.Time `json:"latest_date"`
+	Subject    string    `json:"subject"`
+	Preview    string    `json:"preview"`
+}
+
+// pmPreviewLength is the maximum number of characters of a PM preview.
+const pmPreviewLength = 100
+
+// PMPreview returns the beginning of a private message, with its whitespace
+// collapsed, to be shown in an inbox.
+func PMPreview(message string) string {
+	preview := strings.Join(strings.Fields(message), " ")
+	if r := []rune(preview); len(r) > pmPreviewLength {
+		preview = string(r[:pmPreviewLength-1]) + "…"
+	}
+	return preview
+}
+
+// ReplySubject returns the subject of a reply to a private message with the
+// given subject. It adds the "Re: " prefix once and keeps the result within
+// the 64 characters allowed by the database.
+func ReplySubject(subject string) string {
+	if !strings.HasPrefix(subject, "Re: ") {
+		subject = "Re: " + subject
+	}
+	if r := []rune(subject); len(r) > 64 {
+		subject = string(r[:64])
+	}
+	return subject
+}
+
+// ImageScore holds an image along with a score, like the number of
+// favorites it got in a period.
+type ImageScore struct {
+	Score int   `json:"score"`
+	Image Image `json:"image"`
 }
 
 // UserScore can be used to hold user scores like who has uploaded the most
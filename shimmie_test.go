@@ -0,0 +1,43 @@
+package shimmie_test
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/kusubooru/shimmie"
+)
+
+func TestReplySubject(t *testing.T) {
+	long := strings.Repeat("a", 64)
+	var tests = []struct {
+		in   string
+		want string
+	}{
+		{"hello", "Re: hello"},
+		{"Re: hello", "Re: hello"},
+		{"", "Re: "},
+		{long, "Re: " + long[:60]},
+	}
+	for _, tt := range tests {
+		if got := ReplySubject(tt.in); got != tt.want {
+			t.Errorf("ReplySubject(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPMPreview(t *testing.T) {
+	long := strings.Repeat("a", 120)
+	var tests = []struct {
+		in   string
+		want string
+	}{
+		{"hello", "hello"},
+		{"  hello\n\n  there ", "hello there"},
+		{long, long[:99] + "…"},
+	}
+	for _, tt := range tests {
+		if got := PMPreview(tt.in); got != tt.want {
+			t.Errorf("PMPreview(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
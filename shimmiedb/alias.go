@@ -1,13 +1,18 @@
 package shimmiedb
 
-import "github.com/kusubooru/shimmie"
+import (
+	"context"
+	"fmt"
+
+	"github.com/kusubooru/shimmie"
+)
 
 // GetAlias returns an alias based on its old tag.
-func (db *DB) GetAlias(oldTag string) (*shimmie.Alias, error) {
+func (db *DB) GetAlias(ctx context.Context, oldTag string) (*shimmie.Alias, error) {
 	var (
 		a shimmie.Alias
 	)
-	err := db.QueryRow(aliasGetQuery, oldTag).Scan(
+	err := db.QueryRowContext(ctx, db.rebind(aliasGetQuery), oldTag).Scan(
 		&a.OldTag,
 		&a.NewTag,
 	)
@@ -18,33 +23,33 @@ func (db *DB) GetAlias(oldTag string) (*shimmie.Alias, error) {
 }
 
 // DeleteAlias deletes an alias based on its old tag.
-func (db *DB) DeleteAlias(oldTag string) error {
-	stmt, err := db.Prepare(aliasDeleteStmt)
+func (db *DB) DeleteAlias(ctx context.Context, oldTag string) error {
+	stmt, err := db.PrepareContext(ctx, db.rebind(aliasDeleteStmt))
 	if err != nil {
 		return err
 	}
-	if _, err := stmt.Exec(oldTag); err != nil {
+	if _, err := stmt.ExecContext(ctx, oldTag); err != nil {
 		return err
 	}
 	return nil
 }
 
 // CreateAlias creates a new alias.
-func (db *DB) CreateAlias(alias *shimmie.Alias) error {
-	stmt, err := db.Prepare(aliasInsertStmt)
+func (db *DB) CreateAlias(ctx context.Context, alias *shimmie.Alias) error {
+	stmt, err := db.PrepareContext(ctx, db.rebind(aliasInsertStmt))
 	if err != nil {
 		return err
 	}
-	_, err = stmt.Exec(alias.NewTag, alias.OldTag)
+	_, err = stmt.ExecContext(ctx, alias.NewTag, alias.OldTag)
 	return err
 }
 
 // CountAlias returns how many alias entries exist in the database.
-func (db *DB) CountAlias() (int, error) {
+func (db *DB) CountAlias(ctx context.Context) (int, error) {
 	var (
 		count int
 	)
-	err := db.QueryRow(aliasCountQuery).Scan(&count)
+	err := db.QueryRowContext(ctx, db.rebind(aliasCountQuery)).Scan(&count)
 	if err != nil {
 		return -1, err
 	}
@@ -56,15 +61,15 @@ func (db *DB) CountAlias() (int, error) {
 // maximum limit and return all alias entries. Offset still works in this
 // case. For example, assuming 10 entries, GetAllAlias(-1, 0), will return
 // all 10 entries and GetAllAlias(-1, 8) will return the last 2 entries.
-func (db *DB) GetAllAlias(limit, offset int) ([]shimmie.Alias, error) {
+func (db *DB) GetAllAlias(ctx context.Context, limit, offset int) ([]shimmie.Alias, error) {
 	if limit < 0 {
-		count, cerr := db.CountAlias()
+		count, cerr := db.CountAlias(ctx)
 		if cerr != nil {
 			return nil, cerr
 		}
 		limit = count
 	}
-	rows, err := db.Query(aliasGetAllQuery, limit, offset)
+	rows, err := db.QueryContext(ctx, db.rebind(aliasGetAllQuery), limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -90,9 +95,58 @@ func (db *DB) GetAllAlias(limit, offset int) ([]shimmie.Alias, error) {
 	return alias, err
 }
 
+// ListAlias returns a page of alias ordered by old tag along with the cursor
+// token of the next page. An empty cursor returns the first page and an empty
+// next cursor is returned when there are no more pages. If limit <= 0 then a
+// default page size is used.
+func (db *DB) ListAlias(ctx context.Context, limit int, cursor string) ([]shimmie.Alias, string, error) {
+	c, err := shimmie.DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	limit = pageLimit(limit)
+	var afterOldTag string
+	if c != nil {
+		afterOldTag = c.Name
+	}
+	rows, err := db.QueryContext(ctx, db.rebind(aliasListQuery), afterOldTag, limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() {
+		if cerr := rows.Close(); err == nil {
+			err = cerr
+			return
+		}
+	}()
+
+	var alias []shimmie.Alias
+	for rows.Next() {
+		var a shimmie.Alias
+		err = rows.Scan(
+			&a.OldTag,
+			&a.NewTag,
+		)
+		if err != nil {
+			return nil, "", err
+		}
+		alias = append(alias, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(alias) > limit {
+		alias = alias[:limit]
+		next = shimmie.Cursor{Name: alias[limit-1].OldTag}.Encode()
+	}
+	return alias, next, nil
+}
+
 // FindAlias returns all alias matching an oldTag or a newTag or both.
-func (db *DB) FindAlias(oldTag, newTag string) ([]shimmie.Alias, error) {
-	rows, err := db.Query(aliasFindQuery, "%"+oldTag+"%", "%"+newTag+"%")
+func (db *DB) FindAlias(ctx context.Context, oldTag, newTag string) ([]shimmie.Alias, error) {
+	rows, err := db.QueryContext(ctx, db.rebind(fmt.Sprintf(aliasFindQuery, db.like())), "%"+oldTag+"%", "%"+newTag+"%")
 	if err != nil {
 		return nil, err
 	}
@@ -120,7 +174,7 @@ func (db *DB) FindAlias(oldTag, newTag string) ([]shimmie.Alias, error) {
 
 const (
 	aliasGetQuery = `
-SELECT *
+SELECT oldtag, newtag
 FROM aliases
 WHERE oldtag = ?
 `
@@ -132,10 +186,8 @@ WHERE oldtag = ?
 `
 
 	aliasInsertStmt = `
-INSERT aliases
-SET
-  newtag = ?,
-  oldtag = ?
+INSERT INTO aliases (newtag, oldtag)
+VALUES (?, ?)
 `
 
 	aliasCountQuery = `
@@ -144,15 +196,24 @@ FROM aliases
 `
 
 	aliasGetAllQuery = `
-SELECT *
+SELECT oldtag, newtag
 FROM aliases
+ORDER BY oldtag
 LIMIT ? OFFSET ?
+`
+
+	aliasListQuery = `
+SELECT oldtag, newtag
+FROM aliases
+WHERE oldtag > ?
+ORDER BY oldtag
+LIMIT ?
 `
 
 	aliasFindQuery = `
-SELECT *
+SELECT oldtag, newtag
 FROM aliases
-WHERE oldtag like ?
-  AND newtag like ?
+WHERE oldtag %[1]s ?
+  AND newtag %[1]s ?
 `
 )
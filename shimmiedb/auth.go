@@ -1,6 +1,7 @@
 package shimmiedb
 
 import (
+	"context"
 	"crypto/subtle"
 	"database/sql"
 
@@ -19,8 +20,8 @@ import (
 // - ErrWrongCredentials if the username and password do not match.
 //
 // - An error if something goes wrong with the database.
-func (db *DB) Verify(username, password string) (*shimmie.User, error) {
-	u, err := db.GetUserByName(username)
+func (db *DB) Verify(ctx context.Context, username, password string) (*shimmie.User, error) {
+	u, err := db.GetUserByName(ctx, username)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, shimmie.ErrNotFound
@@ -1,15 +1,20 @@
 package shimmiedb
 
-import "github.com/kusubooru/shimmie"
+import (
+	"context"
+	"fmt"
+
+	"github.com/kusubooru/shimmie"
+)
 
 // Autocomplete searches tags and tag alias for a term and returns
 // suggestions tags to be used for a UI autocomplete.
-func (db *DB) Autocomplete(q string, limit, offset int) ([]*shimmie.Autocomplete, error) {
+func (db *DB) Autocomplete(ctx context.Context, q string, limit, offset int) ([]*shimmie.Autocomplete, error) {
 	if q == "" {
 		return []*shimmie.Autocomplete{}, nil
 	}
 	q = "%" + q + "%"
-	rows, err := db.Query(autocompleteQuery, q, q, q, q, q, limit, offset)
+	rows, err := db.QueryContext(ctx, db.rebind(fmt.Sprintf(autocompleteQuery, db.like())), q, q, q, q, q, limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -36,17 +41,16 @@ const autocompleteQuery = `
 SELECT a.oldtag AS old, a.newtag AS name, t.count AS count
 FROM aliases a, tags t
 WHERE
-	(a.oldtag LIKE ? AND a.newtag = t.tag) OR
-	(t.tag LIKE ? AND a.newtag = t.tag)
+	(a.oldtag %[1]s ? AND a.newtag = t.tag) OR
+	(t.tag %[1]s ? AND a.newtag = t.tag)
 UNION
-	(SELECT '' AS old, t.tag AS name, t.count AS count
-	FROM tags t
-	WHERE t.tag LIKE ? AND t.count > 0 AND t.tag NOT IN (
-			SELECT oldtag from aliases where oldtag like ?
-			UNION
-            SELECT newtag from aliases where newtag like ?
-		)
-    )
+SELECT '' AS old, t.tag AS name, t.count AS count
+FROM tags t
+WHERE t.tag %[1]s ? AND t.count > 0 AND t.tag NOT IN (
+		SELECT oldtag from aliases where oldtag %[1]s ?
+		UNION
+		SELECT newtag from aliases where newtag %[1]s ?
+	)
 ORDER BY count DESC
 LIMIT ? OFFSET ?
 `
@@ -1,7 +1,10 @@
 package shimmiedb
 
 import (
-	"fmt"
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
 
 	"github.com/kusubooru/shimmie"
 )
@@ -15,7 +18,7 @@ const (
 )
 
 // GetCommon gets common configuration values.
-func (db *DB) GetCommon() (*shimmie.Common, error) {
+func (db *DB) GetCommon(ctx context.Context) (*shimmie.Common, error) {
 	keys := []string{
 		configKeyTitle,
 		configKeyDescription,
@@ -23,7 +26,7 @@ func (db *DB) GetCommon() (*shimmie.Common, error) {
 		configKeyAnalyticsID,
 		configKeyAnalyticsIDOld,
 	}
-	c, err := db.GetConfig(keys...)
+	c, err := db.GetConfig(ctx, keys...)
 	if err != nil {
 		return nil, err
 	}
@@ -39,18 +42,19 @@ func (db *DB) GetCommon() (*shimmie.Common, error) {
 	return &conf, nil
 }
 
-// GetConfig gets shimmie config values.
-func (db *DB) GetConfig(keys ...string) (map[string]string, error) {
-	query := fmt.Sprint(configGetQuery)
+// GetConfig gets shimmie config values. If no keys are given, all the config
+// values are returned.
+func (db *DB) GetConfig(ctx context.Context, keys ...string) (m map[string]string, err error) {
+	query := configGetQuery
+	args := make([]interface{}, len(keys))
 	if len(keys) != 0 {
-		query = fmt.Sprintf("%vWHERE\n", query)
-		for _, k := range keys {
-			query = fmt.Sprintf("%v  name = '%v' OR\n", query, k)
+		query += "WHERE name IN (?" + strings.Repeat(", ?", len(keys)-1) + ")"
+		for i, k := range keys {
+			args[i] = k
 		}
 	}
-	query = query[:len(query)-4] // chomp last ' OR\n'
 
-	rows, err := db.Query(query)
+	rows, err := db.QueryContext(ctx, db.rebind(query), args...)
 	if err != nil {
 		return nil, err
 	}
@@ -60,24 +64,64 @@ func (db *DB) GetConfig(keys ...string) (map[string]string, error) {
 		}
 	}()
 
-	var (
-		config = struct {
-			Name  string
-			Value string
-		}{}
-		m = map[string]string{}
-	)
+	m = make(map[string]string)
 	for rows.Next() {
-		err := rows.Scan(&config.Name, &config.Value)
-		if err != nil {
+		var (
+			name  string
+			value sql.NullString
+		)
+		if err := rows.Scan(&name, &value); err != nil {
 			return nil, err
 		}
-		m[config.Name] = config.Value
+		m[name] = value.String
 	}
-	return m, nil
+	return m, rows.Err()
 }
 
-const configGetQuery = `
-SELECT *
+// SetConfig sets a shimmie config value, creating it if it does not exist.
+func (db *DB) SetConfig(ctx context.Context, name, value string) error {
+	return Tx(ctx, db.DB, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, db.rebind(configDeleteStmt), name); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, db.rebind(configInsertStmt), name, value)
+		return err
+	})
+}
+
+// SetConfigs sets many shimmie config values in one transaction, creating
+// the ones that do not exist.
+func (db *DB) SetConfigs(ctx context.Context, values map[string]string) error {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return Tx(ctx, db.DB, func(tx *sql.Tx) error {
+		for _, name := range names {
+			if _, err := tx.ExecContext(ctx, db.rebind(configDeleteStmt), name); err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, db.rebind(configInsertStmt), name, values[name]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+const (
+	configGetQuery = `
+SELECT name, value
+FROM config
+`
+	configDeleteStmt = `
+DELETE
 FROM config
+WHERE name = ?
+`
+	configInsertStmt = `
+INSERT INTO config (name, value)
+VALUES (?, ?)
 `
+)
@@ -0,0 +1,27 @@
+package shimmiedb_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/kusubooru/shimmie/shimmiedb"
+)
+
+func TestGetConfigNullValue(t *testing.T) {
+	ctx := context.Background()
+	shim, schema := openDialect(t, shimmiedb.SQLite, filepath.Join(t.TempDir(), "shimmie.db"))
+	defer teardown(t, shim, schema)
+
+	// Shimmie stores some settings with a NULL value.
+	if _, err := shim.ExecContext(ctx, `INSERT INTO config (name, value) VALUES ('title', 'kusubooru'), ('site_keywords', NULL)`); err != nil {
+		t.Fatal(err)
+	}
+	m, err := shim.GetConfig(ctx)
+	if err != nil {
+		t.Fatalf("GetConfig returned err: %v", err)
+	}
+	if v, ok := m["site_keywords"]; !ok || v != "" || m["title"] != "kusubooru" {
+		t.Errorf("GetConfig = %q, want the NULL value as an empty string", m)
+	}
+}
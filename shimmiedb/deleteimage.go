@@ -0,0 +1,85 @@
+package shimmiedb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/kusubooru/shimmie"
+)
+
+// DeleteImage deletes an image along with its tags, tag history, favorites,
+// votes and perceptual hash, decrements the counts of its tags and pools,
+// detaches its children and logs the deletion. If d.BanHash is set, the hash
+// of the image is also banned. It returns the deleted image or sql.ErrNoRows
+// if it does not exist. The files of the image are not touched, see
+// shimmie.Shimmie.DeleteImage.
+func (db *DB) DeleteImage(ctx context.Context, id int64, d shimmie.ImageDeletion) (*shimmie.Image, error) {
+	var img *shimmie.Image
+	err := Tx(ctx, db.DB, func(tx *sql.Tx) error {
+		var err error
+		img, err = scanImage(tx.QueryRowContext(ctx, db.rebind(imageDeleteGetQuery), id))
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, db.rebind(imageDeleteTagCountStmt), id); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, db.rebind(imageDeletePoolPostsStmt), id); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, db.rebind(imageDeleteStmt), id); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, db.rebind(imageOrphanChildrenStmt), id); err != nil {
+			return err
+		}
+		if img.ParentID != 0 {
+			if err := db.updateHasChildren(ctx, tx, img.ParentID); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		_, err = tx.ExecContext(ctx, db.rebind(scoreLogInsertStmt), now, "core-image", d.Username(), d.Address, shimmie.PriorityInfo, d.LogMessage(img))
+		if err != nil {
+			return err
+		}
+		if d.BanHash {
+			return db.banHash(ctx, tx, img.Hash, d.Reason, d.User, d.Address, now)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+const (
+	imageDeleteGetQuery = `
+SELECT ` + imageColumns + `
+FROM images
+WHERE id = ?
+`
+	imageDeleteTagCountStmt = `
+UPDATE tags
+SET count = count - 1
+WHERE id IN (SELECT tag_id FROM image_tags WHERE image_id = ?)
+`
+	imageDeletePoolPostsStmt = `
+UPDATE pools
+SET posts = posts - 1
+WHERE id IN (SELECT pool_id FROM pool_images WHERE image_id = ?)
+`
+	imageDeleteStmt = `
+DELETE
+FROM images
+WHERE id = ?
+`
+	imageOrphanChildrenStmt = `
+UPDATE images
+SET parent_id = NULL
+WHERE parent_id = ?
+`
+)
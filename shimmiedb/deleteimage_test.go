@@ -0,0 +1,70 @@
+package shimmiedb_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/kusubooru/shimmie"
+	"github.com/kusubooru/shimmie/shimmiedb"
+)
+
+func TestDeleteImageTagCounts(t *testing.T) {
+	ctx := context.Background()
+	shim, schema := openDialect(t, shimmiedb.SQLite, filepath.Join(t.TempDir(), "shimmie.db"))
+	defer teardown(t, shim, schema)
+
+	u := shimmie.User{Name: "bob"}
+	if err := shim.CreateUser(ctx, &u); err != nil {
+		t.Fatal(err)
+	}
+	var ids []int64
+	for _, hash := range []string{"00000000000000000000000000000001", "00000000000000000000000000000002"} {
+		id, err := shim.CreateImage(ctx, shimmie.Image{OwnerID: u.ID, Hash: hash})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	// The store has no API for tagging images yet.
+	stmts := []string{
+		`INSERT INTO tags (id, tag, count) VALUES (1, 'shared', 2), (2, 'only_first', 1), (3, 'only_second', 1)`,
+		`INSERT INTO image_tags (image_id, tag_id) VALUES (1, 1), (1, 2), (2, 1), (2, 3)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := shim.ExecContext(ctx, stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := shim.DeleteImage(ctx, ids[0], shimmie.ImageDeletion{User: &u, Reason: "DMCA", BanHash: true}); err != nil {
+		t.Fatalf("DeleteImage returned err: %v", err)
+	}
+	for tag, want := range map[string]int{"shared": 1, "only_first": 0, "only_second": 1} {
+		got, err := shim.GetTag(ctx, tag)
+		if err != nil {
+			t.Fatalf("GetTag(%q) returned err: %v", tag, err)
+		}
+		if got.Count != want {
+			t.Errorf("count of %q = %d, want %d", tag, got.Count, want)
+		}
+	}
+	var n int
+	if err := shim.QueryRowContext(ctx, `SELECT COUNT(*) FROM image_tags`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("%d image tags left, want 2", n)
+	}
+	var (
+		reason string
+		userID int64
+	)
+	err := shim.QueryRowContext(ctx, `SELECT reason, user_id FROM image_bans WHERE hash = '00000000000000000000000000000001'`).Scan(&reason, &userID)
+	if err != nil {
+		t.Fatalf("hash was not banned: %v", err)
+	}
+	if reason != "DMCA" || userID != u.ID {
+		t.Errorf("ban has reason %q and user %d, want %q and %d", reason, userID, "DMCA", u.ID)
+	}
+}
@@ -0,0 +1,145 @@
+package shimmiedb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Dialect is an SQL database flavor supported by shimmiedb. It hides the
+// differences of the SQL and the schema of each database so that the same
+// DB methods can work with all of them.
+type Dialect interface {
+	// open opens the database and configures its connection pool.
+	open(dataSource string) (*sql.DB, error)
+	// rebind converts a query written with ? placeholders to the
+	// placeholders of the dialect.
+	rebind(query string) string
+	// like is the operator for case insensitive LIKE comparisons.
+	like() string
+	// forUpdate is the clause that locks the rows of a SELECT until the end
+	// of the transaction.
+	forUpdate() string
+	// ratedImageID is an SQL expression that extracts the image ID from the
+	// message of a score_log rating entry.
+	ratedImageID() string
+	// insert executes an insert statement and returns the ID of the new row.
+	insert(ctx context.Context, db execQueryer, query string, args ...interface{}) (int64, error)
+	// insertIgnore converts an insert statement to one that inserts nothing,
+	// instead of failing, when the row violates a unique key.
+	insertIgnore(query string) string
+	// createStatements and alterStatements create the schema.
+	createStatements() []string
+	alterStatements() []string
+	// ignoreAlterErr reports whether an error of an alter statement can be
+	// ignored because the column or index already exists.
+	ignoreAlterErr(err error) bool
+	// allTablesQuery returns the names of all the tables of the schema.
+	allTablesQuery() string
+	// truncateTablesStmt truncates the tables and resets their IDs.
+	truncateTablesStmt(tables []string) string
+}
+
+// Supported dialects. Only the MySQL driver is registered by shimmiedb, so
+// that users of MySQL do not depend on the other drivers. Postgres needs
+// github.com/lib/pq and SQLite needs modernc.org/sqlite to be imported by the
+// caller, for example:
+//
+//	import _ "modernc.org/sqlite"
+var (
+	MySQL    Dialect = mysqlDialect{}
+	Postgres Dialect = postgresDialect{}
+	SQLite   Dialect = sqliteDialect{}
+)
+
+// execQueryer is implemented by both *sql.DB and *sql.Tx.
+type execQueryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) rebind(query string) string { return query }
+func (mysqlDialect) like() string               { return "LIKE" }
+func (mysqlDialect) forUpdate() string          { return "FOR UPDATE" }
+func (mysqlDialect) createStatements() []string { return createStatements }
+func (mysqlDialect) alterStatements() []string  { return alterStatements }
+func (mysqlDialect) allTablesQuery() string     { return mysqlAllTablesQuery }
+
+func (mysqlDialect) open(dataSource string) (*sql.DB, error) {
+	db, err := sql.Open("mysql", dataSource)
+	if err != nil {
+		return nil, err
+	}
+	// per issue https://github.com/go-sql-driver/mysql/issues/257
+	db.SetMaxIdleConns(0)
+	return db, nil
+}
+
+func (mysqlDialect) ratedImageID() string {
+	return "SUBSTRING_INDEX(SUBSTRING_INDEX(message, '#', - 1), ' ', 1)"
+}
+
+func (mysqlDialect) insert(ctx context.Context, db execQueryer, query string, args ...interface{}) (int64, error) {
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (mysqlDialect) insertIgnore(query string) string {
+	return strings.Replace(query, "INSERT INTO", "INSERT IGNORE INTO", 1)
+}
+
+func (mysqlDialect) ignoreAlterErr(err error) bool {
+	driverErr, ok := err.(*mysql.MySQLError)
+	if !ok {
+		return false
+	}
+	return driverErr.Number == duplicateColumnName || driverErr.Number == duplicateKeyName
+}
+
+func (mysqlDialect) truncateTablesStmt(tables []string) string {
+	b := strings.Builder{}
+	b.WriteString("SET FOREIGN_KEY_CHECKS=0;\n")
+	for _, t := range tables {
+		b.WriteString(fmt.Sprintf("TRUNCATE TABLE %s;\n", t))
+	}
+	b.WriteString("SET FOREIGN_KEY_CHECKS=1;")
+	return b.String()
+}
+
+const mysqlAllTablesQuery = `
+	SELECT table_name
+	FROM information_schema.tables
+	WHERE table_schema="shimmie";`
+
+// rebindNumbered replaces the ? placeholders of a query with numbered
+// placeholders that begin with prefix, e.g. $1, $2 etc. Question marks inside
+// quoted strings are left as they are.
+func rebindNumbered(query, prefix string) string {
+	var (
+		b      strings.Builder
+		n      int
+		quoted bool
+	)
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case r == '?' && !quoted:
+			n++
+			b.WriteString(prefix)
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,20 @@
+package shimmiedb
+
+import "testing"
+
+func TestRebindNumbered(t *testing.T) {
+	var tests = []struct {
+		in  string
+		out string
+	}{
+		{"SELECT * FROM users", "SELECT * FROM users"},
+		{"SELECT * FROM users WHERE id = ?", "SELECT * FROM users WHERE id = $1"},
+		{"INSERT INTO tags (tag, count) VALUES (?, ?)", "INSERT INTO tags (tag, count) VALUES ($1, $2)"},
+		{"SELECT '?' AS q WHERE a = ? AND b = 'it''s?' AND c = ?", "SELECT '?' AS q WHERE a = $1 AND b = 'it''s?' AND c = $2"},
+	}
+	for _, tt := range tests {
+		if got, want := rebindNumbered(tt.in, "$"), tt.out; got != want {
+			t.Errorf("rebindNumbered(%q) = %q, want %q", tt.in, got, want)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package shimmiedb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/kusubooru/shimmie"
+)
+
+// AddFavorite adds an image to the favorites of a user and updates the
+// favorites count of the image. Adding a favorite twice has no effect, even
+// when both are added at the same time. It returns sql.ErrNoRows if the user
+// or the image does not exist.
+func (db *DB) AddFavorite(ctx context.Context, userID, imageID int64) error {
+	return Tx(ctx, db.DB, func(tx *sql.Tx) error {
+		if err := db.lockImage(ctx, tx, imageID); err != nil {
+			return err
+		}
+		if err := db.checkUserImage(ctx, tx, userID, imageID); err != nil {
+			return err
+		}
+		d := db.sqlDialect()
+		res, err := tx.ExecContext(ctx, d.rebind(d.insertIgnore(favoriteInsertStmt)), imageID, userID, time.Now())
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+		_, err = tx.ExecContext(ctx, db.rebind(imageFavoritesUpdateStmt), imageID, imageID)
+		return err
+	})
+}
+
+// lockImage locks the row of an image until tx ends so that the counts of
+// the image are recomputed one transaction after the other. It comes before
+// any other read so that the snapshot of the transaction, which MySQL takes
+// at its first plain read, includes the changes of the ones that held the
+// lock before. It returns sql.ErrNoRows if the image does not exist.
+func (db *DB) lockImage(ctx context.Context, tx *sql.Tx, imageID int64) error {
+	var id int64
+	return tx.QueryRowContext(ctx, db.rebind(imageLockQuery+db.sqlDialect().forUpdate()), imageID).Scan(&id)
+}
+
+// checkUserImage returns sql.ErrNoRows if the user or the image does not
+// exist.
+func (db *DB) checkUserImage(ctx context.Context, q execQueryer, userID, imageID int64) error {
+	for _, c := range []struct {
+		query string
+		id    int64
+	}{
+		{userCountByIDQuery, userID},
+		{imageCountQuery, imageID},
+	} {
+		var n int
+		if err := q.QueryRowContext(ctx, db.rebind(c.query), c.id).Scan(&n); err != nil {
+			return err
+		}
+		if n == 0 {
+			return sql.ErrNoRows
+		}
+	}
+	return nil
+}
+
+// RemoveFavorite removes an image from the favorites of a user and updates
+// the favorites count of the image. Removing a favorite that does not exist
+// has no effect.
+func (db *DB) RemoveFavorite(ctx context.Context, userID, imageID int64) error {
+	return Tx(ctx, db.DB, func(tx *sql.Tx) error {
+		if err := db.lockImage(ctx, tx, imageID); err != nil {
+			if err == sql.ErrNoRows {
+				return nil
+			}
+			return err
+		}
+		res, err := tx.ExecContext(ctx, db.rebind(favoriteDeleteStmt), imageID, userID)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+		_, err = tx.ExecContext(ctx, db.rebind(imageFavoritesUpdateStmt), imageID, imageID)
+		return err
+	})
+}
+
+// extraScanner scans the columns that follow the ones of scanImage into
+// extra.
+type extraScanner struct {
+	scanner
+	extra []interface{}
+}
+
+func (s extraScanner) Scan(dest ...interface{}) error {
+	return s.scanner.Scan(append(dest, s.extra...)...)
+}
+
+// ListFavorites returns the favorite images of a user, most recently
+// favorited first.
+func (db *DB) ListFavorites(ctx context.Context, userID int64, limit int, cursor string) (images []shimmie.Image, next string, err error) {
+	c, err := shimmie.DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	limit = pageLimit(limit)
+
+	query := favoritesListQuery
+	args := []interface{}{userID}
+	if c != nil && c.Time != nil {
+		query += "\nAND (f.created_at < ? OR (f.created_at = ? AND f.image_id < ?))"
+		args = append(args, *c.Time, *c.Time, c.ID)
+	}
+	query += "\nORDER BY f.created_at DESC, f.image_id DESC\nLIMIT ?"
+	// Fetch one extra image to find out if there is a next page.
+	args = append(args, limit+1)
+
+	rows, err := db.QueryContext(ctx, db.rebind(query), args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() {
+		if cerr := rows.Close(); err == nil {
+			err = cerr
+			return
+		}
+	}()
+
+	var added []time.Time
+	for rows.Next() {
+		var t time.Time
+		img, err := scanImage(extraScanner{rows, []interface{}{&t}})
+		if err != nil {
+			return nil, "", err
+		}
+		images = append(images, *img)
+		added = append(added, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(images) > limit {
+		images = images[:limit]
+		next = shimmie.Cursor{ID: images[limit-1].ID, Time: &added[limit-1]}.Encode()
+	}
+	return images, next, nil
+}
+
+// FavoritedBy returns the users that have favorited an image, ordered by
+// name.
+func (db *DB) FavoritedBy(ctx context.Context, imageID int64) (users []shimmie.User, err error) {
+	rows, err := db.QueryContext(ctx, db.rebind(favoritedByQuery), imageID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := rows.Close(); err == nil {
+			err = cerr
+			return
+		}
+	}()
+
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// MostFavorited returns the images that were favorited the most times since
+// a time, most favorited first and then by descending ID.
+func (db *DB) MostFavorited(ctx context.Context, since time.Time, limit int) (scores []shimmie.ImageScore, err error) {
+	rows, err := db.QueryContext(ctx, db.rebind(mostFavoritedQuery), since, pageLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := rows.Close(); err == nil {
+			err = cerr
+			return
+		}
+	}()
+
+	for rows.Next() {
+		var score int
+		img, err := scanImage(extraScanner{rows, []interface{}{&score}})
+		if err != nil {
+			return nil, err
+		}
+		scores = append(scores, shimmie.ImageScore{Score: score, Image: *img})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return scores, nil
+}
+
+const (
+	imageLockQuery = `
+SELECT id
+FROM images
+WHERE id = ?
+`
+	userCountByIDQuery = `
+SELECT COUNT(*)
+FROM users
+WHERE id = ?
+`
+	favoriteInsertStmt = `
+INSERT INTO user_favorites (image_id, user_id, created_at)
+VALUES (?, ?, ?)
+`
+	favoriteDeleteStmt = `
+DELETE
+FROM user_favorites
+WHERE image_id = ? AND user_id = ?
+`
+	imageFavoritesUpdateStmt = `
+UPDATE images
+SET favorites = (SELECT COUNT(*) FROM user_favorites WHERE image_id = ?)
+WHERE id = ?
+`
+	favoritesListQuery = `
+SELECT ` + imageColumns + `, f.created_at
+FROM user_favorites AS f
+JOIN images ON images.id = f.image_id
+WHERE f.user_id = ?`
+	favoritedByQuery = `
+SELECT ` + userColumns + `
+FROM users
+WHERE id IN (SELECT user_id FROM user_favorites WHERE image_id = ?)
+ORDER BY name
+`
+	mostFavoritedQuery = `
+SELECT ` + imageColumns + `, s.score
+FROM (
+	SELECT image_id, COUNT(*) AS score
+	FROM user_favorites
+	WHERE created_at >= ?
+	GROUP BY image_id
+) AS s
+JOIN images ON images.id = s.image_id
+ORDER BY s.score DESC, images.id DESC
+LIMIT ?
+`
+)
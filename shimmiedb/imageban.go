@@ -0,0 +1,165 @@
+package shimmiedb
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/kusubooru/shimmie"
+)
+
+// BanHash bans an image hash so that images with it cannot be created and
+// logs the ban. Banning a hash that is already banned has no effect. The
+// user may be nil.
+func (db *DB) BanHash(ctx context.Context, hash, reason string, user *shimmie.User) error {
+	return Tx(ctx, db.DB, func(tx *sql.Tx) error {
+		return db.banHash(ctx, tx, hash, reason, user, "", time.Now())
+	})
+}
+
+// banHash adds hash to image_bans, unless it is already banned, and logs
+// the ban. Hashes are stored in lower case like the MD5 hashes of Shimmie.
+func (db *DB) banHash(ctx context.Context, tx *sql.Tx, hash, reason string, user *shimmie.User, address string, now time.Time) error {
+	hash = strings.ToLower(hash)
+	var n int
+	if err := tx.QueryRowContext(ctx, db.rebind(imageBanCountQuery), hash).Scan(&n); err != nil {
+		return err
+	}
+	if n != 0 {
+		return nil
+	}
+	var (
+		userID   interface{}
+		username string
+	)
+	if user != nil {
+		userID, username = user.ID, user.Name
+	}
+	if _, err := tx.ExecContext(ctx, db.rebind(imageBanInsertStmt), hash, now, reason, userID); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, db.rebind(scoreLogInsertStmt), now, "image_hash_ban", username, address, shimmie.PriorityInfo, shimmie.HashBanLogMessage(hash, reason))
+	return err
+}
+
+// checkHashBan returns a *shimmie.HashBannedError if hash is banned.
+func (db *DB) checkHashBan(ctx context.Context, q execQueryer, hash string) error {
+	var reason string
+	err := q.QueryRowContext(ctx, db.rebind(imageBanReasonQuery), strings.ToLower(hash)).Scan(&reason)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return &shimmie.HashBannedError{Hash: hash, Reason: reason}
+}
+
+// IsHashBanned reports whether an image hash is banned.
+func (db *DB) IsHashBanned(ctx context.Context, hash string) (bool, error) {
+	var n int
+	if err := db.QueryRowContext(ctx, db.rebind(imageBanCountQuery), strings.ToLower(hash)).Scan(&n); err != nil {
+		return false, err
+	}
+	return n != 0, nil
+}
+
+// UnbanHash removes the ban of an image hash. It returns sql.ErrNoRows if
+// the hash is not banned.
+func (db *DB) UnbanHash(ctx context.Context, hash string) error {
+	res, err := db.ExecContext(ctx, db.rebind(imageBanDeleteStmt), strings.ToLower(hash))
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListHashBans returns the banned image hashes, newest ban first.
+func (db *DB) ListHashBans(ctx context.Context, limit int, cursor string) ([]shimmie.ImageBan, string, error) {
+	c, err := shimmie.DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	limit = pageLimit(limit)
+
+	query := imageBansListQuery
+	var args []interface{}
+	if c != nil {
+		query += "\nWHERE b.id < ?"
+		args = append(args, c.ID)
+	}
+	query += "\nORDER BY b.id DESC\nLIMIT ?"
+	// Fetch one extra ban to find out if there is a next page.
+	args = append(args, limit+1)
+
+	rows, err := db.QueryContext(ctx, db.rebind(query), args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() {
+		if cerr := rows.Close(); err == nil {
+			err = cerr
+			return
+		}
+	}()
+
+	var bans []shimmie.ImageBan
+	for rows.Next() {
+		var (
+			b        shimmie.ImageBan
+			userID   sql.NullInt64
+			userName sql.NullString
+		)
+		if err := rows.Scan(&b.ID, &b.Hash, &b.Date, &b.Reason, &userID, &userName); err != nil {
+			return nil, "", err
+		}
+		b.UserID, b.UserName = userID.Int64, userName.String
+		bans = append(bans, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(bans) > limit {
+		bans = bans[:limit]
+		next = shimmie.Cursor{ID: bans[limit-1].ID}.Encode()
+	}
+	return bans, next, nil
+}
+
+const (
+	imageBanCountQuery = `
+SELECT COUNT(*)
+FROM image_bans
+WHERE hash = ?
+`
+	imageBanReasonQuery = `
+SELECT reason
+FROM image_bans
+WHERE hash = ?
+ORDER BY id
+LIMIT 1
+`
+	imageBanInsertStmt = `
+INSERT INTO image_bans (hash, date, reason, user_id)
+VALUES (?, ?, ?, ?)
+`
+	imageBanDeleteStmt = `
+DELETE
+FROM image_bans
+WHERE hash = ?
+`
+	imageBansListQuery = `
+SELECT b.id, b.hash, b.date, b.reason, b.user_id, u.name
+FROM image_bans AS b
+LEFT JOIN users AS u ON u.id = b.user_id`
+)
@@ -8,49 +8,37 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/kusubooru/shimmie"
 )
 
-// CreateImage inserts a new image to the database.
+// CreateImage inserts a new image to the database. If img.ID is 0 then the
+// database assigns the ID. If img.Posted is nil then the current time is used.
+// It returns a *shimmie.HashBannedError if the hash of the image is banned.
 func (db *DB) CreateImage(ctx context.Context, img shimmie.Image) (int64, error) {
-	const query = `
-	INSERT INTO images(
-		id,
-		owner_id,
-		owner_ip,
-		filename,
-		filesize,
-		hash,
-		ext,
-		source,
-		width,
-		height,
-		posted,
-		locked
-	) values (
-		?,
-		?,
-		?,
-		?,
-		?,
-		?,
-		?,
-		?,
-		?,
-		?,
-		?,
-		?
-	);`
-
-	stmt, err := db.Prepare(query)
-	if err != nil {
-		return 0, err
+	if img.Posted == nil {
+		now := time.Now()
+		img.Posted = &now
 	}
-	defer stmt.Close()
-
-	res, err := stmt.ExecContext(ctx,
-		img.ID,
+	if img.Locked == "" {
+		img.Locked = "N"
+	}
+	columns := []string{
+		"owner_id",
+		"owner_ip",
+		"filename",
+		"filesize",
+		"hash",
+		"ext",
+		"source",
+		"width",
+		"height",
+		"posted",
+		"locked",
+	}
+	args := []interface{}{
 		img.OwnerID,
 		img.OwnerIP,
 		img.Filename,
@@ -62,21 +50,36 @@ func (db *DB) CreateImage(ctx context.Context, img shimmie.Image) (int64, error)
 		img.Height,
 		img.Posted,
 		img.Locked,
-	)
-	if err != nil {
-		return 0, err
 	}
-	return res.LastInsertId()
+	if img.ID != 0 {
+		columns = append([]string{"id"}, columns...)
+		args = append([]interface{}{img.ID}, args...)
+	}
+	query := fmt.Sprintf("INSERT INTO images (%s) VALUES (%s)",
+		strings.Join(columns, ", "),
+		strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", "),
+	)
+	var id int64
+	err := Tx(ctx, db.DB, func(tx *sql.Tx) error {
+		if err := db.checkHashBan(ctx, tx, img.Hash); err != nil {
+			return err
+		}
+		d := db.sqlDialect()
+		var err error
+		id, err = d.insert(ctx, tx, d.rebind(query), args...)
+		return err
+	})
+	return id, err
 }
 
 // RateImage sets the rating for an image.
-func (db *DB) RateImage(id int, rating string) error {
+func (db *DB) RateImage(ctx context.Context, id int, rating string) error {
 	const query = `
 	UPDATE images
 	SET rating=?
 	WHERE id=?;`
 
-	stmt, err := db.Prepare(query)
+	stmt, err := db.PrepareContext(ctx, db.rebind(query))
 	if err != nil {
 		return err
 	}
@@ -87,7 +90,7 @@ func (db *DB) RateImage(id int, rating string) error {
 		}
 	}()
 
-	res, err := stmt.Exec(rating, id)
+	res, err := stmt.ExecContext(ctx, rating, id)
 	if err != nil {
 		return err
 	}
@@ -98,19 +101,139 @@ func (db *DB) RateImage(id int, rating string) error {
 }
 
 // GetImage gets a shimmie Image metadata (not it's bytes).
-func (db *DB) GetImage(id int) (*shimmie.Image, error) {
-	const query = `
-	SELECT *
+func (db *DB) GetImage(ctx context.Context, id int) (*shimmie.Image, error) {
+	query := `
+	SELECT ` + imageColumns + `
 	FROM images
 	WHERE id=?;`
 
+	return scanImage(db.QueryRowContext(ctx, db.rebind(query), id))
+}
+
+// ListImages returns a page of the images that match filter, ordered by
+// filter.Order, along with the cursor token of the next page. An empty cursor
+// returns the first page and an empty next cursor is returned when there are
+// no more pages. If limit <= 0 then a default page size is used.
+func (db *DB) ListImages(ctx context.Context, filter shimmie.ImageFilter, limit int, cursor string) ([]shimmie.Image, string, error) {
+	c, err := shimmie.DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	limit = pageLimit(limit)
+
+	var (
+		where []string
+		args  []interface{}
+	)
+	if filter.OwnerID != 0 {
+		where = append(where, "owner_id = ?")
+		args = append(args, filter.OwnerID)
+	}
+	if filter.Rating != "" {
+		where = append(where, "rating = ?")
+		args = append(args, filter.Rating)
+	}
+	if filter.Ext != "" {
+		where = append(where, "ext = ?")
+		args = append(args, filter.Ext)
+	}
+	if filter.PostedAfter != nil {
+		where = append(where, "posted >= ?")
+		args = append(args, filter.PostedAfter)
+	}
+	if filter.PostedBefore != nil {
+		where = append(where, "posted < ?")
+		args = append(args, filter.PostedBefore)
+	}
+
+	var orderBy string
+	switch filter.Order {
+	case shimmie.ImageOrderPosted:
+		orderBy = "posted DESC, id DESC"
+		if c != nil {
+			if c.Time == nil {
+				return nil, "", shimmie.ErrInvalidCursor
+			}
+			where = append(where, "(posted < ? OR (posted = ? AND id < ?))")
+			args = append(args, c.Time, c.Time, c.ID)
+		}
+	case shimmie.ImageOrderScore:
+		orderBy = "numeric_score DESC, id DESC"
+		if c != nil {
+			where = append(where, "(numeric_score < ? OR (numeric_score = ? AND id < ?))")
+			args = append(args, c.Score, c.Score, c.ID)
+		}
+	default:
+		orderBy = "id DESC"
+		if c != nil {
+			where = append(where, "id < ?")
+			args = append(args, c.ID)
+		}
+	}
+
+	query := "SELECT " + imageColumns + "\nFROM images\n"
+	if len(where) != 0 {
+		query += "WHERE " + strings.Join(where, "\n  AND ") + "\n"
+	}
+	query += "ORDER BY " + orderBy + "\nLIMIT ?"
+	// Fetch one extra image to find out if there is a next page.
+	args = append(args, limit+1)
+
+	rows, err := db.QueryContext(ctx, db.rebind(query), args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() {
+		if cerr := rows.Close(); err == nil {
+			err = cerr
+			return
+		}
+	}()
+
+	var images []shimmie.Image
+	for rows.Next() {
+		img, err := scanImage(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		images = append(images, *img)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(images) > limit {
+		images = images[:limit]
+		last := images[limit-1]
+		next = shimmie.Cursor{
+			ID:    last.ID,
+			Time:  last.Posted,
+			Score: last.NumericScore,
+		}.Encode()
+	}
+	return images, next, nil
+}
+
+// imageColumns are the columns of the images table in the order expected by
+// scanImage.
+const imageColumns = `id, owner_id, owner_ip, filename, filesize, hash, ext,
+	source, width, height, posted, locked, numeric_score, rating, favorites,
+	parent_id, has_children, author, notes`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanImage scans a row holding imageColumns into an Image.
+func scanImage(row scanner) (*shimmie.Image, error) {
 	var (
 		img      shimmie.Image
 		source   sql.NullString
 		parentID sql.NullInt64
 		author   sql.NullString
 	)
-	err := db.QueryRow(query, id).Scan(
+	err := row.Scan(
 		&img.ID,
 		&img.OwnerID,
 		&img.OwnerIP,
@@ -143,13 +266,12 @@ func (db *DB) GetImage(id int) (*shimmie.Image, error) {
 	if author.Valid {
 		img.Author = author.String
 	}
-
 	return &img, nil
 }
 
 // WriteImageFile reads a shimmie image file (image or thumb) which exists
 // under a path and has a hash and then writes to w.
-func (db *DB) WriteImageFile(w io.Writer, path, hash string) error {
+func (db *DB) WriteImageFile(ctx context.Context, w io.Writer, path, hash string) error {
 	// Each image has a hash and it's file is stored under a path (one for the
 	// images and one for the thumbs), under a folder which begins with the
 	// first two letters of the hash.
@@ -167,6 +289,10 @@ func (db *DB) WriteImageFile(w io.Writer, path, hash string) error {
 	r := bufio.NewReader(f)
 	buf := make([]byte, 1024)
 	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		// read a chunk
 		n, rerr := r.Read(buf)
 		if rerr != nil && rerr != io.EOF {
@@ -186,8 +312,8 @@ func (db *DB) WriteImageFile(w io.Writer, path, hash string) error {
 
 // GetRatedImages returns all the images that have been rated as safe
 // ignoring the ones from username.
-func (db *DB) GetRatedImages(username string) ([]shimmie.RatedImage, error) {
-	rows, err := db.Query(imageGetRatedQuery, username)
+func (db *DB) GetRatedImages(ctx context.Context, username string) ([]shimmie.RatedImage, error) {
+	rows, err := db.QueryContext(ctx, db.rebind(fmt.Sprintf(imageGetRatedQuery, db.sqlDialect().ratedImageID())), username)
 	if err != nil {
 		return nil, err
 	}
@@ -263,10 +389,11 @@ const (
 	// Since shimmie does not keep a rating history we have to do ugly work
 	// using the shimmie log.
 	//
-	// Warning: MySQL specific query.
+	// The expression that extracts the image ID from the log message depends
+	// on the dialect and it is formatted into the query.
 	imageGetRatedQuery = `
 SELECT
-  img.*,
+  ` + imageColumns + `,
   rater,
   rater_ip,
   rate_date
@@ -283,11 +410,11 @@ FROM
       (
         SELECT
           MAX(score_log.id) AS max_log_id,
-          SUBSTRING_INDEX(SUBSTRING_INDEX(message, '#', - 1), ' ', 1) AS rated_id
+          %s AS rated_id
         FROM
           score_log
         WHERE
-          message LIKE '%set to: Safe'
+          message LIKE '%%set to: Safe'
           AND section = 'rating'
         GROUP BY
           rated_id
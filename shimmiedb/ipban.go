@@ -0,0 +1,132 @@
+package shimmiedb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/kusubooru/shimmie"
+)
+
+// AddIPBan bans an IP address or range. It sets the ID and Added time of
+// the ban and stores its IP in the form of shimmie.NormalizeIPBan.
+func (db *DB) AddIPBan(ctx context.Context, ban *shimmie.IPBan) error {
+	ip, err := shimmie.NormalizeIPBan(ban.IP)
+	if err != nil {
+		return err
+	}
+	var expires interface{}
+	if ban.Expires != nil {
+		expires = *ban.Expires
+	}
+	now := time.Now()
+	d := db.sqlDialect()
+	id, err := d.insert(ctx, db.DB, d.rebind(ipBanInsertStmt), ban.BannerID, ip, ban.Reason, now, expires)
+	if err != nil {
+		return err
+	}
+	ban.ID, ban.IP, ban.Added = id, ip, now
+	return nil
+}
+
+// RemoveIPBan removes a ban. It returns sql.ErrNoRows if there is no ban
+// with that ID.
+func (db *DB) RemoveIPBan(ctx context.Context, id int64) error {
+	res, err := db.ExecContext(ctx, db.rebind(ipBanDeleteStmt), id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListIPBans returns the IP bans, including the expired ones, newest first.
+func (db *DB) ListIPBans(ctx context.Context, limit int, cursor string) ([]shimmie.IPBan, string, error) {
+	c, err := shimmie.DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	limit = pageLimit(limit)
+
+	query := ipBansListQuery
+	var args []interface{}
+	if c != nil {
+		query += "\nWHERE b.id < ?"
+		args = append(args, c.ID)
+	}
+	query += "\nORDER BY b.id DESC\nLIMIT ?"
+	// Fetch one extra ban to find out if there is a next page.
+	args = append(args, limit+1)
+
+	bans, err := db.queryIPBans(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	var next string
+	if len(bans) > limit {
+		bans = bans[:limit]
+		next = shimmie.Cursor{ID: bans[limit-1].ID}.Encode()
+	}
+	return bans, next, nil
+}
+
+// ActiveIPBans returns the IP bans that have not expired.
+func (db *DB) ActiveIPBans(ctx context.Context) ([]shimmie.IPBan, error) {
+	query := ipBansListQuery + "\nWHERE b.expires IS NULL OR b.expires > ?\nORDER BY b.id"
+	return db.queryIPBans(ctx, query, time.Now())
+}
+
+func (db *DB) queryIPBans(ctx context.Context, query string, args ...interface{}) (bans []shimmie.IPBan, err error) {
+	rows, err := db.QueryContext(ctx, db.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := rows.Close(); err == nil {
+			err = cerr
+			return
+		}
+	}()
+
+	for rows.Next() {
+		var (
+			b          shimmie.IPBan
+			expires    sql.NullTime
+			bannerName sql.NullString
+		)
+		if err := rows.Scan(&b.ID, &b.BannerID, &bannerName, &b.IP, &b.Reason, &b.Added, &expires); err != nil {
+			return nil, err
+		}
+		b.BannerName = bannerName.String
+		if expires.Valid {
+			b.Expires = &expires.Time
+		}
+		bans = append(bans, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return bans, nil
+}
+
+const (
+	ipBanInsertStmt = `
+INSERT INTO bans (banner_id, ip, reason, added, expires)
+VALUES (?, ?, ?, ?, ?)
+`
+	ipBanDeleteStmt = `
+DELETE
+FROM bans
+WHERE id = ?
+`
+	ipBansListQuery = `
+SELECT b.id, b.banner_id, u.name, b.ip, b.reason, b.added, b.expires
+FROM bans AS b
+LEFT JOIN users AS u ON u.id = b.banner_id`
+)
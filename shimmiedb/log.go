@@ -1,35 +1,29 @@
 package shimmiedb
 
 import (
+	"context"
 	"fmt"
+	"net"
+	"strings"
 	"time"
 
 	"github.com/kusubooru/shimmie"
 )
 
 // LogRating logs when an image rating is set.
-func (db *DB) LogRating(imgID int, imgRating, username, userIP string) error {
+func (db *DB) LogRating(ctx context.Context, imgID int, imgRating, username, userIP string) error {
 	rating := shimmie.ImageRating(imgRating)
 	msg := fmt.Sprintf("Rating for Image #%d set to: %v", imgID, rating)
 
-	_, err := db.Log("rating", username, userIP, 20, msg)
+	_, err := db.Log(ctx, "rating", username, userIP, shimmie.PriorityInfo, msg)
 
 	return err
 }
 
 // Log stores a message on score_log table.
-func (db *DB) Log(section, username, address string, priority int, message string) (*shimmie.SCoreLog, error) {
-	stmt, err := db.Prepare(scoreLogInsertStmt)
-	if err != nil {
-		return nil, err
-	}
+func (db *DB) Log(ctx context.Context, section, username, address string, priority int, message string) (*shimmie.SCoreLog, error) {
 	now := time.Now()
-	res, err := stmt.Exec(now.Format(time.RFC3339), section, username, address, priority, message)
-	if err != nil {
-		return nil, err
-	}
-
-	id, err := res.LastInsertId()
+	id, err := db.insert(ctx, scoreLogInsertStmt, now, section, username, address, priority, message)
 	if err != nil {
 		return nil, err
 	}
@@ -46,13 +40,192 @@ func (db *DB) Log(section, username, address string, priority int, message strin
 	return log, nil
 }
 
+// logBatchSize is the number of log entries fetched at a time when entries
+// need to be filtered in Go.
+const logBatchSize = 500
+
+// logScanLimit is the number of log entries that a single QueryLogs call
+// checks in Go before it returns the matches found so far.
+const logScanLimit = 10 * logBatchSize
+
+// QueryLogs returns the log entries that match filter, newest first. Results
+// are paginated with limit and the cursor returned by the previous call.
+//
+// SQL cannot match a CIDR address filter portably so the entries are narrowed
+// down by the textual prefix of the network, when there is one, and then
+// checked in Go in batches. IPv6 networks and IPv4 networks shorter than /8
+// have no such prefix, so to bound the work of a call it stops after
+// logScanLimit entries and returns the cursor where it stopped. Such a page
+// may have fewer than limit entries, or none, even though there is a next
+// page.
+func (db *DB) QueryLogs(ctx context.Context, filter shimmie.LogFilter, limit int, cursor string) ([]shimmie.SCoreLog, string, error) {
+	c, err := shimmie.DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	network, err := filter.Network()
+	if err != nil {
+		return nil, "", err
+	}
+	limit = pageLimit(limit)
+
+	var (
+		where []string
+		args  []interface{}
+	)
+	if filter.Section != "" {
+		where = append(where, "section = ?")
+		args = append(args, filter.Section)
+	}
+	if filter.Username != "" {
+		where = append(where, "username = ?")
+		args = append(args, filter.Username)
+	}
+	switch {
+	case filter.Address == "":
+	case network == nil:
+		where = append(where, "address = ?")
+		args = append(args, filter.Address)
+	case addressPrefix(network) != "":
+		where = append(where, "address LIKE ?")
+		args = append(args, addressPrefix(network)+"%")
+	}
+	if filter.MinPriority != 0 {
+		where = append(where, "priority >= ?")
+		args = append(args, filter.MinPriority)
+	}
+	if filter.After != nil {
+		where = append(where, "date_sent >= ?")
+		args = append(args, filter.After)
+	}
+	if filter.Before != nil {
+		where = append(where, "date_sent < ?")
+		args = append(args, filter.Before)
+	}
+	if filter.Message != "" {
+		where = append(where, fmt.Sprintf("message %s ? ESCAPE '!'", db.like()))
+		args = append(args, "%"+escapeLike(filter.Message)+"%")
+	}
+
+	// Fetch one extra entry to find out if there is a next page.
+	batch := limit + 1
+	if network != nil && batch < logBatchSize {
+		batch = logBatchSize
+	}
+	var beforeID int64
+	if c != nil {
+		beforeID = c.ID
+	}
+	var (
+		logs    []shimmie.SCoreLog
+		scanned int
+	)
+	for {
+		page, err := db.queryLogs(ctx, where, args, beforeID, batch)
+		if err != nil {
+			return nil, "", err
+		}
+		scanned += len(page)
+		for _, l := range page {
+			if network == nil || network.Contains(net.ParseIP(l.Address)) {
+				logs = append(logs, l)
+			}
+		}
+		if len(logs) > limit || len(page) < batch {
+			break
+		}
+		beforeID = page[len(page)-1].ID
+		if scanned >= logScanLimit {
+			return logs, shimmie.Cursor{ID: beforeID}.Encode(), nil
+		}
+	}
+
+	var next string
+	if len(logs) > limit {
+		logs = logs[:limit]
+		next = shimmie.Cursor{ID: logs[limit-1].ID}.Encode()
+	}
+	return logs, next, nil
+}
+
+// queryLogs returns up to n log entries that match where and have an ID less
+// than beforeID, if it is not zero, newest first.
+func (db *DB) queryLogs(ctx context.Context, where []string, args []interface{}, beforeID int64, n int) (logs []shimmie.SCoreLog, err error) {
+	where = append([]string(nil), where...)
+	args = append([]interface{}(nil), args...)
+	if beforeID != 0 {
+		where = append(where, "id < ?")
+		args = append(args, beforeID)
+	}
+	query := "SELECT " + scoreLogColumns + "\nFROM score_log\n"
+	if len(where) != 0 {
+		query += "WHERE " + strings.Join(where, "\n  AND ") + "\n"
+	}
+	query += "ORDER BY id DESC\nLIMIT ?"
+	args = append(args, n)
+
+	rows, err := db.QueryContext(ctx, db.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := rows.Close(); err == nil {
+			err = cerr
+			return
+		}
+	}()
+
+	for rows.Next() {
+		var l shimmie.SCoreLog
+		err := rows.Scan(
+			&l.ID,
+			&l.DateSent,
+			&l.Section,
+			&l.Username,
+			&l.Address,
+			&l.Priority,
+			&l.Message,
+		)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, l)
+	}
+	return logs, rows.Err()
+}
+
+// addressPrefix returns the leading octets that all the IPv4 addresses of
+// network share in their textual form, e.g. "10.1." for 10.1.0.0/16. It
+// returns an empty string for IPv6 networks, which have many textual forms,
+// and for networks shorter than /8.
+func addressPrefix(network *net.IPNet) string {
+	ip := network.IP.To4()
+	if ip == nil {
+		return ""
+	}
+	ones, _ := network.Mask.Size()
+	octets := ones / 8
+	if octets > 3 {
+		// The last octet has no trailing dot.
+		octets = 3
+	}
+	var prefix string
+	for i := 0; i < octets; i++ {
+		prefix += fmt.Sprintf("%d.", ip[i])
+	}
+	return prefix
+}
+
+// escapeLike escapes the wildcards of s for a LIKE pattern that uses ! as
+// the escape character. Unlike backslash, ! has the same meaning in the
+// string literals of all the dialects.
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
+
+const scoreLogColumns = "id, date_sent, section, username, address, priority, message"
+
 const scoreLogInsertStmt = `
-INSERT score_log
-SET
-  date_sent=?,
-  section=?,
-  username=?,
-  address=?,
-  priority=?,
-  message=?
+INSERT INTO score_log (date_sent, section, username, address, priority, message)
+VALUES (?, ?, ?, ?, ?, ?)
 `
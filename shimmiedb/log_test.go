@@ -0,0 +1,36 @@
+package shimmiedb
+
+import (
+	"net"
+	"testing"
+)
+
+func TestAddressPrefix(t *testing.T) {
+	var tests = []struct {
+		cidr   string
+		prefix string
+	}{
+		{"10.0.0.0/7", ""},
+		{"10.0.0.0/8", "10."},
+		{"192.168.0.0/16", "192.168."},
+		{"192.168.4.0/22", "192.168."},
+		{"192.168.4.0/24", "192.168.4."},
+		{"192.168.4.7/32", "192.168.4."},
+		{"2001:db8::/32", ""},
+	}
+	for _, tt := range tests {
+		_, network, err := net.ParseCIDR(tt.cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := addressPrefix(network), tt.prefix; got != want {
+			t.Errorf("addressPrefix(%q) = %q, want %q", tt.cidr, got, want)
+		}
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	if got, want := escapeLike("100% of_it!"), "100!% of!_it!!"; got != want {
+		t.Errorf("escapeLike = %q, want %q", got, want)
+	}
+}
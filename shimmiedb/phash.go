@@ -0,0 +1,101 @@
+package shimmiedb
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/kusubooru/shimmie"
+)
+
+// SetImagePHash stores the perceptual hash of an image, replacing its
+// previous one. Hashes are stored as signed integers with the same bits.
+func (db *DB) SetImagePHash(ctx context.Context, imageID int64, phash uint64) error {
+	return Tx(ctx, db.DB, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, db.rebind(phashDeleteStmt), imageID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, db.rebind(phashInsertStmt), imageID, int64(phash))
+		return err
+	})
+}
+
+// GetImagePHash returns the perceptual hash of an image or sql.ErrNoRows if
+// it has none.
+func (db *DB) GetImagePHash(ctx context.Context, imageID int64) (uint64, error) {
+	var phash int64
+	if err := db.QueryRowContext(ctx, db.rebind(phashGetQuery), imageID).Scan(&phash); err != nil {
+		return 0, err
+	}
+	return uint64(phash), nil
+}
+
+// ListImagePHashes returns the perceptual hashes of the images in ascending
+// order of image ID.
+func (db *DB) ListImagePHashes(ctx context.Context, limit int, cursor string) ([]shimmie.ImagePHash, string, error) {
+	c, err := shimmie.DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	limit = pageLimit(limit)
+
+	query := "SELECT image_id, phash\nFROM image_phashes"
+	var args []interface{}
+	if c != nil {
+		query += "\nWHERE image_id > ?"
+		args = append(args, c.ID)
+	}
+	query += "\nORDER BY image_id\nLIMIT ?"
+	// Fetch one extra hash to find out if there is a next page.
+	args = append(args, limit+1)
+
+	rows, err := db.QueryContext(ctx, db.rebind(query), args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() {
+		if cerr := rows.Close(); err == nil {
+			err = cerr
+			return
+		}
+	}()
+
+	var phashes []shimmie.ImagePHash
+	for rows.Next() {
+		var (
+			p     shimmie.ImagePHash
+			phash int64
+		)
+		if err := rows.Scan(&p.ImageID, &phash); err != nil {
+			return nil, "", err
+		}
+		p.PHash = uint64(phash)
+		phashes = append(phashes, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(phashes) > limit {
+		phashes = phashes[:limit]
+		next = shimmie.Cursor{ID: phashes[limit-1].ImageID}.Encode()
+	}
+	return phashes, next, nil
+}
+
+const (
+	phashDeleteStmt = `
+DELETE
+FROM image_phashes
+WHERE image_id = ?
+`
+	phashInsertStmt = `
+INSERT INTO image_phashes (image_id, phash)
+VALUES (?, ?)
+`
+	phashGetQuery = `
+SELECT phash
+FROM image_phashes
+WHERE image_id = ?
+`
+)
@@ -1,44 +1,33 @@
 package shimmiedb
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
+	"strings"
 
 	"github.com/kusubooru/shimmie"
 )
 
 // CreatePM inserts a new private message.
-func (db *DB) CreatePM(pm *shimmie.PM) error {
+func (db *DB) CreatePM(ctx context.Context, pm *shimmie.PM) error {
 	if pm == nil {
 		return fmt.Errorf("cannot create nil private message")
 	}
-	var query = `
-	INSERT INTO private_message (
-      from_id,
-      from_ip,
-      to_id,
-      sent_date,
-      subject,
-      message,
-      is_read
-	)
-	VALUES ( ?, ?, ?, ?, ?, ?, ? )
-	`
-	stmt, err := db.Prepare(query)
-	if err != nil {
-		return err
-	}
-	defer func() {
-		if cerr := stmt.Close(); err == nil {
-			err = cerr
-			return
-		}
-	}()
+	return Tx(ctx, db.DB, func(tx *sql.Tx) error {
+		return db.createPM(ctx, tx, pm)
+	})
+}
 
+// createPM inserts pm into the private_message table of Shimmie, links
+// replies to their parent in pm_states and adds flagged messages to pm_flags.
+func (db *DB) createPM(ctx context.Context, tx *sql.Tx, pm *shimmie.PM) error {
 	isRead := "N"
 	if pm.IsRead {
 		isRead = "Y"
 	}
-	res, err := stmt.Exec(
+	d := db.sqlDialect()
+	id, err := d.insert(ctx, tx, d.rebind(pmInsertStmt),
 		pm.FromID,
 		pm.FromIP,
 		pm.ToID,
@@ -50,31 +39,33 @@ func (db *DB) CreatePM(pm *shimmie.PM) error {
 	if err != nil {
 		return err
 	}
-
-	id, err := res.LastInsertId()
-	if err != nil {
-		return err
-	}
 	pm.ID = id
 
+	if pm.ParentID != 0 {
+		if _, err := tx.ExecContext(ctx, db.rebind(pmStateInsertParentStmt), pm.ID, pm.ParentID); err != nil {
+			return err
+		}
+	}
+	if pm.Flagged {
+		if _, err := tx.ExecContext(ctx, db.rebind(pmFlagInsertStmt), pm.ID); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 // GetPMs returns the private messages exchanged from a user to
 // another user. The arguments from and to are user names and either or
-// both can be left empty.
-func (db *DB) GetPMs(from, to string, choice shimmie.PMChoice) ([]*shimmie.PM, error) {
-	var query = `
-SELECT 
-    from_user.name from_user, to_user.name to_user, pm.*
-FROM
-    private_message pm
-        JOIN
-    users from_user ON pm.from_id = from_user.id
-        JOIN
-    users to_user ON pm.to_id = to_user.id
-WHERE 1=1
-	`
+// both can be left empty. Messages that from has deleted on their side are
+// left out when from is given and the same goes for to.
+func (db *DB) GetPMs(ctx context.Context, from, to string, choice shimmie.PMChoice) ([]*shimmie.PM, error) {
+	var query = "SELECT " + pmColumns + "\nFROM " + pmJoins + "\nWHERE 1=1\n"
+	if from != "" {
+		query += " AND " + pmNotDeletedBySender + "\n"
+	}
+	if to != "" {
+		query += " AND " + pmNotDeletedByRecipient + "\n"
+	}
 
 	// gather filters
 	var m = make(map[string]interface{})
@@ -100,7 +91,7 @@ WHERE 1=1
 	}
 
 	// make query
-	rows, err := db.Query(query+filters, values...)
+	rows, err := db.QueryContext(ctx, db.rebind(query+filters), values...)
 	if err != nil {
 		return nil, err
 	}
@@ -112,28 +103,304 @@ WHERE 1=1
 	}()
 
 	var pms []*shimmie.PM
-	var isRead string
 	for rows.Next() {
-		pm := new(shimmie.PM)
-		err = rows.Scan(
-			&pm.FromUser,
-			&pm.ToUser,
-			&pm.ID,
-			&pm.FromID,
-			&pm.FromIP,
-			&pm.ToID,
-			&pm.SentDate,
-			&pm.Subject,
-			&pm.Message,
-			&isRead,
-		)
+		pm, err := scanPM(rows)
 		if err != nil {
 			return nil, err
 		}
-		if isRead == "Y" {
-			pm.IsRead = true
+		pms = append(pms, pm)
+	}
+	return pms, rows.Err()
+}
+
+// scanPM scans a row selected with pmColumns.
+func scanPM(row scanner) (*shimmie.PM, error) {
+	var (
+		pm       shimmie.PM
+		isRead   string
+		parentID sql.NullInt64
+	)
+	err := row.Scan(
+		&pm.FromUser,
+		&pm.ToUser,
+		&pm.ID,
+		&pm.FromID,
+		&pm.FromIP,
+		&pm.ToID,
+		&pm.SentDate,
+		&pm.Subject,
+		&pm.Message,
+		&isRead,
+		&parentID,
+		&pm.Flagged,
+	)
+	if err != nil {
+		return nil, err
+	}
+	pm.IsRead = isRead == "Y"
+	pm.ParentID = parentID.Int64
+	return &pm, nil
+}
+
+// MarkPMRead marks a private message that was received by userID as read. It
+// returns sql.ErrNoRows if userID has not received the message or has
+// deleted it.
+func (db *DB) MarkPMRead(ctx context.Context, id, userID int64) error {
+	var isRead string
+	err := db.QueryRowContext(ctx, db.rebind(pmGetReceivedQuery), id, userID).Scan(&isRead)
+	if err != nil {
+		return err
+	}
+	if isRead == "Y" {
+		return nil
+	}
+	_, err = db.ExecContext(ctx, db.rebind(pmMarkReadStmt), id)
+	return err
+}
+
+// DeletePM deletes a private message for userID only. The message stays
+// visible to the other side until they delete it too. It returns
+// sql.ErrNoRows if userID has not sent or received the message or has
+// already deleted it.
+func (db *DB) DeletePM(ctx context.Context, id, userID int64) error {
+	return Tx(ctx, db.DB, func(tx *sql.Tx) error {
+		var fromID, toID int64
+		err := tx.QueryRowContext(ctx, db.rebind(pmGetVisibleQuery), id, userID, userID).Scan(&fromID, &toID)
+		if err != nil {
+			return err
+		}
+		var set []string
+		if fromID == userID {
+			set = append(set, "deleted_by_sender = TRUE")
+		}
+		if toID == userID {
+			set = append(set, "deleted_by_recipient = TRUE")
+		}
+		if _, err := tx.ExecContext(ctx, db.rebind(db.sqlDialect().insertIgnore(pmStateInsertStmt)), id); err != nil {
+			return err
+		}
+		query := "UPDATE pm_states SET " + strings.Join(set, ", ") + " WHERE pm_id = ?"
+		_, err = tx.ExecContext(ctx, db.rebind(query), id)
+		return err
+	})
+}
+
+// ReplyPM sends reply as an answer to the private message parentID with the
+// same safeguards as SendPM. The sender of the reply must be a side of the
+// parent message and the reply is sent to the other side. If the subject of
+// the reply is empty, it is derived from the subject of the parent. It
+// returns sql.ErrNoRows if the sender of the reply is not a side of the
+// parent message.
+func (db *DB) ReplyPM(ctx context.Context, parentID int64, reply *shimmie.PM) error {
+	if reply == nil {
+		return fmt.Errorf("cannot create nil private message")
+	}
+	var fromID, toID int64
+	var subject string
+	err := db.QueryRowContext(ctx, db.rebind(pmGetParentQuery), parentID, reply.FromID, reply.FromID).Scan(&fromID, &toID, &subject)
+	if err != nil {
+		return err
+	}
+	reply.ToID = fromID
+	if reply.FromID == fromID {
+		reply.ToID = toID
+	}
+	if reply.Subject == "" {
+		reply.Subject = shimmie.ReplySubject(subject)
+	}
+	reply.ParentID = parentID
+	return db.SendPM(ctx, reply)
+}
+
+// GetThread returns the conversation between userID and otherID, newest
+// message first, leaving out the messages that userID has deleted. Results
+// are paginated with limit and the cursor returned by the previous call.
+func (db *DB) GetThread(ctx context.Context, userID, otherID int64, limit int, cursor string) ([]*shimmie.PM, string, error) {
+	c, err := shimmie.DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	limit = pageLimit(limit)
+
+	query := "SELECT " + pmColumns + "\nFROM " + pmJoins + "\nWHERE " + pmThreadWhere
+	args := []interface{}{userID, otherID, otherID, userID}
+	if c != nil {
+		if c.Time == nil {
+			return nil, "", shimmie.ErrInvalidCursor
+		}
+		query += "\n  AND (pm.sent_date < ? OR (pm.sent_date = ? AND pm.id < ?))"
+		args = append(args, c.Time, c.Time, c.ID)
+	}
+	query += "\nORDER BY pm.sent_date DESC, pm.id DESC\nLIMIT ?"
+	// Fetch one extra message to find out if there is a next page.
+	args = append(args, limit+1)
+
+	rows, err := db.QueryContext(ctx, db.rebind(query), args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() {
+		if cerr := rows.Close(); err == nil {
+			err = cerr
+			return
+		}
+	}()
+
+	var pms []*shimmie.PM
+	for rows.Next() {
+		pm, err := scanPM(rows)
+		if err != nil {
+			return nil, "", err
 		}
 		pms = append(pms, pm)
 	}
-	return pms, err
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(pms) > limit {
+		pms = pms[:limit]
+		last := pms[limit-1]
+		next = shimmie.Cursor{ID: last.ID, Time: &last.SentDate}.Encode()
+	}
+	return pms, next, nil
+}
+
+// PMInboxSummary returns, per sender, how many messages userID has received
+// and not deleted, how many of them are unread and a preview of the latest
+// one. Senders with the most recent messages come first.
+func (db *DB) PMInboxSummary(ctx context.Context, userID int64) (*shimmie.PMInbox, error) {
+	rows, err := db.QueryContext(ctx, db.rebind(pmInboxSummaryQuery), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := rows.Close(); err == nil {
+			err = cerr
+			return
+		}
+	}()
+
+	inbox := &shimmie.PMInbox{Senders: []shimmie.PMSenderSummary{}}
+	for rows.Next() {
+		var (
+			s       shimmie.PMSenderSummary
+			message string
+		)
+		err := rows.Scan(
+			&s.FromID,
+			&s.FromUser,
+			&s.Total,
+			&s.Unread,
+			&s.LatestID,
+			&s.LatestDate,
+			&s.Subject,
+			&message,
+		)
+		if err != nil {
+			return nil, err
+		}
+		s.Preview = shimmie.PMPreview(message)
+		inbox.Total += s.Total
+		inbox.Unread += s.Unread
+		inbox.Senders = append(inbox.Senders, s)
+	}
+	return inbox, rows.Err()
 }
+
+const (
+	pmInsertStmt = `
+	INSERT INTO private_message (
+      from_id,
+      from_ip,
+      to_id,
+      sent_date,
+      subject,
+      message,
+      is_read
+	)
+	VALUES ( ?, ?, ?, ?, ?, ?, ? )
+	`
+	pmColumns = `
+    from_user.name from_user, to_user.name to_user,
+    pm.id, pm.from_id, pm.from_ip, pm.to_id, pm.sent_date, pm.subject, pm.message, pm.is_read,
+    st.parent_id, fl.pm_id IS NOT NULL`
+	// pmJoins joins the state that this package keeps for a message in
+	// pm_states and pm_flags. Messages sent by Shimmie itself have no state,
+	// which is the same as not being a reply, deleted or flagged.
+	pmJoins = `
+    private_message pm
+        JOIN
+    users from_user ON pm.from_id = from_user.id
+        JOIN
+    users to_user ON pm.to_id = to_user.id
+        LEFT JOIN
+    pm_states st ON st.pm_id = pm.id
+        LEFT JOIN
+    pm_flags fl ON fl.pm_id = pm.id`
+	pmNotDeletedBySender    = `COALESCE(st.deleted_by_sender, FALSE) = FALSE`
+	pmNotDeletedByRecipient = `COALESCE(st.deleted_by_recipient, FALSE) = FALSE`
+	pmThreadWhere           = `
+    ((pm.from_id = ? AND pm.to_id = ? AND ` + pmNotDeletedBySender + `) OR
+     (pm.from_id = ? AND pm.to_id = ? AND ` + pmNotDeletedByRecipient + `))`
+	pmGetVisibleQuery = `
+SELECT pm.from_id, pm.to_id
+FROM private_message pm
+    LEFT JOIN
+pm_states st ON st.pm_id = pm.id
+WHERE pm.id = ?
+  AND ((pm.from_id = ? AND ` + pmNotDeletedBySender + `) OR
+       (pm.to_id = ? AND ` + pmNotDeletedByRecipient + `))
+`
+	pmGetParentQuery = `
+SELECT from_id, to_id, subject
+FROM private_message
+WHERE id = ?
+  AND (from_id = ? OR to_id = ?)
+`
+	pmGetReceivedQuery = `
+SELECT pm.is_read
+FROM private_message pm
+    LEFT JOIN
+pm_states st ON st.pm_id = pm.id
+WHERE pm.id = ?
+  AND pm.to_id = ?
+  AND ` + pmNotDeletedByRecipient + `
+`
+	// pmInboxSummaryQuery aggregates per sender using the
+	// private_message__inbox index and then joins the latest message of each
+	// sender by its ID.
+	pmInboxSummaryQuery = `
+SELECT s.from_id, u.name, s.total, s.unread, pm.id, pm.sent_date, pm.subject, pm.message
+FROM
+    (SELECT
+        pm.from_id,
+        COUNT(*) AS total,
+        SUM(CASE WHEN pm.is_read = 'N' THEN 1 ELSE 0 END) AS unread,
+        MAX(pm.id) AS latest_id
+    FROM private_message pm
+        LEFT JOIN
+    pm_states st ON st.pm_id = pm.id
+    WHERE pm.to_id = ? AND ` + pmNotDeletedByRecipient + `
+    GROUP BY pm.from_id) s
+        JOIN
+    private_message pm ON pm.id = s.latest_id
+        JOIN
+    users u ON u.id = s.from_id
+ORDER BY pm.sent_date DESC, pm.id DESC
+`
+	pmMarkReadStmt = `
+UPDATE private_message
+SET is_read = 'Y'
+WHERE id = ?
+`
+	pmStateInsertStmt = `
+INSERT INTO pm_states (pm_id)
+VALUES (?)
+`
+	pmStateInsertParentStmt = `
+INSERT INTO pm_states (pm_id, parent_id)
+VALUES (?, ?)
+`
+)
@@ -0,0 +1,269 @@
+package shimmiedb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/kusubooru/shimmie"
+)
+
+// SendPM validates pm with shimmie.CheckPM and inserts it unless the
+// recipient has blocked the sender or the sender has exceeded their rate
+// limit. Messages with too many links are stored flagged for review. SentDate
+// is always set to the current time so that the rate limit cannot be escaped
+// with a date in the past.
+func (db *DB) SendPM(ctx context.Context, pm *shimmie.PM) error {
+	if pm == nil {
+		return fmt.Errorf("cannot create nil private message")
+	}
+	if err := shimmie.CheckPM(pm); err != nil {
+		return err
+	}
+	now := time.Now()
+	pm.SentDate = now
+	return Tx(ctx, db.DB, func(tx *sql.Tx) error {
+		// Lock the sender so that concurrent messages from them are counted
+		// one after the other and cannot all pass the rate limit. The lock
+		// comes first so that the snapshot of the transaction, which MySQL
+		// takes at its first plain read, includes the messages of the ones
+		// that held it before. A missing sender is left for the insert to
+		// fail.
+		var fromID int64
+		err := tx.QueryRowContext(ctx, db.rebind(pmSenderLockQuery+db.sqlDialect().forUpdate()), pm.FromID).Scan(&fromID)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+
+		var blocked int
+		if err := tx.QueryRowContext(ctx, db.rebind(pmBlockCountQuery), pm.ToID, pm.FromID).Scan(&blocked); err != nil {
+			return err
+		}
+		if blocked != 0 {
+			return shimmie.ErrPMBlocked
+		}
+
+		limit, err := db.getPMRateLimit(ctx, tx, pm.FromID)
+		if err != nil {
+			return err
+		}
+		if limit.Messages > 0 {
+			var sent int
+			err := tx.QueryRowContext(ctx, db.rebind(pmSentCountQuery), pm.FromID, now.Add(-limit.Period)).Scan(&sent)
+			if err != nil {
+				return err
+			}
+			if sent >= limit.Messages {
+				return shimmie.ErrPMRateLimited
+			}
+		}
+		return db.createPM(ctx, tx, pm)
+	})
+}
+
+// BlockPMSender prevents blockedID from sending private messages to userID.
+// Blocking a user that is already blocked has no effect.
+func (db *DB) BlockPMSender(ctx context.Context, userID, blockedID int64) error {
+	return Tx(ctx, db.DB, func(tx *sql.Tx) error {
+		var blocked int
+		if err := tx.QueryRowContext(ctx, db.rebind(pmBlockCountQuery), userID, blockedID).Scan(&blocked); err != nil {
+			return err
+		}
+		if blocked != 0 {
+			return nil
+		}
+		_, err := tx.ExecContext(ctx, db.rebind(pmBlockInsertStmt), userID, blockedID, time.Now())
+		return err
+	})
+}
+
+// UnblockPMSender allows blockedID to send private messages to userID again.
+func (db *DB) UnblockPMSender(ctx context.Context, userID, blockedID int64) error {
+	_, err := db.ExecContext(ctx, db.rebind(pmBlockDeleteStmt), userID, blockedID)
+	return err
+}
+
+// GetPMBlocks returns the IDs of the users that userID has blocked.
+func (db *DB) GetPMBlocks(ctx context.Context, userID int64) ([]int64, error) {
+	rows, err := db.QueryContext(ctx, db.rebind(pmBlocksGetQuery), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := rows.Close(); err == nil {
+			err = cerr
+			return
+		}
+	}()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// SetPMRateLimit sets the rate limit of a user, replacing
+// shimmie.DefaultPMRateLimit for them.
+func (db *DB) SetPMRateLimit(ctx context.Context, userID int64, limit shimmie.PMRateLimit) error {
+	return Tx(ctx, db.DB, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, db.rebind(pmRateLimitDeleteStmt), userID); err != nil {
+			return err
+		}
+		seconds := int64(limit.Period / time.Second)
+		_, err := tx.ExecContext(ctx, db.rebind(pmRateLimitInsertStmt), userID, limit.Messages, seconds)
+		return err
+	})
+}
+
+// GetPMRateLimit returns the rate limit of a user or
+// shimmie.DefaultPMRateLimit if they do not have one.
+func (db *DB) GetPMRateLimit(ctx context.Context, userID int64) (shimmie.PMRateLimit, error) {
+	return db.getPMRateLimit(ctx, db.DB, userID)
+}
+
+func (db *DB) getPMRateLimit(ctx context.Context, q execQueryer, userID int64) (shimmie.PMRateLimit, error) {
+	var (
+		limit   shimmie.PMRateLimit
+		seconds int64
+	)
+	err := q.QueryRowContext(ctx, db.rebind(pmRateLimitGetQuery), userID).Scan(&limit.Messages, &seconds)
+	if err == sql.ErrNoRows {
+		return shimmie.DefaultPMRateLimit, nil
+	}
+	if err != nil {
+		return limit, err
+	}
+	limit.Period = time.Duration(seconds) * time.Second
+	return limit, nil
+}
+
+// ListFlaggedPMs returns the private messages that are flagged for review,
+// newest first.
+func (db *DB) ListFlaggedPMs(ctx context.Context, limit int, cursor string) ([]*shimmie.PM, string, error) {
+	c, err := shimmie.DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	limit = pageLimit(limit)
+
+	query := "SELECT " + pmColumns + "\nFROM " + pmJoins + "\nWHERE fl.pm_id IS NOT NULL"
+	var args []interface{}
+	if c != nil {
+		query += " AND pm.id < ?"
+		args = append(args, c.ID)
+	}
+	query += "\nORDER BY pm.id DESC\nLIMIT ?"
+	// Fetch one extra message to find out if there is a next page.
+	args = append(args, limit+1)
+
+	rows, err := db.QueryContext(ctx, db.rebind(query), args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() {
+		if cerr := rows.Close(); err == nil {
+			err = cerr
+			return
+		}
+	}()
+
+	var pms []*shimmie.PM
+	for rows.Next() {
+		pm, err := scanPM(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		pms = append(pms, pm)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(pms) > limit {
+		pms = pms[:limit]
+		next = shimmie.Cursor{ID: pms[limit-1].ID}.Encode()
+	}
+	return pms, next, nil
+}
+
+// UnflagPM clears the review flag of a private message once it has been
+// reviewed. It returns sql.ErrNoRows if the message does not exist.
+func (db *DB) UnflagPM(ctx context.Context, id int64) error {
+	var n int
+	if err := db.QueryRowContext(ctx, db.rebind(pmCountQuery), id).Scan(&n); err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	_, err := db.ExecContext(ctx, db.rebind(pmUnflagStmt), id)
+	return err
+}
+
+const (
+	pmBlockCountQuery = `
+SELECT COUNT(*)
+FROM pm_blocks
+WHERE user_id = ? AND blocked_id = ?
+`
+	pmBlockInsertStmt = `
+INSERT INTO pm_blocks (user_id, blocked_id, created)
+VALUES (?, ?, ?)
+`
+	pmBlockDeleteStmt = `
+DELETE
+FROM pm_blocks
+WHERE user_id = ? AND blocked_id = ?
+`
+	pmBlocksGetQuery = `
+SELECT blocked_id
+FROM pm_blocks
+WHERE user_id = ?
+ORDER BY blocked_id
+`
+	pmSenderLockQuery = `
+SELECT id
+FROM users
+WHERE id = ?
+`
+	pmSentCountQuery = `
+SELECT COUNT(*)
+FROM private_message
+WHERE from_id = ? AND sent_date >= ?
+`
+	pmRateLimitGetQuery = `
+SELECT messages, period_seconds
+FROM pm_rate_limits
+WHERE user_id = ?
+`
+	pmRateLimitDeleteStmt = `
+DELETE
+FROM pm_rate_limits
+WHERE user_id = ?
+`
+	pmRateLimitInsertStmt = `
+INSERT INTO pm_rate_limits (user_id, messages, period_seconds)
+VALUES (?, ?, ?)
+`
+	pmCountQuery = `
+SELECT COUNT(*)
+FROM private_message
+WHERE id = ?
+`
+	pmFlagInsertStmt = `
+INSERT INTO pm_flags (pm_id)
+VALUES (?)
+`
+	pmUnflagStmt = `
+DELETE
+FROM pm_flags
+WHERE pm_id = ?
+`
+)
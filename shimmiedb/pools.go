@@ -0,0 +1,547 @@
+package shimmiedb
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/kusubooru/shimmie"
+)
+
+// CreatePool creates a new pool owned by p.UserID. It sets the ID, Date and
+// LastUpdated time of p and returns shimmie.ErrPoolTitleTaken if another
+// pool has the same title, ignoring case.
+func (db *DB) CreatePool(ctx context.Context, p *shimmie.Pool) error {
+	title := strings.TrimSpace(p.Title)
+	if title == "" {
+		return shimmie.ErrPoolTitleEmpty
+	}
+	return Tx(ctx, db.DB, func(tx *sql.Tx) error {
+		if err := db.checkPoolTitle(ctx, tx, 0, title); err != nil {
+			return err
+		}
+		now := time.Now()
+		d := db.sqlDialect()
+		id, err := d.insert(ctx, tx, d.rebind(poolInsertStmt), p.UserID, p.Public, title, p.Description, now, now)
+		if err != nil {
+			return err
+		}
+		p.ID, p.Title, p.Date, p.LastUpdated, p.Posts = id, title, now, now, 0
+		return nil
+	})
+}
+
+// GetPool returns a pool or sql.ErrNoRows if it does not exist.
+func (db *DB) GetPool(ctx context.Context, id int64) (*shimmie.Pool, error) {
+	return scanPool(db.QueryRowContext(ctx, db.rebind(poolGetQuery), id))
+}
+
+// UpdatePool changes the title, description and visibility of a pool. It
+// returns sql.ErrNoRows if the pool does not exist.
+func (db *DB) UpdatePool(ctx context.Context, p *shimmie.Pool) error {
+	title := strings.TrimSpace(p.Title)
+	if title == "" {
+		return shimmie.ErrPoolTitleEmpty
+	}
+	return Tx(ctx, db.DB, func(tx *sql.Tx) error {
+		if err := db.checkPool(ctx, tx, p.ID); err != nil {
+			return err
+		}
+		if err := db.checkPoolTitle(ctx, tx, p.ID, title); err != nil {
+			return err
+		}
+		now := time.Now()
+		if _, err := tx.ExecContext(ctx, db.rebind(poolUpdateStmt), p.Public, title, p.Description, now, p.ID); err != nil {
+			return err
+		}
+		p.Title, p.LastUpdated = title, now
+		return nil
+	})
+}
+
+// DeletePool deletes a pool along with its history. The images of the pool
+// are not deleted. It returns sql.ErrNoRows if the pool does not exist.
+func (db *DB) DeletePool(ctx context.Context, id int64) error {
+	res, err := db.ExecContext(ctx, db.rebind(poolDeleteStmt), id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListPools returns the pools, newest first.
+func (db *DB) ListPools(ctx context.Context, limit int, cursor string) ([]shimmie.Pool, string, error) {
+	c, err := shimmie.DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	limit = pageLimit(limit)
+
+	query := poolsQuery
+	var args []interface{}
+	if c != nil {
+		query += "\nWHERE p.id < ?"
+		args = append(args, c.ID)
+	}
+	query += "\nORDER BY p.id DESC\nLIMIT ?"
+	// Fetch one extra pool to find out if there is a next page.
+	args = append(args, limit+1)
+
+	pools, err := db.queryPools(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	var next string
+	if len(pools) > limit {
+		pools = pools[:limit]
+		next = shimmie.Cursor{ID: pools[limit-1].ID}.Encode()
+	}
+	return pools, next, nil
+}
+
+// ImagePools returns the pools that contain an image, ordered by ID.
+func (db *DB) ImagePools(ctx context.Context, imageID int64) ([]shimmie.Pool, error) {
+	return db.queryPools(ctx, poolsQuery+"\nWHERE p.id IN (SELECT pool_id FROM pool_images WHERE image_id = ?)\nORDER BY p.id", imageID)
+}
+
+func (db *DB) queryPools(ctx context.Context, query string, args ...interface{}) (pools []shimmie.Pool, err error) {
+	rows, err := db.QueryContext(ctx, db.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := rows.Close(); err == nil {
+			err = cerr
+			return
+		}
+	}()
+
+	for rows.Next() {
+		p, err := scanPool(rows)
+		if err != nil {
+			return nil, err
+		}
+		pools = append(pools, *p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return pools, nil
+}
+
+func scanPool(row scanner) (*shimmie.Pool, error) {
+	var (
+		p           shimmie.Pool
+		userName    sql.NullString
+		description sql.NullString
+		lastUpdated sql.NullTime
+	)
+	err := row.Scan(&p.ID, &p.UserID, &userName, &p.Public, &p.Title, &description, &p.Date, &p.Posts, &lastUpdated)
+	if err != nil {
+		return nil, err
+	}
+	p.UserName, p.Description, p.LastUpdated = userName.String, description.String, lastUpdated.Time
+	return &p, nil
+}
+
+// checkPool returns sql.ErrNoRows if a pool does not exist.
+func (db *DB) checkPool(ctx context.Context, q execQueryer, id int64) error {
+	var n int
+	if err := q.QueryRowContext(ctx, db.rebind(poolCountQuery), id).Scan(&n); err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// checkPoolTitle returns shimmie.ErrPoolTitleTaken if a pool other than id
+// has title.
+func (db *DB) checkPoolTitle(ctx context.Context, q execQueryer, id int64, title string) error {
+	var n int
+	if err := q.QueryRowContext(ctx, db.rebind(poolTitleCountQuery), title, id).Scan(&n); err != nil {
+		return err
+	}
+	if n != 0 {
+		return shimmie.ErrPoolTitleTaken
+	}
+	return nil
+}
+
+// AddPoolImages appends images to the end of a pool and records them in the
+// history of the pool. Images that are already in the pool are skipped. It
+// returns sql.ErrNoRows if the pool or one of the images does not exist.
+func (db *DB) AddPoolImages(ctx context.Context, poolID, userID int64, imageIDs []int64) error {
+	return Tx(ctx, db.DB, func(tx *sql.Tx) error {
+		if err := db.checkPool(ctx, tx, poolID); err != nil {
+			return err
+		}
+		var order int
+		if err := tx.QueryRowContext(ctx, db.rebind(poolMaxOrderQuery), poolID).Scan(&order); err != nil {
+			return err
+		}
+		var added []int64
+		for _, id := range imageIDs {
+			var n int
+			if err := tx.QueryRowContext(ctx, db.rebind(imageCountQuery), id).Scan(&n); err != nil {
+				return err
+			}
+			if n == 0 {
+				return sql.ErrNoRows
+			}
+			if err := tx.QueryRowContext(ctx, db.rebind(poolImageCountQuery), poolID, id).Scan(&n); err != nil {
+				return err
+			}
+			if n != 0 {
+				continue
+			}
+			order++
+			if _, err := tx.ExecContext(ctx, db.rebind(poolImageInsertStmt), poolID, id, order); err != nil {
+				return err
+			}
+			added = append(added, id)
+		}
+		return db.poolChanged(ctx, tx, poolID, userID, shimmie.PoolAdd, added)
+	})
+}
+
+// RemovePoolImages removes images from a pool and records them in the
+// history of the pool. Images that are not in the pool are skipped. It
+// returns sql.ErrNoRows if the pool does not exist.
+func (db *DB) RemovePoolImages(ctx context.Context, poolID, userID int64, imageIDs []int64) error {
+	return Tx(ctx, db.DB, func(tx *sql.Tx) error {
+		if err := db.checkPool(ctx, tx, poolID); err != nil {
+			return err
+		}
+		var removed []int64
+		for _, id := range imageIDs {
+			res, err := tx.ExecContext(ctx, db.rebind(poolImageDeleteStmt), poolID, id)
+			if err != nil {
+				return err
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if n != 0 {
+				removed = append(removed, id)
+			}
+		}
+		return db.poolChanged(ctx, tx, poolID, userID, shimmie.PoolRemove, removed)
+	})
+}
+
+// poolChanged updates the number of images and the last update time of a
+// pool and records the images that were changed in its history.
+func (db *DB) poolChanged(ctx context.Context, tx *sql.Tx, poolID, userID int64, action shimmie.PoolAction, imageIDs []int64) error {
+	if len(imageIDs) == 0 {
+		return nil
+	}
+	var count int
+	if err := tx.QueryRowContext(ctx, db.rebind(poolImagesCountQuery), poolID).Scan(&count); err != nil {
+		return err
+	}
+	now := time.Now()
+	if _, err := tx.ExecContext(ctx, db.rebind(poolPostsUpdateStmt), count, now, poolID); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, db.rebind(poolHistoryInsertStmt), poolID, userID, action, shimmie.FormatPoolImages(imageIDs), count, now)
+	return err
+}
+
+// SetPoolOrder moves images, which must be in the pool, to the start of a
+// pool in the given order. The rest of the images keep their order after
+// them. It returns sql.ErrNoRows if the pool does not exist or one of the
+// images is not in the pool.
+func (db *DB) SetPoolOrder(ctx context.Context, poolID int64, imageIDs []int64) error {
+	return Tx(ctx, db.DB, func(tx *sql.Tx) error {
+		if err := db.checkPool(ctx, tx, poolID); err != nil {
+			return err
+		}
+		current, err := poolImageIDs(ctx, tx, db.rebind(poolImageIDsQuery), poolID)
+		if err != nil {
+			return err
+		}
+		order, err := shimmie.ReorderPool(current, imageIDs)
+		if err != nil {
+			return err
+		}
+		for i, id := range order {
+			if _, err := tx.ExecContext(ctx, db.rebind(poolImageOrderStmt), i+1, poolID, id); err != nil {
+				return err
+			}
+		}
+		_, err = tx.ExecContext(ctx, db.rebind(poolLastUpdatedStmt), time.Now(), poolID)
+		return err
+	})
+}
+
+func poolImageIDs(ctx context.Context, tx *sql.Tx, query string, poolID int64) (ids []int64, err error) {
+	rows, err := tx.QueryContext(ctx, query, poolID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := rows.Close(); err == nil {
+			err = cerr
+			return
+		}
+	}()
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// GetPoolImages returns the images of a pool in order. It returns
+// sql.ErrNoRows if the pool does not exist.
+func (db *DB) GetPoolImages(ctx context.Context, poolID int64) (images []shimmie.Image, err error) {
+	if err := db.checkPool(ctx, db.DB, poolID); err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, db.rebind(poolImagesQuery), poolID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := rows.Close(); err == nil {
+			err = cerr
+			return
+		}
+	}()
+
+	for rows.Next() {
+		img, err := scanImage(rows)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, *img)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// PoolNeighbors returns the images before and after an image of a pool, or
+// zero if the image is at the start or end of the pool. It returns
+// sql.ErrNoRows if the image is not in the pool.
+func (db *DB) PoolNeighbors(ctx context.Context, poolID, imageID int64) (prev, next int64, err error) {
+	var order int
+	if err := db.QueryRowContext(ctx, db.rebind(poolImageOrderQuery), poolID, imageID).Scan(&order); err != nil {
+		return 0, 0, err
+	}
+	for _, n := range []struct {
+		query string
+		id    *int64
+	}{
+		{poolPrevImageQuery, &prev},
+		{poolNextImageQuery, &next},
+	} {
+		err := db.QueryRowContext(ctx, db.rebind(n.query), poolID, order, order, imageID).Scan(n.id)
+		if err != nil && err != sql.ErrNoRows {
+			return 0, 0, err
+		}
+	}
+	return prev, next, nil
+}
+
+// ListPoolHistory returns the history of a pool, or of all pools if poolID
+// is zero, newest first.
+func (db *DB) ListPoolHistory(ctx context.Context, poolID int64, limit int, cursor string) (history []shimmie.PoolHistory, next string, err error) {
+	c, err := shimmie.DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	limit = pageLimit(limit)
+
+	var (
+		where []string
+		args  []interface{}
+	)
+	if poolID != 0 {
+		where = append(where, "h.pool_id = ?")
+		args = append(args, poolID)
+	}
+	if c != nil {
+		where = append(where, "h.id < ?")
+		args = append(args, c.ID)
+	}
+	query := poolHistoryQuery
+	if len(where) != 0 {
+		query += "\nWHERE " + strings.Join(where, " AND ")
+	}
+	query += "\nORDER BY h.id DESC\nLIMIT ?"
+	// Fetch one extra entry to find out if there is a next page.
+	args = append(args, limit+1)
+
+	rows, err := db.QueryContext(ctx, db.rebind(query), args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() {
+		if cerr := rows.Close(); err == nil {
+			err = cerr
+			return
+		}
+	}()
+
+	for rows.Next() {
+		var (
+			h        shimmie.PoolHistory
+			userName sql.NullString
+			images   sql.NullString
+		)
+		if err := rows.Scan(&h.ID, &h.PoolID, &h.UserID, &userName, &h.Action, &images, &h.Count, &h.Date); err != nil {
+			return nil, "", err
+		}
+		h.UserName, h.Images = userName.String, shimmie.ParsePoolImages(images.String)
+		history = append(history, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(history) > limit {
+		history = history[:limit]
+		next = shimmie.Cursor{ID: history[limit-1].ID}.Encode()
+	}
+	return history, next, nil
+}
+
+const (
+	poolColumns = `p.id, p.user_id, u.name, p.public, p.title, p.description,
+	p.date, p.posts, p.lastupdated`
+	poolsQuery = `
+SELECT ` + poolColumns + `
+FROM pools AS p
+LEFT JOIN users AS u ON u.id = p.user_id`
+	poolGetQuery = poolsQuery + `
+WHERE p.id = ?
+`
+	poolCountQuery = `
+SELECT COUNT(*)
+FROM pools
+WHERE id = ?
+`
+	poolTitleCountQuery = `
+SELECT COUNT(*)
+FROM pools
+WHERE LOWER(title) = LOWER(?) AND id <> ?
+`
+	poolInsertStmt = `
+INSERT INTO pools (user_id, public, title, description, date, lastupdated)
+VALUES (?, ?, ?, ?, ?, ?)
+`
+	poolUpdateStmt = `
+UPDATE pools
+SET public = ?, title = ?, description = ?, lastupdated = ?
+WHERE id = ?
+`
+	poolDeleteStmt = `
+DELETE
+FROM pools
+WHERE id = ?
+`
+	poolPostsUpdateStmt = `
+UPDATE pools
+SET posts = ?, lastupdated = ?
+WHERE id = ?
+`
+	poolLastUpdatedStmt = `
+UPDATE pools
+SET lastupdated = ?
+WHERE id = ?
+`
+	imageCountQuery = `
+SELECT COUNT(*)
+FROM images
+WHERE id = ?
+`
+	poolMaxOrderQuery = `
+SELECT COALESCE(MAX(image_order), 0)
+FROM pool_images
+WHERE pool_id = ?
+`
+	poolImageCountQuery = `
+SELECT COUNT(*)
+FROM pool_images
+WHERE pool_id = ? AND image_id = ?
+`
+	poolImagesCountQuery = `
+SELECT COUNT(*)
+FROM pool_images
+WHERE pool_id = ?
+`
+	poolImageInsertStmt = `
+INSERT INTO pool_images (pool_id, image_id, image_order)
+VALUES (?, ?, ?)
+`
+	poolImageDeleteStmt = `
+DELETE
+FROM pool_images
+WHERE pool_id = ? AND image_id = ?
+`
+	poolImageIDsQuery = `
+SELECT image_id
+FROM pool_images
+WHERE pool_id = ?
+ORDER BY image_order, image_id
+`
+	poolImageOrderStmt = `
+UPDATE pool_images
+SET image_order = ?
+WHERE pool_id = ? AND image_id = ?
+`
+	poolImagesQuery = `
+SELECT ` + imageColumns + `
+FROM pool_images
+JOIN images ON images.id = pool_images.image_id
+WHERE pool_images.pool_id = ?
+ORDER BY pool_images.image_order, pool_images.image_id
+`
+	poolImageOrderQuery = `
+SELECT image_order
+FROM pool_images
+WHERE pool_id = ? AND image_id = ?
+`
+	poolPrevImageQuery = `
+SELECT image_id
+FROM pool_images
+WHERE pool_id = ? AND (image_order < ? OR (image_order = ? AND image_id < ?))
+ORDER BY image_order DESC, image_id DESC
+LIMIT 1
+`
+	poolNextImageQuery = `
+SELECT image_id
+FROM pool_images
+WHERE pool_id = ? AND (image_order > ? OR (image_order = ? AND image_id > ?))
+ORDER BY image_order, image_id
+LIMIT 1
+`
+	poolHistoryInsertStmt = `
+INSERT INTO pool_history (pool_id, user_id, action, images, count, date)
+VALUES (?, ?, ?, ?, ?, ?)
+`
+	poolHistoryQuery = `
+SELECT h.id, h.pool_id, h.user_id, u.name, h.action, h.images, h.count, h.date
+FROM pool_history AS h
+LEFT JOIN users AS u ON u.id = h.user_id`
+)
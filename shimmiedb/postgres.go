@@ -0,0 +1,297 @@
+package shimmiedb
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+type postgresDialect struct{}
+
+func (postgresDialect) rebind(query string) string { return rebindNumbered(query, "$") }
+func (postgresDialect) like() string               { return "ILIKE" }
+func (postgresDialect) forUpdate() string          { return "FOR UPDATE" }
+func (postgresDialect) createStatements() []string { return postgresCreateStatements }
+func (postgresDialect) alterStatements() []string  { return postgresAlterStatements }
+func (postgresDialect) ignoreAlterErr(error) bool  { return false }
+func (postgresDialect) allTablesQuery() string     { return postgresAllTablesQuery }
+
+func (postgresDialect) open(dataSource string) (*sql.DB, error) {
+	return sql.Open("postgres", dataSource)
+}
+
+func (postgresDialect) ratedImageID() string {
+	return "CAST(SUBSTRING(message FROM '#([0-9]+)') AS INTEGER)"
+}
+
+// insert uses RETURNING since the postgres driver does not support
+// LastInsertId.
+func (postgresDialect) insert(ctx context.Context, db execQueryer, query string, args ...interface{}) (int64, error) {
+	query = strings.TrimRight(query, "; \n\t") + " RETURNING id"
+	var id int64
+	err := db.QueryRowContext(ctx, query, args...).Scan(&id)
+	return id, err
+}
+
+func (postgresDialect) insertIgnore(query string) string {
+	return strings.TrimRight(query, "; \n\t") + " ON CONFLICT DO NOTHING"
+}
+
+func (postgresDialect) truncateTablesStmt(tables []string) string {
+	return "TRUNCATE TABLE " + strings.Join(tables, ", ") + " RESTART IDENTITY CASCADE;"
+}
+
+const postgresAllTablesQuery = `
+	SELECT table_name
+	FROM information_schema.tables
+	WHERE table_schema = current_schema()
+	  AND table_type = 'BASE TABLE';`
+
+var postgresCreateStatements = []string{
+	postgresUsersCreateTableStmt,
+	postgresImagesCreateTableStmt,
+	postgresTagsCreateTableStmt,
+	postgresTagHistoriesCreateTableStmt,
+	postgresImageTagsCreateTableStmt,
+	postgresAliasesCreateTableStmt,
+	postgresPrivateMessageTableStmt,
+	postgresPMStatesCreateTableStmt,
+	postgresScoreLogCreateTableStmt,
+	postgresConfigCreateTableStmt,
+	postgresPMBlocksCreateTableStmt,
+	postgresPMRateLimitsCreateTableStmt,
+	postgresPMFlagsCreateTableStmt,
+	postgresImagePHashesCreateTableStmt,
+	postgresImageBansCreateTableStmt,
+	postgresIPBansCreateTableStmt,
+	postgresPoolsCreateTableStmt,
+	postgresPoolImagesCreateTableStmt,
+	postgresPoolHistoryCreateTableStmt,
+	postgresUserFavoritesCreateTableStmt,
+	postgresNumericScoreVotesCreateTableStmt,
+}
+
+// postgresAlterStatements are the postgres equivalent of alterStatements.
+// Postgres supports IF NOT EXISTS so they can safely run more than once.
+var postgresAlterStatements = []string{
+	`ALTER TABLE images ADD COLUMN IF NOT EXISTS numeric_score INTEGER NOT NULL DEFAULT 0;`,
+	`ALTER TABLE images ADD COLUMN IF NOT EXISTS rating CHAR(1) NOT NULL DEFAULT '?';`,
+	`ALTER TABLE images ADD COLUMN IF NOT EXISTS favorites INTEGER NOT NULL DEFAULT 0;`,
+	`ALTER TABLE images ADD COLUMN IF NOT EXISTS parent_id INTEGER NULL;`,
+	`ALTER TABLE images ADD COLUMN IF NOT EXISTS has_children BOOLEAN NOT NULL DEFAULT FALSE;`,
+	`ALTER TABLE images ADD COLUMN IF NOT EXISTS author VARCHAR(255) NULL;`,
+	`ALTER TABLE images ADD COLUMN IF NOT EXISTS notes INTEGER NOT NULL DEFAULT 0;`,
+	`CREATE INDEX IF NOT EXISTS images__posted ON images (posted);`,
+	`CREATE INDEX IF NOT EXISTS images__numeric_score ON images (numeric_score);`,
+	`CREATE INDEX IF NOT EXISTS private_message__inbox ON private_message (to_id, from_id, is_read);`,
+	`CREATE INDEX IF NOT EXISTS private_message__from_id_sent_date ON private_message (from_id, sent_date);`,
+	`ALTER TABLE image_bans ADD COLUMN IF NOT EXISTS user_id INTEGER NULL;`,
+	`ALTER TABLE bans ADD COLUMN IF NOT EXISTS expires TIMESTAMP NULL;`,
+	`CREATE INDEX IF NOT EXISTS bans__expires ON bans (expires);`,
+}
+
+// The postgres schema uses VARCHAR instead of CHAR for variable length values
+// because postgres pads CHAR values with spaces and CHECK constraints instead
+// of the MySQL enums.
+const (
+	postgresUsersCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS users (
+	id SERIAL PRIMARY KEY,
+	name VARCHAR(32) NOT NULL UNIQUE,
+	pass VARCHAR(250),
+	joindate TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	admin CHAR(1) NOT NULL DEFAULT 'N' CHECK (admin IN ('Y', 'N')),
+	email VARCHAR(128),
+	class VARCHAR(32) NOT NULL DEFAULT 'user'
+);
+`
+	postgresImagesCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS images (
+	id SERIAL PRIMARY KEY,
+	owner_id INTEGER NOT NULL REFERENCES users (id) ON DELETE RESTRICT,
+	owner_ip VARCHAR(15) NOT NULL,
+	filename VARCHAR(64) NOT NULL,
+	filesize INTEGER NOT NULL,
+	hash VARCHAR(32) UNIQUE NOT NULL,
+	ext VARCHAR(4) NOT NULL,
+	source VARCHAR(255),
+	width INTEGER NOT NULL,
+	height INTEGER NOT NULL,
+	posted TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	locked CHAR(1) NOT NULL DEFAULT 'N' CHECK (locked IN ('Y', 'N'))
+);
+`
+	postgresTagsCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS tags (
+	id SERIAL PRIMARY KEY,
+	tag VARCHAR(64) NOT NULL UNIQUE,
+	count INTEGER NOT NULL DEFAULT 0
+);
+`
+	postgresTagHistoriesCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS tag_histories (
+	id SERIAL PRIMARY KEY,
+	image_id INTEGER NOT NULL REFERENCES images (id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	user_ip VARCHAR(15) NOT NULL,
+	tags TEXT NOT NULL,
+	date_set TIMESTAMP NOT NULL
+);
+`
+	postgresImageTagsCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS image_tags (
+	image_id INTEGER NOT NULL REFERENCES images (id) ON DELETE CASCADE,
+	tag_id INTEGER NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+	UNIQUE (image_id, tag_id)
+);
+CREATE INDEX IF NOT EXISTS image_tags__tag_id ON image_tags (tag_id);
+`
+	postgresAliasesCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS aliases (
+	oldtag VARCHAR(128) PRIMARY KEY,
+	newtag VARCHAR(128) NOT NULL
+);
+CREATE INDEX IF NOT EXISTS aliases__newtag ON aliases (newtag);
+`
+	postgresPrivateMessageTableStmt = `
+CREATE TABLE IF NOT EXISTS private_message (
+	id SERIAL PRIMARY KEY,
+	from_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	from_ip VARCHAR(15) NOT NULL,
+	to_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	sent_date TIMESTAMP NOT NULL,
+	subject VARCHAR(64) NOT NULL,
+	message TEXT NOT NULL,
+	is_read CHAR(1) NOT NULL DEFAULT 'N' CHECK (is_read IN ('Y', 'N'))
+);
+CREATE INDEX IF NOT EXISTS private_message__to_id ON private_message (to_id);
+CREATE INDEX IF NOT EXISTS private_message__from_id ON private_message (from_id);
+`
+	postgresPMStatesCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS pm_states (
+	pm_id INTEGER PRIMARY KEY REFERENCES private_message (id) ON DELETE CASCADE,
+	parent_id INTEGER NULL,
+	deleted_by_sender BOOLEAN NOT NULL DEFAULT FALSE,
+	deleted_by_recipient BOOLEAN NOT NULL DEFAULT FALSE
+);
+`
+	postgresScoreLogCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS score_log (
+	id SERIAL PRIMARY KEY,
+	date_sent TIMESTAMP NOT NULL,
+	section VARCHAR(32) NOT NULL,
+	username VARCHAR(32) NOT NULL,
+	address VARCHAR(45) NOT NULL,
+	priority INTEGER NOT NULL,
+	message TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS score_log__section ON score_log (section);
+CREATE INDEX IF NOT EXISTS score_log__username ON score_log (username);
+CREATE INDEX IF NOT EXISTS score_log__address ON score_log (address);
+CREATE INDEX IF NOT EXISTS score_log__date_sent ON score_log (date_sent);
+`
+	postgresConfigCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS config (
+	name VARCHAR(128) PRIMARY KEY,
+	value TEXT
+);
+`
+	postgresPMBlocksCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS pm_blocks (
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	blocked_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	created TIMESTAMP NOT NULL,
+	PRIMARY KEY (user_id, blocked_id)
+);
+`
+	postgresPMRateLimitsCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS pm_rate_limits (
+	user_id INTEGER PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+	messages INTEGER NOT NULL,
+	period_seconds INTEGER NOT NULL
+);
+`
+	postgresPMFlagsCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS pm_flags (
+	pm_id INTEGER PRIMARY KEY REFERENCES private_message (id) ON DELETE CASCADE
+);
+`
+	postgresImagePHashesCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS image_phashes (
+	image_id INTEGER PRIMARY KEY REFERENCES images (id) ON DELETE CASCADE,
+	phash BIGINT NOT NULL
+);
+`
+	postgresImageBansCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS image_bans (
+	id SERIAL PRIMARY KEY,
+	hash CHAR(32) NOT NULL,
+	date TIMESTAMP NOT NULL,
+	reason TEXT NOT NULL,
+	user_id INTEGER NULL REFERENCES users (id) ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS image_bans__hash ON image_bans (hash);
+`
+	postgresIPBansCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS bans (
+	id SERIAL PRIMARY KEY,
+	banner_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	ip VARCHAR(45) NOT NULL,
+	reason TEXT NOT NULL,
+	added TIMESTAMP NOT NULL,
+	expires TIMESTAMP NULL
+);
+`
+	postgresPoolsCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS pools (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	public BOOLEAN NOT NULL DEFAULT FALSE,
+	title VARCHAR(255) NOT NULL,
+	description TEXT,
+	date TIMESTAMP NOT NULL,
+	posts INTEGER NOT NULL DEFAULT 0,
+	lastupdated TIMESTAMP NULL
+);
+CREATE INDEX IF NOT EXISTS pools__title ON pools (title);
+`
+	postgresPoolImagesCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS pool_images (
+	pool_id INTEGER NOT NULL REFERENCES pools (id) ON DELETE CASCADE,
+	image_id INTEGER NOT NULL REFERENCES images (id) ON DELETE CASCADE,
+	image_order INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (pool_id, image_id)
+);
+CREATE INDEX IF NOT EXISTS pool_images__image_id ON pool_images (image_id);
+`
+	postgresPoolHistoryCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS pool_history (
+	id SERIAL PRIMARY KEY,
+	pool_id INTEGER NOT NULL REFERENCES pools (id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	action INTEGER NOT NULL,
+	images TEXT,
+	count INTEGER NOT NULL DEFAULT 0,
+	date TIMESTAMP NOT NULL
+);
+`
+	postgresUserFavoritesCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS user_favorites (
+	image_id INTEGER NOT NULL REFERENCES images (id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	created_at TIMESTAMP NOT NULL,
+	UNIQUE (image_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS user_favorites__user_id ON user_favorites (user_id, created_at);
+CREATE INDEX IF NOT EXISTS user_favorites__created_at ON user_favorites (created_at);
+`
+	postgresNumericScoreVotesCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS numeric_score_votes (
+	image_id INTEGER NOT NULL REFERENCES images (id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	score INTEGER NOT NULL,
+	UNIQUE (image_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS numeric_score_votes__user_id ON numeric_score_votes (user_id);
+`
+)
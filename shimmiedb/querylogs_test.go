@@ -0,0 +1,55 @@
+package shimmiedb_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kusubooru/shimmie"
+	"github.com/kusubooru/shimmie/shimmiedb"
+)
+
+func TestQueryLogsScanLimit(t *testing.T) {
+	ctx := context.Background()
+	shim, schema := openDialect(t, shimmiedb.SQLite, filepath.Join(t.TempDir(), "shimmie.db"))
+	defer teardown(t, shim, schema)
+
+	// An IPv6 network has no textual prefix, so every entry newer than the
+	// match has to be checked in Go.
+	if _, err := shim.Log(ctx, "upload", "ann", "2001:db8::1", shimmie.PriorityInfo, "Upload failed"); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := shim.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO score_log (date_sent, section, username, address, priority, message) VALUES (?, 'user', 'bob', '10.0.0.1', 20, 'bob logged in')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 6000; i++ {
+		if _, err := stmt.ExecContext(ctx, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	filter := shimmie.LogFilter{Address: "2001:db8::/32"}
+	logs, next, err := shim.QueryLogs(ctx, filter, 10, "")
+	if err != nil {
+		t.Fatalf("QueryLogs(%+v) returned err: %v", filter, err)
+	}
+	if len(logs) != 0 || next == "" {
+		t.Fatalf("QueryLogs(%+v) = %d entries, next %q, want it to stop early with a cursor", filter, len(logs), next)
+	}
+	logs, next, err = shim.QueryLogs(ctx, filter, 10, next)
+	if err != nil {
+		t.Fatalf("QueryLogs(%+v) resume returned err: %v", filter, err)
+	}
+	if len(logs) != 1 || logs[0].Message != "Upload failed" || next != "" {
+		t.Errorf("QueryLogs(%+v) resume = %v, next %q, want the IPv6 entry and no next page", filter, logs, next)
+	}
+}
@@ -0,0 +1,213 @@
+package shimmiedb
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/kusubooru/shimmie"
+)
+
+// SetParent makes parentID the parent of childID and logs the change. It
+// returns shimmie.ErrParentCycle if parentID is childID or one of its
+// descendants and sql.ErrNoRows if either image does not exist.
+func (db *DB) SetParent(ctx context.Context, childID, parentID int64, user *shimmie.User, address string) error {
+	if parentID <= 0 {
+		return sql.ErrNoRows
+	}
+	return Tx(ctx, db.DB, func(tx *sql.Tx) error {
+		oldParentID, err := db.lockParentOf(ctx, tx, childID)
+		if err != nil {
+			return err
+		}
+		// Walk up from the new parent to make sure that the child is not
+		// one of its ancestors. The rows are locked as they are walked so
+		// that a concurrent SetParent cannot make an ancestor a child of
+		// childID before this one commits.
+		seen := make(map[int64]bool)
+		for id := parentID; id != 0 && !seen[id]; {
+			if id == childID {
+				return shimmie.ErrParentCycle
+			}
+			seen[id] = true
+			if id, err = db.lockParentOf(ctx, tx, id); err != nil {
+				return err
+			}
+		}
+		if oldParentID == parentID {
+			return nil
+		}
+
+		if _, err := tx.ExecContext(ctx, db.rebind(imageSetParentStmt), parentID, childID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, db.rebind(imageSetHasChildrenStmt), true, parentID); err != nil {
+			return err
+		}
+		if oldParentID != 0 {
+			if err := db.updateHasChildren(ctx, tx, oldParentID); err != nil {
+				return err
+			}
+		}
+		return db.logRelationship(ctx, tx, user, address, shimmie.SetParentLogMessage(childID, parentID))
+	})
+}
+
+// RemoveParent removes the parent of childID and logs the change. It
+// returns sql.ErrNoRows if the image does not exist.
+func (db *DB) RemoveParent(ctx context.Context, childID int64, user *shimmie.User, address string) error {
+	return Tx(ctx, db.DB, func(tx *sql.Tx) error {
+		parentID, err := db.lockParentOf(ctx, tx, childID)
+		if err != nil {
+			return err
+		}
+		if parentID == 0 {
+			return nil
+		}
+		if _, err := tx.ExecContext(ctx, db.rebind(imageSetParentStmt), nil, childID); err != nil {
+			return err
+		}
+		if err := db.updateHasChildren(ctx, tx, parentID); err != nil {
+			return err
+		}
+		return db.logRelationship(ctx, tx, user, address, shimmie.RemoveParentLogMessage(childID, parentID))
+	})
+}
+
+// parentOf returns the parent of an image, zero if it has none, or
+// sql.ErrNoRows if the image does not exist.
+func (db *DB) parentOf(ctx context.Context, q execQueryer, id int64) (int64, error) {
+	var parentID sql.NullInt64
+	if err := q.QueryRowContext(ctx, db.rebind(imageParentQuery), id).Scan(&parentID); err != nil {
+		return 0, err
+	}
+	return parentID.Int64, nil
+}
+
+// lockParentOf is parentOf that also locks the row of the image until tx
+// ends.
+func (db *DB) lockParentOf(ctx context.Context, tx *sql.Tx, id int64) (int64, error) {
+	var parentID sql.NullInt64
+	if err := tx.QueryRowContext(ctx, db.rebind(imageParentQuery+db.sqlDialect().forUpdate()), id).Scan(&parentID); err != nil {
+		return 0, err
+	}
+	return parentID.Int64, nil
+}
+
+// updateHasChildren sets the has_children flag of an image according to
+// the images whose parent it is.
+func (db *DB) updateHasChildren(ctx context.Context, q execQueryer, id int64) error {
+	var n int
+	if err := q.QueryRowContext(ctx, db.rebind(imageChildCountQuery), id).Scan(&n); err != nil {
+		return err
+	}
+	_, err := q.ExecContext(ctx, db.rebind(imageSetHasChildrenStmt), n != 0, id)
+	return err
+}
+
+func (db *DB) logRelationship(ctx context.Context, tx *sql.Tx, user *shimmie.User, address, msg string) error {
+	var username string
+	if user != nil {
+		username = user.Name
+	}
+	_, err := tx.ExecContext(ctx, db.rebind(scoreLogInsertStmt), time.Now(), "relationships", username, address, shimmie.PriorityInfo, msg)
+	return err
+}
+
+// GetChildren returns the images whose parent is parentID, ordered by ID.
+func (db *DB) GetChildren(ctx context.Context, parentID int64) (images []shimmie.Image, err error) {
+	rows, err := db.QueryContext(ctx, db.rebind(imageChildrenQuery), parentID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := rows.Close(); err == nil {
+			err = cerr
+			return
+		}
+	}()
+
+	for rows.Next() {
+		img, err := scanImage(rows)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, *img)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// GetFamily returns the topmost ancestor of an image along with all of its
+// descendants, ordered by ID. It returns sql.ErrNoRows if the image does not
+// exist.
+func (db *DB) GetFamily(ctx context.Context, id int64) ([]shimmie.Image, error) {
+	seen := make(map[int64]bool)
+	rootID := id
+	for !seen[rootID] {
+		seen[rootID] = true
+		parentID, err := db.parentOf(ctx, db.DB, rootID)
+		if err != nil {
+			return nil, err
+		}
+		if parentID == 0 {
+			break
+		}
+		rootID = parentID
+	}
+
+	root, err := db.GetImage(ctx, int(rootID))
+	if err != nil {
+		return nil, err
+	}
+	// The has_children flags are not trusted since older Shimmie versions
+	// did not always maintain them.
+	family := []shimmie.Image{*root}
+	seen = map[int64]bool{root.ID: true}
+	for i := 0; i < len(family); i++ {
+		children, err := db.GetChildren(ctx, family[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range children {
+			if !seen[c.ID] {
+				seen[c.ID] = true
+				family = append(family, c)
+			}
+		}
+	}
+	sort.Slice(family, func(i, j int) bool { return family[i].ID < family[j].ID })
+	return family, nil
+}
+
+const (
+	imageParentQuery = `
+SELECT parent_id
+FROM images
+WHERE id = ?
+`
+	imageChildCountQuery = `
+SELECT COUNT(*)
+FROM images
+WHERE parent_id = ?
+`
+	imageChildrenQuery = `
+SELECT ` + imageColumns + `
+FROM images
+WHERE parent_id = ?
+ORDER BY id
+`
+	imageSetParentStmt = `
+UPDATE images
+SET parent_id = ?
+WHERE id = ?
+`
+	imageSetHasChildrenStmt = `
+UPDATE images
+SET has_children = ?
+WHERE id = ?
+`
+)
@@ -0,0 +1,251 @@
+package shimmiedb
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// RetentionPolicy decides how long the score_log entries it matches are
+// kept. A policy matches the entries of Section, or of any section if
+// Section is empty, that have a priority of at most MaxPriority, or any
+// priority if MaxPriority is zero.
+type RetentionPolicy struct {
+	Section     string
+	MaxPriority int
+	// MaxAge is how long the matching entries are kept. Zero keeps them
+	// forever.
+	MaxAge time.Duration
+}
+
+// defaultArchiveBatchSize is the number of entries that are archived and
+// deleted at a time.
+const defaultArchiveBatchSize = 1000
+
+// logRecord is a score_log entry in an archive.
+type logRecord struct {
+	ID       int64     `json:"id"`
+	DateSent time.Time `json:"date_sent"`
+	Section  string    `json:"section"`
+	Username string    `json:"username"`
+	Address  string    `json:"address"`
+	Priority int       `json:"priority"`
+	Message  string    `json:"message"`
+}
+
+// ArchiveLogs writes the expired score_log entries to w as gzip compressed
+// JSON Lines and deletes them, batchSize entries at a time. Each entry
+// expires according to the first of policies that matches it, so specific
+// policies must come before general ones. Entries that match no policy are
+// kept. Every batch is flushed, and synced if w is a file, before it is
+// deleted. The archive is completed even if an error stops ArchiveLogs, so
+// that the entries that were already deleted can be imported. It returns the
+// number of archived entries.
+func (db *DB) ArchiveLogs(ctx context.Context, w io.Writer, policies []RetentionPolicy, batchSize int) (n int, err error) {
+	if batchSize <= 0 {
+		batchSize = defaultArchiveBatchSize
+	}
+	expired, expiredArgs := expiredLogsWhere(policies, time.Now())
+	if expired == "" {
+		return 0, nil
+	}
+
+	zw := gzip.NewWriter(w)
+	defer func() {
+		if cerr := zw.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("writing archive: %v", cerr)
+		}
+	}()
+	enc := json.NewEncoder(zw)
+	var lastID int64
+	for {
+		args := append([]interface{}{lastID}, expiredArgs...)
+		args = append(args, batchSize)
+		query := "SELECT " + scoreLogColumns + "\nFROM score_log\nWHERE id > ? AND (" + expired + ")\nORDER BY id\nLIMIT ?"
+		records, err := db.queryLogRecords(ctx, db.rebind(query), args...)
+		if err != nil {
+			return n, err
+		}
+		if len(records) == 0 {
+			break
+		}
+
+		ids := make([]interface{}, len(records))
+		for i, r := range records {
+			if err := enc.Encode(r); err != nil {
+				return n, fmt.Errorf("writing archive: %v", err)
+			}
+			ids[i] = r.ID
+		}
+		if err := zw.Flush(); err != nil {
+			return n, fmt.Errorf("writing archive: %v", err)
+		}
+		if s, ok := w.(interface{ Sync() error }); ok {
+			if err := s.Sync(); err != nil {
+				return n, fmt.Errorf("syncing archive: %v", err)
+			}
+		}
+
+		del := "DELETE FROM score_log WHERE id IN (?" + strings.Repeat(", ?", len(ids)-1) + ")"
+		if _, err := db.ExecContext(ctx, db.rebind(del), ids...); err != nil {
+			return n, err
+		}
+		n += len(records)
+		lastID = records[len(records)-1].ID
+		if len(records) < batchSize {
+			break
+		}
+	}
+	return n, nil
+}
+
+// ImportLogs reads an archive written by ArchiveLogs and inserts its entries
+// back into score_log. The entries keep their dates but get new IDs. If the
+// archive cannot be read to the end, the entries read before the error are
+// still imported. It returns the number of imported entries.
+func (db *DB) ImportLogs(ctx context.Context, r io.Reader) (int, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return 0, fmt.Errorf("reading archive: %v", err)
+	}
+	defer zr.Close()
+
+	var (
+		n     int
+		batch []logRecord
+	)
+	insert := func() error {
+		err := Tx(ctx, db.DB, func(tx *sql.Tx) error {
+			for _, r := range batch {
+				_, err := tx.ExecContext(ctx, db.rebind(scoreLogInsertStmt), r.DateSent, r.Section, r.Username, r.Address, r.Priority, r.Message)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		n += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	var readErr error
+	sc := bufio.NewScanner(zr)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var r logRecord
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			readErr = fmt.Errorf("reading archive entry %d: %v", n+len(batch)+1, err)
+			break
+		}
+		batch = append(batch, r)
+		if len(batch) == defaultArchiveBatchSize {
+			if err := insert(); err != nil {
+				return n, err
+			}
+		}
+	}
+	if err := sc.Err(); err != nil && readErr == nil {
+		readErr = fmt.Errorf("reading archive: %v", err)
+	}
+	// A damaged archive may be the only copy of its entries so the ones that
+	// could be read are kept.
+	if len(batch) != 0 {
+		if err := insert(); err != nil {
+			return n, err
+		}
+	}
+	return n, readErr
+}
+
+func (db *DB) queryLogRecords(ctx context.Context, query string, args ...interface{}) (records []logRecord, err error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := rows.Close(); err == nil {
+			err = cerr
+			return
+		}
+	}()
+
+	for rows.Next() {
+		var r logRecord
+		err := rows.Scan(
+			&r.ID,
+			&r.DateSent,
+			&r.Section,
+			&r.Username,
+			&r.Address,
+			&r.Priority,
+			&r.Message,
+		)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// expiredLogsWhere returns the condition that selects the entries that are
+// expired at now according to the first policy that matches them. It
+// returns an empty condition if no entry can expire.
+func expiredLogsWhere(policies []RetentionPolicy, now time.Time) (string, []interface{}) {
+	var (
+		clauses []string
+		args    []interface{}
+		// earlier holds the conditions of the policies that come first.
+		earlier     []string
+		earlierArgs []interface{}
+	)
+	for _, p := range policies {
+		match, matchArgs := p.where()
+		if p.MaxAge > 0 {
+			clause := []string{match, "date_sent < ?"}
+			for _, e := range earlier {
+				clause = append(clause, "NOT ("+e+")")
+			}
+			clauses = append(clauses, "("+strings.Join(clause, " AND ")+")")
+			args = append(args, matchArgs...)
+			args = append(args, now.Add(-p.MaxAge))
+			args = append(args, earlierArgs...)
+		}
+		earlier = append(earlier, match)
+		earlierArgs = append(earlierArgs, matchArgs...)
+	}
+	return strings.Join(clauses, " OR "), args
+}
+
+// where returns the condition that matches the entries of the policy.
+func (p RetentionPolicy) where() (string, []interface{}) {
+	var (
+		where []string
+		args  []interface{}
+	)
+	if p.Section != "" {
+		where = append(where, "section = ?")
+		args = append(args, p.Section)
+	}
+	if p.MaxPriority != 0 {
+		where = append(where, "priority <= ?")
+		args = append(args, p.MaxPriority)
+	}
+	if len(where) == 0 {
+		return "1 = 1", nil
+	}
+	return strings.Join(where, " AND "), args
+}
@@ -0,0 +1,173 @@
+package shimmiedb_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/kusubooru/shimmie"
+	"github.com/kusubooru/shimmie/shimmiedb"
+)
+
+func TestArchiveLogs(t *testing.T) {
+	ctx := context.Background()
+	shim, schema := openDialect(t, shimmiedb.SQLite, filepath.Join(t.TempDir(), "shimmie.db"))
+	defer teardown(t, shim, schema)
+
+	day := 24 * time.Hour
+	now := time.Now().UTC().Truncate(time.Second)
+	var entries = []struct {
+		section  string
+		priority int
+		age      time.Duration
+	}{
+		{"rating", 20, 400 * day},
+		{"user", 20, 40 * day},
+		{"user", 20, 10 * day},
+		{"admin", 40, 40 * day},
+		{"admin", 40, 400 * day},
+		{"rating", 20, 5000 * day},
+	}
+	var old bytes.Buffer
+	zw := gzip.NewWriter(&old)
+	enc := json.NewEncoder(zw)
+	for _, e := range entries {
+		err := enc.Encode(map[string]interface{}{
+			"date_sent": now.Add(-e.age),
+			"section":   e.section,
+			"username":  "bob",
+			"address":   "10.0.0.1",
+			"priority":  e.priority,
+			"message":   e.section + " " + e.age.String(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	n, err := shim.ImportLogs(ctx, &old)
+	if err != nil {
+		t.Fatalf("ImportLogs returned err: %v", err)
+	}
+	if got, want := n, len(entries); got != want {
+		t.Fatalf("ImportLogs imported %d entries, want %d", got, want)
+	}
+
+	policies := []shimmiedb.RetentionPolicy{
+		{Section: "rating"},
+		{MaxPriority: 20, MaxAge: 30 * day},
+		{MaxAge: 365 * day},
+	}
+	var archive bytes.Buffer
+	n, err = shim.ArchiveLogs(ctx, &archive, policies, 1)
+	if err != nil {
+		t.Fatalf("ArchiveLogs returned err: %v", err)
+	}
+	if got, want := n, 2; got != want {
+		t.Errorf("ArchiveLogs archived %d entries, want %d", got, want)
+	}
+	want := []string{"admin 960h0m0s", "rating 120000h0m0s", "rating 9600h0m0s", "user 240h0m0s"}
+	if got := logMessages(t, shim); !reflect.DeepEqual(got, want) {
+		t.Errorf("entries after ArchiveLogs = %q, want %q", got, want)
+	}
+	archived := archive.Bytes()
+
+	if n, err = shim.ArchiveLogs(ctx, &bytes.Buffer{}, policies, 0); err != nil || n != 0 {
+		t.Errorf("second ArchiveLogs = %d, %v, want nothing archived", n, err)
+	}
+
+	n, err = shim.ImportLogs(ctx, bytes.NewReader(archived))
+	if err != nil {
+		t.Fatalf("ImportLogs(archive) returned err: %v", err)
+	}
+	if got, want := n, 2; got != want {
+		t.Errorf("ImportLogs(archive) imported %d entries, want %d", got, want)
+	}
+	logs, _, err := shim.QueryLogs(ctx, shimmie.LogFilter{Section: "admin", Before: timePtr(now.Add(-399 * day))}, 0, "")
+	if err != nil {
+		t.Fatalf("QueryLogs returned err: %v", err)
+	}
+	if len(logs) != 1 || !logs[0].DateSent.Equal(now.Add(-400*day)) || logs[0].Username != "bob" || logs[0].Priority != 40 {
+		t.Errorf("re-imported entry = %#v, want admin entry dated %v", logs, now.Add(-400*day))
+	}
+	if got := logMessages(t, shim); len(got) != len(entries) {
+		t.Errorf("entries after re-import = %q, want %d entries", got, len(entries))
+	}
+}
+
+func logMessages(t *testing.T, shim *shimmiedb.DB) []string {
+	logs, _, err := shim.QueryLogs(context.Background(), shimmie.LogFilter{}, 0, "")
+	if err != nil {
+		t.Fatalf("QueryLogs returned err: %v", err)
+	}
+	var messages []string
+	for _, l := range logs {
+		messages = append(messages, l.Message)
+	}
+	sort.Strings(messages)
+	return messages
+}
+
+func timePtr(t time.Time) *time.Time { return &t }
+
+// syncBuffer is a bytes.Buffer with a Sync method like the one of os.File.
+type syncBuffer struct {
+	bytes.Buffer
+	onSync func()
+}
+
+func (b *syncBuffer) Sync() error {
+	b.onSync()
+	return nil
+}
+
+func TestArchiveLogsInterrupted(t *testing.T) {
+	shim, schema := openDialect(t, shimmiedb.SQLite, filepath.Join(t.TempDir(), "shimmie.db"))
+	defer teardown(t, shim, schema)
+
+	for _, msg := range []string{"first", "second", "third"} {
+		if _, err := shim.Log(context.Background(), "user", "bob", "10.0.0.1", 20, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The second batch is written to the archive but cannot be deleted.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	syncs := 0
+	archive := &syncBuffer{onSync: func() {
+		if syncs++; syncs == 2 {
+			cancel()
+		}
+	}}
+	policies := []shimmiedb.RetentionPolicy{{MaxAge: time.Nanosecond}}
+	n, err := shim.ArchiveLogs(ctx, archive, policies, 1)
+	if err == nil || n != 1 {
+		t.Fatalf("interrupted ArchiveLogs = %d, %v, want 1 and an error", n, err)
+	}
+	if got, want := logMessages(t, shim), []string{"second", "third"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("entries after interrupted ArchiveLogs = %q, want %q", got, want)
+	}
+
+	// The archive is complete, while a truncated one still gives back the
+	// entries that can be read.
+	full := archive.Bytes()
+	if n, err := shim.ImportLogs(context.Background(), bytes.NewReader(full)); err != nil || n != 2 {
+		t.Errorf("ImportLogs(archive) = %d, %v, want 2 entries", n, err)
+	}
+	n, err = shim.ImportLogs(context.Background(), bytes.NewReader(full[:len(full)-4]))
+	if err == nil || n != 2 {
+		t.Errorf("ImportLogs(truncated archive) = %d, %v, want 2 entries and an error", n, err)
+	}
+	if got, want := logMessages(t, shim), []string{"first", "first", "second", "second", "second", "third"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("entries after ImportLogs = %q, want %q", got, want)
+	}
+}
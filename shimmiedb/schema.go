@@ -4,31 +4,42 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"strings"
-
-	"github.com/go-sql-driver/mysql"
 )
 
 // Schema has methods which allow to create the db schema as well as truncate
 // all tables.
 type Schema struct {
 	*sql.DB
+	dialect Dialect
 }
 
 // NewSchemer returns an implementation of Schemer that allows to easily create
-// and drop the database schema.
+// and drop the MySQL database schema.
 func NewSchemer(dataSource string, pingRetries int) (*Schema, error) {
-	db, err := openDB(dataSource, pingRetries)
+	return NewSchemerDialect(MySQL, dataSource, pingRetries)
+}
+
+// NewSchemerDialect returns an implementation of Schemer for the given
+// dialect.
+func NewSchemerDialect(d Dialect, dataSource string, pingRetries int) (*Schema, error) {
+	db, err := openDB(d, dataSource, pingRetries)
 	if err != nil {
 		return nil, err
 	}
-	return &Schema{db}, nil
+	return &Schema{DB: db, dialect: d}, nil
+}
+
+func (db Schema) sqlDialect() Dialect {
+	if db.dialect == nil {
+		return MySQL
+	}
+	return db.dialect
 }
 
 // Create creates the database schema.
-func (db Schema) Create() error {
-	return Tx(db.DB, func(tx *sql.Tx) error {
-		if query, err := createSchema(tx); err != nil {
+func (db Schema) Create(ctx context.Context) error {
+	return Tx(ctx, db.DB, func(tx *sql.Tx) error {
+		if query, err := createSchema(ctx, tx, db.sqlDialect()); err != nil {
 			return fmt.Errorf("failed to execute query:\n%s\nReason: %v", query, err)
 		}
 		return nil
@@ -36,12 +47,7 @@ func (db Schema) Create() error {
 }
 
 func (db Schema) allTables(ctx context.Context) ([]string, error) {
-	const q = `
-	SELECT table_name
-	FROM information_schema.tables
-	WHERE table_schema="shimmie";`
-
-	rows, err := db.DB.QueryContext(ctx, q)
+	rows, err := db.DB.QueryContext(ctx, db.sqlDialect().allTablesQuery())
 	if err != nil {
 		return nil, err
 	}
@@ -66,15 +72,11 @@ func (db Schema) TruncateTables(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("fetching all tables: %v", err)
 	}
-
-	b := strings.Builder{}
-	b.WriteString("SET FOREIGN_KEY_CHECKS=0;\n")
-	for _, t := range tables {
-		b.WriteString(fmt.Sprintf("TRUNCATE TABLE %s;\n", t))
+	if len(tables) == 0 {
+		return nil
 	}
-	b.WriteString("SET FOREIGN_KEY_CHECKS=1;")
 
-	query := b.String()
+	query := db.sqlDialect().truncateTablesStmt(tables)
 	_, err = db.ExecContext(ctx, query)
 	if err != nil {
 		return fmt.Errorf("truncating all tables using query:\n%s\nResult: %v", query, err)
@@ -82,25 +84,26 @@ func (db Schema) TruncateTables(ctx context.Context) error {
 	return nil
 }
 
-// MySQL specific error for when we try to run alter queries to add new a
-// column and the column already exists.
+// MySQL specific errors for when we try to run alter queries to add a new
+// column or index and the column or index already exists.
 //
 // See: https://github.com/VividCortex/mysqlerr/blob/master/mysqlerr.go
-const duplicateColumnName = 1060
+const (
+	duplicateColumnName = 1060
+	duplicateKeyName    = 1061
+)
 
-func createSchema(tx *sql.Tx) (string, error) {
-	for _, query := range createStatements {
-		if _, err := tx.Exec(query); err != nil {
+func createSchema(ctx context.Context, tx *sql.Tx, d Dialect) (string, error) {
+	for _, query := range d.createStatements() {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
 			return query, err
 		}
 	}
 
-	for _, query := range alterStatements {
-		if _, err := tx.Exec(query); err != nil {
-			if driverErr, ok := err.(*mysql.MySQLError); ok {
-				if driverErr.Number != duplicateColumnName {
-					return query, err
-				}
+	for _, query := range d.alterStatements() {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			if !d.ignoreAlterErr(err) {
+				return query, err
 			}
 		}
 	}
@@ -115,9 +118,44 @@ var createStatements = []string{
 	imageTagsCreateTableStmt,
 	aliasesCreateTableStmt,
 	privateMessageTableStmt,
+	pmStatesCreateTableStmt,
+	scoreLogCreateTableStmt,
+	configCreateTableStmt,
+	pmBlocksCreateTableStmt,
+	pmRateLimitsCreateTableStmt,
+	pmFlagsCreateTableStmt,
+	imagePHashesCreateTableStmt,
+	imageBansCreateTableStmt,
+	ipBansCreateTableStmt,
+	poolsCreateTableStmt,
+	poolImagesCreateTableStmt,
+	poolHistoryCreateTableStmt,
+	userFavoritesCreateTableStmt,
+	numericScoreVotesCreateTableStmt,
 }
 
-var alterStatements = []string{}
+// alterStatements add the columns and indexes that Shimmie extensions add to
+// the core tables as well as the ones needed by this package.
+var alterStatements = []string{
+	`ALTER TABLE images ADD COLUMN numeric_score INTEGER NOT NULL DEFAULT 0;`,
+	`ALTER TABLE images ADD COLUMN rating CHAR(1) NOT NULL DEFAULT '?';`,
+	`ALTER TABLE images ADD COLUMN favorites INTEGER NOT NULL DEFAULT 0;`,
+	`ALTER TABLE images ADD COLUMN parent_id INTEGER NULL;`,
+	`ALTER TABLE images ADD COLUMN has_children BOOLEAN NOT NULL DEFAULT FALSE;`,
+	`ALTER TABLE images ADD COLUMN author VARCHAR(255) NULL;`,
+	`ALTER TABLE images ADD COLUMN notes INTEGER NOT NULL DEFAULT 0;`,
+	`ALTER TABLE images ADD INDEX images__posted (posted);`,
+	`ALTER TABLE images ADD INDEX images__numeric_score (numeric_score);`,
+	`ALTER TABLE private_message ADD INDEX private_message__inbox (to_id, from_id, is_read);`,
+	`ALTER TABLE private_message ADD INDEX private_message__from_id_sent_date (from_id, sent_date);`,
+	`ALTER TABLE score_log ADD INDEX score_log__username (username);`,
+	`ALTER TABLE score_log ADD INDEX score_log__address (address);`,
+	`ALTER TABLE score_log ADD INDEX score_log__date_sent (date_sent);`,
+	`ALTER TABLE image_bans ADD COLUMN user_id INTEGER NULL;`,
+	`ALTER TABLE image_bans ADD INDEX image_bans__hash (hash);`,
+	`ALTER TABLE bans ADD COLUMN expires DATETIME NULL;`,
+	`ALTER TABLE bans ADD INDEX bans__expires (expires);`,
+}
 
 const (
 	usersCreateTableStmt = `
@@ -127,8 +165,8 @@ CREATE TABLE IF NOT EXISTS users (
 	pass VARCHAR(250),
 	joindate TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
 	admin enum('Y','N') NOT NULL DEFAULT 'N',
-	class VARCHAR(32) NOT NULL DEFAULT 'user',
 	email VARCHAR(128),
+	class VARCHAR(32) NOT NULL DEFAULT 'user',
 	PRIMARY KEY (id),
 	UNIQUE KEY (name)
 );
@@ -208,5 +246,162 @@ CREATE TABLE IF NOT EXISTS private_message (
   CONSTRAINT private_message_ibfk_1 FOREIGN KEY (from_id) REFERENCES users (id) ON DELETE CASCADE,
   CONSTRAINT private_message_ibfk_2 FOREIGN KEY (to_id) REFERENCES users (id) ON DELETE CASCADE
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+`
+	// pmStatesCreateTableStmt keeps the reply and delete state of private
+	// messages apart from the private_message table of Shimmie so that
+	// Shimmie keeps working with its own table as it is.
+	pmStatesCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS pm_states (
+	pm_id INTEGER NOT NULL,
+	parent_id INTEGER NULL,
+	deleted_by_sender BOOLEAN NOT NULL DEFAULT FALSE,
+	deleted_by_recipient BOOLEAN NOT NULL DEFAULT FALSE,
+	PRIMARY KEY (pm_id),
+	FOREIGN KEY (pm_id) REFERENCES private_message (id) ON DELETE CASCADE
+);
+`
+	scoreLogCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS score_log (
+  id int(11) NOT NULL AUTO_INCREMENT,
+  date_sent datetime NOT NULL,
+  section varchar(32) NOT NULL,
+  username varchar(32) NOT NULL,
+  address varchar(45) NOT NULL,
+  priority int(11) NOT NULL,
+  message text NOT NULL,
+  PRIMARY KEY (id),
+  KEY section (section)
+);
+`
+	configCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS config (
+  name varchar(128) NOT NULL,
+  value text,
+  PRIMARY KEY (name)
+);
+`
+	pmBlocksCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS pm_blocks (
+	user_id INTEGER NOT NULL,
+	blocked_id INTEGER NOT NULL,
+	created DATETIME NOT NULL,
+	PRIMARY KEY (user_id, blocked_id),
+	FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+	FOREIGN KEY (blocked_id) REFERENCES users (id) ON DELETE CASCADE
+);
+`
+	pmRateLimitsCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS pm_rate_limits (
+	user_id INTEGER NOT NULL,
+	messages INTEGER NOT NULL,
+	period_seconds INTEGER NOT NULL,
+	PRIMARY KEY (user_id),
+	FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+`
+	// pmFlagsCreateTableStmt holds the private messages that are flagged for
+	// review, apart from the private_message table of Shimmie.
+	pmFlagsCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS pm_flags (
+	pm_id INTEGER NOT NULL,
+	PRIMARY KEY (pm_id),
+	FOREIGN KEY (pm_id) REFERENCES private_message (id) ON DELETE CASCADE
+);
+`
+	imagePHashesCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS image_phashes (
+	image_id INTEGER NOT NULL,
+	phash BIGINT NOT NULL,
+	PRIMARY KEY (image_id),
+	FOREIGN KEY (image_id) REFERENCES images (id) ON DELETE CASCADE
+);
+`
+	imageBansCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS image_bans (
+	id INTEGER NOT NULL AUTO_INCREMENT,
+	hash CHAR(32) NOT NULL,
+	date DATETIME NOT NULL,
+	reason TEXT NOT NULL,
+	user_id INTEGER NULL,
+	PRIMARY KEY (id),
+	INDEX image_bans__hash (hash),
+	FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL
+);
+`
+	ipBansCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS bans (
+	id INTEGER NOT NULL AUTO_INCREMENT,
+	banner_id INTEGER NOT NULL,
+	ip VARCHAR(45) NOT NULL,
+	reason TEXT NOT NULL,
+	added DATETIME NOT NULL,
+	expires DATETIME NULL,
+	PRIMARY KEY (id),
+	KEY bans__expires (expires),
+	FOREIGN KEY (banner_id) REFERENCES users (id) ON DELETE CASCADE
+);
+`
+	poolsCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS pools (
+	id INTEGER NOT NULL AUTO_INCREMENT,
+	user_id INTEGER NOT NULL,
+	public BOOLEAN NOT NULL DEFAULT FALSE,
+	title VARCHAR(255) NOT NULL,
+	description TEXT,
+	date DATETIME NOT NULL,
+	posts INTEGER NOT NULL DEFAULT 0,
+	lastupdated DATETIME NULL,
+	PRIMARY KEY (id),
+	KEY pools__title (title),
+	FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+`
+	poolImagesCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS pool_images (
+	pool_id INTEGER NOT NULL,
+	image_id INTEGER NOT NULL,
+	image_order INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (pool_id, image_id),
+	KEY pool_images__image_id (image_id),
+	FOREIGN KEY (pool_id) REFERENCES pools (id) ON DELETE CASCADE,
+	FOREIGN KEY (image_id) REFERENCES images (id) ON DELETE CASCADE
+);
+`
+	poolHistoryCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS pool_history (
+	id INTEGER NOT NULL AUTO_INCREMENT,
+	pool_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	action INTEGER NOT NULL,
+	images TEXT,
+	count INTEGER NOT NULL DEFAULT 0,
+	date DATETIME NOT NULL,
+	PRIMARY KEY (id),
+	FOREIGN KEY (pool_id) REFERENCES pools (id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+`
+	userFavoritesCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS user_favorites (
+	image_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	created_at DATETIME NOT NULL,
+	UNIQUE KEY user_favorites__image_id_user_id (image_id, user_id),
+	KEY user_favorites__user_id (user_id, created_at),
+	KEY user_favorites__created_at (created_at),
+	FOREIGN KEY (image_id) REFERENCES images (id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+`
+	numericScoreVotesCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS numeric_score_votes (
+	image_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	score INTEGER NOT NULL,
+	UNIQUE KEY numeric_score_votes__image_id_user_id (image_id, user_id),
+	KEY numeric_score_votes__user_id (user_id),
+	FOREIGN KEY (image_id) REFERENCES images (id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
 `
 )
@@ -0,0 +1,112 @@
+package shimmiedb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/kusubooru/shimmie"
+)
+
+// Vote sets the numeric score vote of a user for an image, where 0 removes
+// the vote, and recomputes the numeric score of the image. It returns
+// shimmie.ErrInvalidVote if score is not -1, 0 or 1 and sql.ErrNoRows if the
+// user or the image does not exist.
+func (db *DB) Vote(ctx context.Context, userID, imageID int64, score int) error {
+	if !shimmie.ValidVote(score) {
+		return shimmie.ErrInvalidVote
+	}
+	return Tx(ctx, db.DB, func(tx *sql.Tx) error {
+		if err := db.lockImage(ctx, tx, imageID); err != nil {
+			return err
+		}
+		if err := db.checkUserImage(ctx, tx, userID, imageID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, db.rebind(voteDeleteStmt), imageID, userID); err != nil {
+			return err
+		}
+		if score != 0 {
+			if _, err := tx.ExecContext(ctx, db.rebind(voteInsertStmt), imageID, userID, score); err != nil {
+				return err
+			}
+		}
+		_, err := tx.ExecContext(ctx, db.rebind(imageScoreUpdateStmt), imageID, imageID)
+		return err
+	})
+}
+
+// GetVote returns the numeric score vote of a user for an image or 0 if the
+// user has not voted.
+func (db *DB) GetVote(ctx context.Context, userID, imageID int64) (int, error) {
+	var score int
+	err := db.QueryRowContext(ctx, db.rebind(voteGetQuery), imageID, userID).Scan(&score)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return score, err
+}
+
+// TopImages returns the images with a positive numeric score that were
+// posted since a time, highest score first and then by descending ID. A
+// zero time includes all images. See shimmie.ScorePeriod for the usual
+// leaderboards.
+func (db *DB) TopImages(ctx context.Context, since time.Time, limit int) (images []shimmie.Image, err error) {
+	query := topImagesQuery
+	var args []interface{}
+	if !since.IsZero() {
+		query += "\nAND posted >= ?"
+		args = append(args, since)
+	}
+	query += "\nORDER BY numeric_score DESC, id DESC\nLIMIT ?"
+	args = append(args, pageLimit(limit))
+
+	rows, err := db.QueryContext(ctx, db.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := rows.Close(); err == nil {
+			err = cerr
+			return
+		}
+	}()
+
+	for rows.Next() {
+		img, err := scanImage(rows)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, *img)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+const (
+	voteGetQuery = `
+SELECT score
+FROM numeric_score_votes
+WHERE image_id = ? AND user_id = ?
+`
+	voteDeleteStmt = `
+DELETE
+FROM numeric_score_votes
+WHERE image_id = ? AND user_id = ?
+`
+	voteInsertStmt = `
+INSERT INTO numeric_score_votes (image_id, user_id, score)
+VALUES (?, ?, ?)
+`
+	imageScoreUpdateStmt = `
+UPDATE images
+SET numeric_score = COALESCE((SELECT SUM(score) FROM numeric_score_votes WHERE image_id = ?), 0)
+WHERE id = ?
+`
+	topImagesQuery = `
+SELECT ` + imageColumns + `
+FROM images
+WHERE numeric_score > 0`
+)
@@ -0,0 +1,376 @@
+package shimmiedb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kusubooru/shimmie"
+)
+
+// Attribute keys that LogHandler stores in their own score_log columns
+// instead of the message.
+const (
+	LogSectionKey  = "section"
+	LogUsernameKey = "username"
+	LogAddressKey  = "address"
+)
+
+// Errors of LogHandler. ErrLogHandlerClosed is returned when a record is
+// handled after the LogHandler has been closed and ErrLogQueueFull when a
+// record is dropped because the queue is full.
+var (
+	ErrLogHandlerClosed = errors.New("log handler is closed")
+	ErrLogQueueFull     = errors.New("log handler queue is full")
+)
+
+// LogHandlerOptions configure a LogHandler. The zero value is usable.
+type LogHandlerOptions struct {
+	// Level is the minimum level that is logged. It defaults to
+	// slog.LevelInfo.
+	Level slog.Leveler
+	// Section is used for records without a section attribute. It defaults
+	// to "go".
+	Section string
+	// BatchSize is the number of entries that are written together. It
+	// defaults to 100.
+	BatchSize int
+	// FlushInterval is the longest time that an entry waits to be written.
+	// It defaults to one second.
+	FlushInterval time.Duration
+	// WriteTimeout is the longest time that writing a batch may take. It
+	// defaults to ten seconds.
+	WriteTimeout time.Duration
+	// OnError is called when an entry cannot be written, including when it
+	// is dropped because the queue is full.
+	OnError func(error)
+}
+
+// LogHandler is a slog.Handler that writes records to score_log so that they
+// appear alongside the ones of Shimmie. Levels are mapped to Shimmie
+// priorities by LevelPriority. The section, username and address of an entry
+// come from the attributes with the Log*Key keys, and the username falls back
+// to the user stored in the context with shimmie.NewContextWithUser. Any
+// other attributes are appended to the message as key=value.
+//
+// Records are queued and written in batches by a background goroutine, each
+// batch with a single INSERT, and entries keep the time of their record.
+// Handle never waits for the database: when the queue is full, the record is
+// dropped and reported to OnError. Close must be called to write the
+// remaining entries.
+type LogHandler struct {
+	w       *logWriter
+	level   slog.Leveler
+	section string
+	attrs   []slog.Attr
+	groups  []string
+}
+
+var _ slog.Handler = (*LogHandler)(nil)
+
+// NewLogHandler returns a LogHandler that writes to the score_log of db.
+func NewLogHandler(db *DB, opts *LogHandlerOptions) *LogHandler {
+	var o LogHandlerOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.Level == nil {
+		o.Level = slog.LevelInfo
+	}
+	if o.Section == "" {
+		o.Section = "go"
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = 100
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = time.Second
+	}
+	if o.WriteTimeout <= 0 {
+		o.WriteTimeout = 10 * time.Second
+	}
+	w := &logWriter{
+		db:      db,
+		timeout: o.WriteTimeout,
+		onError: o.OnError,
+		entries: make(chan shimmie.SCoreLog, 10*o.BatchSize),
+		flush:   make(chan chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go w.run(o.BatchSize, o.FlushInterval)
+	return &LogHandler{w: w, level: o.Level, section: o.Section}
+}
+
+// LevelPriority maps a slog level to the closest Shimmie priority that is not
+// above it, e.g. slog.LevelWarn to shimmie.PriorityWarning. Levels of 12 and
+// above are critical.
+func LevelPriority(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError+4:
+		return shimmie.PriorityCritical
+	case level >= slog.LevelError:
+		return shimmie.PriorityError
+	case level >= slog.LevelWarn:
+		return shimmie.PriorityWarning
+	case level >= slog.LevelInfo:
+		return shimmie.PriorityInfo
+	default:
+		return shimmie.PriorityDebug
+	}
+}
+
+// Enabled reports whether level is at least the minimum level of h.
+func (h *LogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+// Handle queues r to be written to score_log. Records without a time are
+// dated when they are handled.
+func (h *LogHandler) Handle(ctx context.Context, r slog.Record) error {
+	date := r.Time
+	if date.IsZero() {
+		date = time.Now()
+	}
+	e := shimmie.SCoreLog{DateSent: &date, Section: h.section, Priority: LevelPriority(r.Level)}
+	var extra []string
+	// The attributes of WithAttrs are already nested in their groups.
+	for _, a := range h.attrs {
+		extra = appendAttr(&e, extra, nil, a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		extra = appendAttr(&e, extra, h.groups, a)
+		return true
+	})
+	if e.Username == "" {
+		if u, ok := shimmie.FromContextGetUser(ctx); ok && u != nil {
+			e.Username = u.Name
+		}
+	}
+	e.Message = r.Message
+	if len(extra) != 0 {
+		e.Message += " " + strings.Join(extra, " ")
+	}
+	return h.w.queue(e)
+}
+
+// appendAttr stores a in the column of e that it belongs to or appends it to
+// extra as key=value.
+func appendAttr(e *shimmie.SCoreLog, extra []string, groups []string, a slog.Attr) []string {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return extra
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			groups = append(groups[:len(groups):len(groups)], a.Key)
+		}
+		for _, ga := range a.Value.Group() {
+			extra = appendAttr(e, extra, groups, ga)
+		}
+		return extra
+	}
+	if len(groups) == 0 {
+		switch a.Key {
+		case LogSectionKey:
+			e.Section = a.Value.String()
+			return extra
+		case LogUsernameKey:
+			e.Username = a.Value.String()
+			return extra
+		case LogAddressKey:
+			e.Address = a.Value.String()
+			return extra
+		}
+	}
+	key := strings.Join(append(groups[:len(groups):len(groups)], a.Key), ".")
+	value := a.Value.String()
+	if value == "" || strings.ContainsAny(value, " =\"") {
+		value = strconv.Quote(value)
+	}
+	return append(extra, key+"="+value)
+}
+
+// WithAttrs returns a handler that adds attrs to every record.
+func (h *LogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := *h
+	h2.attrs = make([]slog.Attr, 0, len(h.attrs)+len(attrs))
+	h2.attrs = append(h2.attrs, h.attrs...)
+	if len(h.groups) == 0 {
+		h2.attrs = append(h2.attrs, attrs...)
+	} else {
+		// Nest the attributes in the groups opened after h.attrs.
+		args := make([]interface{}, len(attrs))
+		for i, a := range attrs {
+			args[i] = a
+		}
+		g := slog.Group(h.groups[len(h.groups)-1], args...)
+		for i := len(h.groups) - 2; i >= 0; i-- {
+			g = slog.Group(h.groups[i], g)
+		}
+		h2.attrs = append(h2.attrs, g)
+	}
+	return &h2
+}
+
+// WithGroup returns a handler that qualifies the keys of the attributes
+// that follow with name.
+func (h *LogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.groups = append(h.groups[:len(h.groups):len(h.groups)], name)
+	return &h2
+}
+
+// Flush writes the queued entries and waits for them to be written.
+func (h *LogHandler) Flush() error {
+	h.w.mu.RLock()
+	defer h.w.mu.RUnlock()
+	if h.w.closed {
+		return ErrLogHandlerClosed
+	}
+	ack := make(chan struct{})
+	h.w.flush <- ack
+	<-ack
+	return nil
+}
+
+// Close writes the queued entries and stops the handler. It is shared with
+// the handlers returned by WithAttrs and WithGroup.
+func (h *LogHandler) Close() error {
+	h.w.mu.Lock()
+	if h.w.closed {
+		h.w.mu.Unlock()
+		return nil
+	}
+	h.w.closed = true
+	close(h.w.entries)
+	h.w.mu.Unlock()
+	<-h.w.done
+	return nil
+}
+
+// logWriter writes the entries of a LogHandler and its derived handlers.
+type logWriter struct {
+	db      *DB
+	timeout time.Duration
+	onError func(error)
+	entries chan shimmie.SCoreLog
+	flush   chan chan struct{}
+	done    chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// queue drops e if the queue is full so that a slow database does not block
+// the callers of Handle.
+func (w *logWriter) queue(e shimmie.SCoreLog) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return ErrLogHandlerClosed
+	}
+	select {
+	case w.entries <- e:
+		return nil
+	default:
+		w.report(ErrLogQueueFull)
+		return ErrLogQueueFull
+	}
+}
+
+func (w *logWriter) report(err error) {
+	if w.onError != nil {
+		w.onError(err)
+	}
+}
+
+func (w *logWriter) run(batchSize int, interval time.Duration) {
+	defer close(w.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	batch := make([]shimmie.SCoreLog, 0, batchSize)
+	write := func() {
+		w.write(batch)
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case e, ok := <-w.entries:
+			if !ok {
+				write()
+				return
+			}
+			batch = append(batch, e)
+			if len(batch) >= batchSize {
+				write()
+			}
+		case <-ticker.C:
+			write()
+		case ack := <-w.flush:
+			// Entries queued before Flush was called are already in
+			// the channel.
+			for n := len(w.entries); n > 0; n-- {
+				batch = append(batch, <-w.entries)
+			}
+			write()
+			close(ack)
+		}
+	}
+}
+
+func (w *logWriter) write(batch []shimmie.SCoreLog) {
+	if len(batch) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), w.timeout)
+	defer cancel()
+	if err := w.db.insertLogs(ctx, batch); err != nil {
+		w.report(err)
+	}
+}
+
+// logInsertRows is the most rows that insertLogs puts in one INSERT, which
+// keeps the number of placeholders within the limits of all the dialects.
+const logInsertRows = 500
+
+// insertLogs inserts entries into score_log in a transaction with
+// multi-row INSERTs, keeping their DateSent.
+func (db *DB) insertLogs(ctx context.Context, entries []shimmie.SCoreLog) error {
+	return Tx(ctx, db.DB, func(tx *sql.Tx) error {
+		for len(entries) > 0 {
+			n := len(entries)
+			if n > logInsertRows {
+				n = logInsertRows
+			}
+			rows := make([]string, n)
+			args := make([]interface{}, 0, 6*n)
+			for i, e := range entries[:n] {
+				rows[i] = "(?, ?, ?, ?, ?, ?)"
+				args = append(args, *e.DateSent, e.Section, e.Username, e.Address, e.Priority, e.Message)
+			}
+			query := scoreLogInsertRowsStmt + strings.Join(rows, ",\n")
+			if _, err := tx.ExecContext(ctx, db.rebind(query), args...); err != nil {
+				return err
+			}
+			entries = entries[n:]
+		}
+		return nil
+	})
+}
+
+const scoreLogInsertRowsStmt = `
+INSERT INTO score_log (date_sent, section, username, address, priority, message)
+VALUES
+`
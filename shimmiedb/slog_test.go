@@ -0,0 +1,175 @@
+package shimmiedb_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kusubooru/shimmie"
+	"github.com/kusubooru/shimmie/shimmiedb"
+)
+
+func TestLevelPriority(t *testing.T) {
+	var tests = []struct {
+		level slog.Level
+		want  int
+	}{
+		{slog.LevelDebug - 4, shimmie.PriorityDebug},
+		{slog.LevelDebug, shimmie.PriorityDebug},
+		{slog.LevelInfo, shimmie.PriorityInfo},
+		{slog.LevelInfo + 2, shimmie.PriorityInfo},
+		{slog.LevelWarn, shimmie.PriorityWarning},
+		{slog.LevelError, shimmie.PriorityError},
+		{slog.LevelError + 4, shimmie.PriorityCritical},
+	}
+	for _, tt := range tests {
+		if got := shimmiedb.LevelPriority(tt.level); got != tt.want {
+			t.Errorf("LevelPriority(%v) = %d, want %d", tt.level, got, tt.want)
+		}
+	}
+}
+
+func TestLogHandler(t *testing.T) {
+	shim, schema := openDialect(t, shimmiedb.SQLite, filepath.Join(t.TempDir(), "shimmie.db"))
+	defer teardown(t, shim, schema)
+
+	h := shimmiedb.NewLogHandler(shim, &shimmiedb.LogHandlerOptions{
+		Level:     slog.LevelDebug,
+		BatchSize: 2,
+		OnError:   func(err error) { t.Errorf("writing log entry: %v", err) },
+	})
+	logger := slog.New(h)
+	ctx := shimmie.NewContextWithUser(context.Background(), &shimmie.User{Name: "bob"})
+
+	logger.DebugContext(ctx, "checking")
+	logger.InfoContext(ctx, "image deleted", "section", "image_admin", "address", "10.0.0.1", "id", 42)
+	logger.With("section", "upload").WithGroup("file").Warn("rejected", "username", "ann", "name", "my cat.png")
+	logger.Error("database down", slog.Group("db", "err", "timeout"))
+	logger.Log(ctx, slog.LevelError+4, "disk full")
+	if err := h.Flush(); err != nil {
+		t.Fatalf("Flush returned err: %v", err)
+	}
+	if err := h.Close(); err != nil {
+		t.Fatalf("Close returned err: %v", err)
+	}
+	if err := h.Handle(ctx, slog.Record{}); err != shimmiedb.ErrLogHandlerClosed {
+		t.Errorf("Handle after Close returned err %v, want %v", err, shimmiedb.ErrLogHandlerClosed)
+	}
+
+	logs, _, err := shim.QueryLogs(ctx, shimmie.LogFilter{}, 0, "")
+	if err != nil {
+		t.Fatalf("QueryLogs returned err: %v", err)
+	}
+	var got []shimmie.SCoreLog
+	for i := len(logs) - 1; i >= 0; i-- {
+		l := logs[i]
+		l.ID, l.DateSent = 0, nil
+		got = append(got, l)
+	}
+	want := []shimmie.SCoreLog{
+		{Section: "go", Username: "bob", Priority: shimmie.PriorityDebug, Message: "checking"},
+		{Section: "image_admin", Username: "bob", Address: "10.0.0.1", Priority: shimmie.PriorityInfo, Message: "image deleted id=42"},
+		{Section: "upload", Priority: shimmie.PriorityWarning, Message: `rejected file.username=ann file.name="my cat.png"`},
+		{Section: "go", Priority: shimmie.PriorityError, Message: "database down db.err=timeout"},
+		{Section: "go", Username: "bob", Priority: shimmie.PriorityCritical, Message: "disk full"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("logged entries:\n%#v\nwant:\n%#v", got, want)
+	}
+}
+
+func TestLogHandlerRecordTime(t *testing.T) {
+	shim, schema := openDialect(t, shimmiedb.SQLite, filepath.Join(t.TempDir(), "shimmie.db"))
+	defer teardown(t, shim, schema)
+
+	h := shimmiedb.NewLogHandler(shim, &shimmiedb.LogHandlerOptions{
+		OnError: func(err error) { t.Errorf("writing log entry: %v", err) },
+	})
+	// Entries are dated by their record and not by when they are written.
+	when := time.Date(2020, 5, 17, 10, 30, 0, 0, time.UTC)
+	ctx := context.Background()
+	for i, msg := range []string{"first", "second"} {
+		r := slog.NewRecord(when.Add(time.Duration(i)*time.Minute), slog.LevelInfo, msg, 0)
+		if err := h.Handle(ctx, r); err != nil {
+			t.Fatalf("Handle(%q) returned err: %v", msg, err)
+		}
+	}
+	if err := h.Close(); err != nil {
+		t.Fatalf("Close returned err: %v", err)
+	}
+
+	logs, _, err := shim.QueryLogs(ctx, shimmie.LogFilter{}, 0, "")
+	if err != nil {
+		t.Fatalf("QueryLogs returned err: %v", err)
+	}
+	if len(logs) != 2 {
+		t.Fatalf("QueryLogs returned %d entries, want 2", len(logs))
+	}
+	for i, l := range logs {
+		want := when.Add(time.Duration(1-i) * time.Minute)
+		if l.DateSent == nil || !l.DateSent.Equal(want) {
+			t.Errorf("entry %q has date %v, want %v", l.Message, l.DateSent, want)
+		}
+	}
+}
+
+func TestLogHandlerSlowDatabase(t *testing.T) {
+	shim, schema := openDialect(t, shimmiedb.SQLite, filepath.Join(t.TempDir(), "shimmie.db"))
+	defer teardown(t, shim, schema)
+
+	var (
+		mu   sync.Mutex
+		errs []error
+	)
+	h := shimmiedb.NewLogHandler(shim, &shimmiedb.LogHandlerOptions{
+		BatchSize:    1,
+		WriteTimeout: 100 * time.Millisecond,
+		OnError: func(err error) {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+		},
+	})
+	// The transaction holds the only SQLite connection so writes hang until
+	// their timeout.
+	tx, err := shim.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(h)
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			logger.Info("busy")
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("logging blocked while the database was busy")
+	}
+	time.Sleep(300 * time.Millisecond)
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Close(); err != nil {
+		t.Fatalf("Close returned err: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	var full, timeout bool
+	for _, err := range errs {
+		full = full || err == shimmiedb.ErrLogQueueFull
+		timeout = timeout || errors.Is(err, context.DeadlineExceeded)
+	}
+	if !full || !timeout {
+		t.Errorf("OnError got %v, want %v and a deadline exceeded error", errs, shimmiedb.ErrLogQueueFull)
+	}
+}
@@ -0,0 +1,318 @@
+package shimmiedb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) rebind(query string) string { return query }
+func (sqliteDialect) like() string               { return "LIKE" }
+func (sqliteDialect) createStatements() []string { return sqliteCreateStatements }
+func (sqliteDialect) alterStatements() []string  { return nil }
+func (sqliteDialect) ignoreAlterErr(error) bool  { return false }
+func (sqliteDialect) allTablesQuery() string     { return sqliteAllTablesQuery }
+
+// forUpdate is empty since SQLite does not lock rows. Transactions are
+// serialized anyway by the single connection that open allows.
+func (sqliteDialect) forUpdate() string { return "" }
+
+// open enables foreign keys, which SQLite turns off by default, and stores
+// times in a format that sorts correctly as text. A single connection is used
+// since SQLite allows only one writer at a time and each connection to an
+// in-memory database would get a database of its own.
+func (sqliteDialect) open(dataSource string) (*sql.DB, error) {
+	sep := "?"
+	if strings.Contains(dataSource, "?") {
+		sep = "&"
+	}
+	dataSource += sep + "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_time_format=sqlite"
+	db, err := sql.Open("sqlite", dataSource)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+// ratedImageID relies on CAST ignoring everything after the leading digits.
+func (sqliteDialect) ratedImageID() string {
+	return "CAST(SUBSTR(message, INSTR(message, '#') + 1) AS INTEGER)"
+}
+
+func (sqliteDialect) insertIgnore(query string) string {
+	return strings.TrimRight(query, "; \n\t") + " ON CONFLICT DO NOTHING"
+}
+
+func (sqliteDialect) insert(ctx context.Context, db execQueryer, query string, args ...interface{}) (int64, error) {
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// truncateTablesStmt deletes all rows since SQLite has no TRUNCATE and resets
+// the AUTOINCREMENT counters kept in sqlite_sequence.
+func (sqliteDialect) truncateTablesStmt(tables []string) string {
+	b := strings.Builder{}
+	b.WriteString("PRAGMA foreign_keys=OFF;\n")
+	for _, t := range tables {
+		b.WriteString(fmt.Sprintf("DELETE FROM %s;\n", t))
+	}
+	b.WriteString("DELETE FROM sqlite_sequence;\n")
+	b.WriteString("PRAGMA foreign_keys=ON;")
+	return b.String()
+}
+
+const sqliteAllTablesQuery = `
+	SELECT name
+	FROM sqlite_master
+	WHERE type = 'table'
+	  AND name NOT LIKE 'sqlite_%';`
+
+var sqliteCreateStatements = []string{
+	sqliteUsersCreateTableStmt,
+	sqliteImagesCreateTableStmt,
+	sqliteTagsCreateTableStmt,
+	sqliteTagHistoriesCreateTableStmt,
+	sqliteImageTagsCreateTableStmt,
+	sqliteAliasesCreateTableStmt,
+	sqlitePrivateMessageTableStmt,
+	sqlitePMStatesCreateTableStmt,
+	sqliteScoreLogCreateTableStmt,
+	sqliteConfigCreateTableStmt,
+	sqlitePMBlocksCreateTableStmt,
+	sqlitePMRateLimitsCreateTableStmt,
+	sqlitePMFlagsCreateTableStmt,
+	sqliteImagePHashesCreateTableStmt,
+	sqliteImageBansCreateTableStmt,
+	sqliteIPBansCreateTableStmt,
+	sqlitePoolsCreateTableStmt,
+	sqlitePoolImagesCreateTableStmt,
+	sqlitePoolHistoryCreateTableStmt,
+	sqliteUserFavoritesCreateTableStmt,
+	sqliteNumericScoreVotesCreateTableStmt,
+}
+
+// The SQLite schema is always created from scratch so the tables already
+// include the columns that alterStatements add to MySQL. Columns that hold
+// times are declared as TIMESTAMP or DATETIME so that the driver scans them
+// into time.Time.
+const (
+	sqliteUsersCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name VARCHAR(32) NOT NULL UNIQUE,
+	pass VARCHAR(250),
+	joindate TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	admin CHAR(1) NOT NULL DEFAULT 'N' CHECK (admin IN ('Y', 'N')),
+	email VARCHAR(128),
+	class VARCHAR(32) NOT NULL DEFAULT 'user'
+);
+`
+	sqliteImagesCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS images (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	owner_id INTEGER NOT NULL REFERENCES users (id) ON DELETE RESTRICT,
+	owner_ip VARCHAR(15) NOT NULL,
+	filename VARCHAR(64) NOT NULL,
+	filesize INTEGER NOT NULL,
+	hash VARCHAR(32) UNIQUE NOT NULL,
+	ext VARCHAR(4) NOT NULL,
+	source VARCHAR(255),
+	width INTEGER NOT NULL,
+	height INTEGER NOT NULL,
+	posted TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	locked CHAR(1) NOT NULL DEFAULT 'N' CHECK (locked IN ('Y', 'N')),
+	numeric_score INTEGER NOT NULL DEFAULT 0,
+	rating CHAR(1) NOT NULL DEFAULT '?',
+	favorites INTEGER NOT NULL DEFAULT 0,
+	parent_id INTEGER NULL,
+	has_children BOOLEAN NOT NULL DEFAULT FALSE,
+	author VARCHAR(255) NULL,
+	notes INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS images__posted ON images (posted);
+CREATE INDEX IF NOT EXISTS images__numeric_score ON images (numeric_score);
+`
+	sqliteTagsCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS tags (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	tag VARCHAR(64) NOT NULL UNIQUE,
+	count INTEGER NOT NULL DEFAULT 0
+);
+`
+	sqliteTagHistoriesCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS tag_histories (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	image_id INTEGER NOT NULL REFERENCES images (id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	user_ip VARCHAR(15) NOT NULL,
+	tags TEXT NOT NULL,
+	date_set DATETIME NOT NULL
+);
+`
+	sqliteImageTagsCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS image_tags (
+	image_id INTEGER NOT NULL REFERENCES images (id) ON DELETE CASCADE,
+	tag_id INTEGER NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+	UNIQUE (image_id, tag_id)
+);
+CREATE INDEX IF NOT EXISTS image_tags__tag_id ON image_tags (tag_id);
+`
+	sqliteAliasesCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS aliases (
+	oldtag VARCHAR(128) PRIMARY KEY,
+	newtag VARCHAR(128) NOT NULL
+);
+CREATE INDEX IF NOT EXISTS aliases__newtag ON aliases (newtag);
+`
+	sqlitePrivateMessageTableStmt = `
+CREATE TABLE IF NOT EXISTS private_message (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	from_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	from_ip VARCHAR(15) NOT NULL,
+	to_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	sent_date DATETIME NOT NULL,
+	subject VARCHAR(64) NOT NULL,
+	message TEXT NOT NULL,
+	is_read CHAR(1) NOT NULL DEFAULT 'N' CHECK (is_read IN ('Y', 'N'))
+);
+CREATE INDEX IF NOT EXISTS private_message__to_id ON private_message (to_id);
+CREATE INDEX IF NOT EXISTS private_message__from_id ON private_message (from_id);
+CREATE INDEX IF NOT EXISTS private_message__inbox ON private_message (to_id, from_id, is_read);
+CREATE INDEX IF NOT EXISTS private_message__from_id_sent_date ON private_message (from_id, sent_date);
+`
+	sqlitePMStatesCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS pm_states (
+	pm_id INTEGER PRIMARY KEY REFERENCES private_message (id) ON DELETE CASCADE,
+	parent_id INTEGER NULL,
+	deleted_by_sender BOOLEAN NOT NULL DEFAULT FALSE,
+	deleted_by_recipient BOOLEAN NOT NULL DEFAULT FALSE
+);
+`
+	sqliteScoreLogCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS score_log (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	date_sent DATETIME NOT NULL,
+	section VARCHAR(32) NOT NULL,
+	username VARCHAR(32) NOT NULL,
+	address VARCHAR(45) NOT NULL,
+	priority INTEGER NOT NULL,
+	message TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS score_log__section ON score_log (section);
+CREATE INDEX IF NOT EXISTS score_log__username ON score_log (username);
+CREATE INDEX IF NOT EXISTS score_log__address ON score_log (address);
+CREATE INDEX IF NOT EXISTS score_log__date_sent ON score_log (date_sent);
+`
+	sqliteConfigCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS config (
+	name VARCHAR(128) PRIMARY KEY,
+	value TEXT
+);
+`
+	sqlitePMBlocksCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS pm_blocks (
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	blocked_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	created DATETIME NOT NULL,
+	PRIMARY KEY (user_id, blocked_id)
+);
+`
+	sqlitePMRateLimitsCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS pm_rate_limits (
+	user_id INTEGER PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+	messages INTEGER NOT NULL,
+	period_seconds INTEGER NOT NULL
+);
+`
+	sqlitePMFlagsCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS pm_flags (
+	pm_id INTEGER PRIMARY KEY REFERENCES private_message (id) ON DELETE CASCADE
+);
+`
+	sqliteImagePHashesCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS image_phashes (
+	image_id INTEGER PRIMARY KEY REFERENCES images (id) ON DELETE CASCADE,
+	phash BIGINT NOT NULL
+);
+`
+	sqliteImageBansCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS image_bans (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	hash CHAR(32) NOT NULL,
+	date DATETIME NOT NULL,
+	reason TEXT NOT NULL,
+	user_id INTEGER NULL REFERENCES users (id) ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS image_bans__hash ON image_bans (hash);
+`
+	sqliteIPBansCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS bans (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	banner_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	ip VARCHAR(45) NOT NULL,
+	reason TEXT NOT NULL,
+	added DATETIME NOT NULL,
+	expires DATETIME NULL
+);
+CREATE INDEX IF NOT EXISTS bans__expires ON bans (expires);
+`
+	sqlitePoolsCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS pools (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	public BOOLEAN NOT NULL DEFAULT FALSE,
+	title VARCHAR(255) NOT NULL,
+	description TEXT,
+	date DATETIME NOT NULL,
+	posts INTEGER NOT NULL DEFAULT 0,
+	lastupdated DATETIME NULL
+);
+CREATE INDEX IF NOT EXISTS pools__title ON pools (title);
+`
+	sqlitePoolImagesCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS pool_images (
+	pool_id INTEGER NOT NULL REFERENCES pools (id) ON DELETE CASCADE,
+	image_id INTEGER NOT NULL REFERENCES images (id) ON DELETE CASCADE,
+	image_order INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (pool_id, image_id)
+);
+CREATE INDEX IF NOT EXISTS pool_images__image_id ON pool_images (image_id);
+`
+	sqlitePoolHistoryCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS pool_history (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	pool_id INTEGER NOT NULL REFERENCES pools (id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	action INTEGER NOT NULL,
+	images TEXT,
+	count INTEGER NOT NULL DEFAULT 0,
+	date DATETIME NOT NULL
+);
+`
+	sqliteUserFavoritesCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS user_favorites (
+	image_id INTEGER NOT NULL REFERENCES images (id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	created_at DATETIME NOT NULL,
+	UNIQUE (image_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS user_favorites__user_id ON user_favorites (user_id, created_at);
+CREATE INDEX IF NOT EXISTS user_favorites__created_at ON user_favorites (created_at);
+`
+	sqliteNumericScoreVotesCreateTableStmt = `
+CREATE TABLE IF NOT EXISTS numeric_score_votes (
+	image_id INTEGER NOT NULL REFERENCES images (id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	score INTEGER NOT NULL,
+	UNIQUE (image_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS numeric_score_votes__user_id ON numeric_score_votes (user_id);
+`
+)
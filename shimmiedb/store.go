@@ -1,10 +1,13 @@
 package shimmiedb
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"time"
 
+	"github.com/kusubooru/shimmie"
+
 	// mysql driver
 	_ "github.com/go-sql-driver/mysql"
 )
@@ -12,27 +15,87 @@ import (
 // DB has methods for most operations needed in the shimmie database.
 type DB struct {
 	*sql.DB
+	dialect Dialect
+}
+
+var (
+	_ shimmie.UserGetter        = (*DB)(nil)
+	_ shimmie.UserStore         = (*DB)(nil)
+	_ shimmie.ImageStore        = (*DB)(nil)
+	_ shimmie.RelationshipStore = (*DB)(nil)
+	_ shimmie.FavoriteStore     = (*DB)(nil)
+	_ shimmie.ScoreStore        = (*DB)(nil)
+	_ shimmie.PHashStore        = (*DB)(nil)
+	_ shimmie.HashBanStore      = (*DB)(nil)
+	_ shimmie.IPBanStore        = (*DB)(nil)
+	_ shimmie.PoolStore         = (*DB)(nil)
+	_ shimmie.TagStore          = (*DB)(nil)
+	_ shimmie.TagHistoryStore   = (*DB)(nil)
+	_ shimmie.AliasStore        = (*DB)(nil)
+	_ shimmie.PMStore           = (*DB)(nil)
+	_ shimmie.LogStore          = (*DB)(nil)
+	_ shimmie.ConfigStore       = (*DB)(nil)
+)
+
+// defaultPageLimit is the number of entries returned by the keyset paginated
+// listings when no positive limit is given.
+const defaultPageLimit = 50
+
+func pageLimit(limit int) int {
+	if limit <= 0 {
+		return defaultPageLimit
+	}
+	return limit
 }
 
-// Open creates a database connection for the given driver and configuration.
+// Open creates a MySQL database connection for the given configuration.
 func Open(dataSource string, pingRetries int) (*DB, error) {
-	db, err := openDB(dataSource, pingRetries)
+	return OpenDialect(MySQL, dataSource, pingRetries)
+}
+
+// OpenDialect creates a database connection for the given dialect and
+// configuration.
+func OpenDialect(d Dialect, dataSource string, pingRetries int) (*DB, error) {
+	db, err := openDB(d, dataSource, pingRetries)
 	if err != nil {
 		return nil, err
 	}
-	return &DB{db}, nil
+	return &DB{DB: db, dialect: d}, nil
+}
+
+// sqlDialect returns the dialect of the database. A DB that was not created
+// by Open or OpenDialect is assumed to be MySQL.
+func (db *DB) sqlDialect() Dialect {
+	if db.dialect == nil {
+		return MySQL
+	}
+	return db.dialect
+}
+
+// rebind converts a query written with ? placeholders to the dialect of db.
+func (db *DB) rebind(query string) string {
+	return db.sqlDialect().rebind(query)
+}
+
+// like returns the case insensitive LIKE operator of the dialect of db.
+func (db *DB) like() string {
+	return db.sqlDialect().like()
+}
+
+// insert executes an insert statement written with ? placeholders and returns
+// the ID of the new row.
+func (db *DB) insert(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	d := db.sqlDialect()
+	return d.insert(ctx, db.DB, d.rebind(query), args...)
 }
 
 // openDB opens a new database connection with the specified connection string.
-func openDB(dataSource string, pingRetries int) (*sql.DB, error) {
-	db, err := sql.Open("mysql", dataSource)
+func openDB(d Dialect, dataSource string, pingRetries int) (*sql.DB, error) {
+	db, err := d.open(dataSource)
 	if err != nil {
 		return nil, fmt.Errorf("opening db: %v", err)
 	}
 
-	// per issue https://github.com/go-sql-driver/mysql/issues/257
-	db.SetMaxIdleConns(0)
-
 	if err := pingDatabase(db, pingRetries); err != nil {
 		return nil, fmt.Errorf("pinging db %d times: %v", pingRetries, err)
 	}
@@ -54,9 +117,10 @@ func pingDatabase(db *sql.DB, pingRetries int) (err error) {
 }
 
 // Tx allows to perform a function in a transaction. It detects error and panic
-// and in that case it rollbacks otherwise it commits the transaction.
-func Tx(db *sql.DB, txFunc func(*sql.Tx) error) (err error) {
-	tx, err := db.Begin()
+// and in that case it rollbacks otherwise it commits the transaction. If ctx
+// is canceled before the transaction is committed, it is rolled back.
+func Tx(ctx context.Context, db *sql.DB, txFunc func(*sql.Tx) error) (err error) {
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return
 	}
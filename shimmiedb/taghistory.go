@@ -13,46 +13,22 @@ func (db *DB) CreateTagHistory(ctx context.Context, th shimmie.TagHistory) (int6
 		now := time.Now()
 		th.DateSet = &now
 	}
-	const query = `
-	INSERT INTO tag_histories(
-		id,
-		image_id,
-		user_id,
-		user_ip,
-		tags,
-		date_set
-	) values (
-		?,
-		?,
-		?,
-		?,
-		?,
-		?
-	);`
-
-	stmt, err := db.Prepare(query)
-	if err != nil {
-		return 0, err
+	args := []interface{}{
+		th.ImageID,
+		th.UserID,
+		th.UserIP,
+		th.Tags,
+		th.DateSet,
 	}
-	defer stmt.Close()
-
-	res, err := stmt.ExecContext(ctx,
-		&th.ID,
-		&th.ImageID,
-		&th.UserID,
-		&th.UserIP,
-		&th.Tags,
-		&th.DateSet,
-	)
-	if err != nil {
-		return 0, err
+	if th.ID != 0 {
+		return db.insert(ctx, tagHistoryInsertWithIDStmt, append([]interface{}{th.ID}, args...)...)
 	}
-	return res.LastInsertId()
+	return db.insert(ctx, tagHistoryInsertStmt, args...)
 }
 
 // GetImageTagHistory returns the previous tags of an image.
-func (db *DB) GetImageTagHistory(imageID int) ([]shimmie.TagHistory, error) {
-	rows, err := db.Query(imageTagHistoryGetQuery, imageID)
+func (db *DB) GetImageTagHistory(ctx context.Context, imageID int) ([]shimmie.TagHistory, error) {
+	rows, err := db.QueryContext(ctx, db.rebind(imageTagHistoryGetQuery), imageID)
 	if err != nil {
 		return nil, err
 	}
@@ -84,9 +60,9 @@ func (db *DB) GetImageTagHistory(imageID int) ([]shimmie.TagHistory, error) {
 }
 
 // GetTagHistory returns a tag_history row.
-func (db *DB) GetTagHistory(id int) (*shimmie.TagHistory, error) {
+func (db *DB) GetTagHistory(ctx context.Context, id int) (*shimmie.TagHistory, error) {
 	var th shimmie.TagHistory
-	err := db.QueryRow(tagHistoryGetQuery, id).Scan(
+	err := db.QueryRowContext(ctx, db.rebind(tagHistoryGetQuery), id).Scan(
 		&th.ID,
 		&th.ImageID,
 		&th.UserID,
@@ -103,8 +79,8 @@ func (db *DB) GetTagHistory(id int) (*shimmie.TagHistory, error) {
 // GetContributedTagHistory returns the latest tag history i.e. tag changes
 // that were done by a contributor on an owner's image, per image. It is
 // used to fetch data for the "Tag Approval" page.
-func (db *DB) GetContributedTagHistory(imageOwnerUsername string) ([]shimmie.ContributedTagHistory, error) {
-	rows, err := db.Query(contributedTagHistoryGetQuery, imageOwnerUsername)
+func (db *DB) GetContributedTagHistory(ctx context.Context, imageOwnerUsername string) ([]shimmie.ContributedTagHistory, error) {
+	rows, err := db.QueryContext(ctx, db.rebind(contributedTagHistoryGetQuery), imageOwnerUsername)
 	if err != nil {
 		return nil, err
 	}
@@ -138,15 +114,30 @@ func (db *DB) GetContributedTagHistory(imageOwnerUsername string) ([]shimmie.Con
 }
 
 const (
+	tagHistoryInsertStmt = `
+INSERT INTO tag_histories (image_id, user_id, user_ip, tags, date_set)
+VALUES (?, ?, ?, ?, ?)
+`
+	tagHistoryInsertWithIDStmt = `
+INSERT INTO tag_histories (id, image_id, user_id, user_ip, tags, date_set)
+VALUES (?, ?, ?, ?, ?, ?)
+`
 	imageTagHistoryGetQuery = `
-SELECT tag_histories.*, users.name
+SELECT
+  tag_histories.id,
+  tag_histories.image_id,
+  tag_histories.user_id,
+  tag_histories.user_ip,
+  tag_histories.tags,
+  tag_histories.date_set,
+  users.name
 FROM tag_histories
 JOIN users ON tag_histories.user_id = users.id
 WHERE image_id = ?
 ORDER BY tag_histories.id DESC
 `
 	tagHistoryGetQuery = `
-SELECT *
+SELECT id, image_id, user_id, user_ip, tags, date_set
 FROM tag_histories
 WHERE id = ?
 `
@@ -1,15 +1,17 @@
 package shimmiedb
 
 import (
+	"context"
+
 	"github.com/kusubooru/shimmie"
 )
 
 // GetTag returns an image tag.
-func (db *DB) GetTag(oldTag string) (*shimmie.Tag, error) {
+func (db *DB) GetTag(ctx context.Context, oldTag string) (*shimmie.Tag, error) {
 	var (
 		t shimmie.Tag
 	)
-	err := db.QueryRow(tagGetQuery, oldTag).Scan(
+	err := db.QueryRowContext(ctx, db.rebind(tagGetQuery), oldTag).Scan(
 		&t.ID,
 		&t.Tag,
 		&t.Count,
@@ -21,8 +23,8 @@ func (db *DB) GetTag(oldTag string) (*shimmie.Tag, error) {
 }
 
 // DeleteTag deletes an image tag.
-func (db *DB) DeleteTag(name string) error {
-	stmt, err := db.Prepare(tagDeleteStmt)
+func (db *DB) DeleteTag(ctx context.Context, name string) error {
+	stmt, err := db.PrepareContext(ctx, db.rebind(tagDeleteStmt))
 	if err != nil {
 		return err
 	}
@@ -32,15 +34,15 @@ func (db *DB) DeleteTag(name string) error {
 			return
 		}
 	}()
-	if _, err := stmt.Exec(name); err != nil {
+	if _, err := stmt.ExecContext(ctx, name); err != nil {
 		return err
 	}
 	return nil
 }
 
 // CreateTag inserts an image tag to the db.
-func (db *DB) CreateTag(t *shimmie.Tag) error {
-	stmt, err := db.Prepare(tagInsertStmt)
+func (db *DB) CreateTag(ctx context.Context, t *shimmie.Tag) error {
+	stmt, err := db.PrepareContext(ctx, db.rebind(tagInsertStmt))
 	if err != nil {
 		return err
 	}
@@ -50,13 +52,13 @@ func (db *DB) CreateTag(t *shimmie.Tag) error {
 			return
 		}
 	}()
-	_, err = stmt.Exec(t.Tag, t.Count)
+	_, err = stmt.ExecContext(ctx, t.Tag, t.Count)
 	return err
 }
 
 // GetAllTags returns all stored tags.
-func (db *DB) GetAllTags(limit, offset int) ([]*shimmie.Tag, error) {
-	rows, err := db.Query(tagsGetAllQuery, limit, offset)
+func (db *DB) GetAllTags(ctx context.Context, limit, offset int) ([]*shimmie.Tag, error) {
+	rows, err := db.QueryContext(ctx, db.rebind(tagsGetAllQuery), limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -83,9 +85,59 @@ func (db *DB) GetAllTags(limit, offset int) ([]*shimmie.Tag, error) {
 	return tags, err
 }
 
+// ListTags returns a page of tags ordered by ID along with the cursor token of
+// the next page. An empty cursor returns the first page and an empty next
+// cursor is returned when there are no more pages. If limit <= 0 then a
+// default page size is used.
+func (db *DB) ListTags(ctx context.Context, limit int, cursor string) ([]*shimmie.Tag, string, error) {
+	c, err := shimmie.DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	limit = pageLimit(limit)
+	var afterID int64
+	if c != nil {
+		afterID = c.ID
+	}
+	rows, err := db.QueryContext(ctx, db.rebind(tagsListQuery), afterID, limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() {
+		if cerr := rows.Close(); err == nil {
+			err = cerr
+			return
+		}
+	}()
+
+	var tags []*shimmie.Tag
+	for rows.Next() {
+		var t shimmie.Tag
+		err = rows.Scan(
+			&t.ID,
+			&t.Tag,
+			&t.Count,
+		)
+		if err != nil {
+			return nil, "", err
+		}
+		tags = append(tags, &t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(tags) > limit {
+		tags = tags[:limit]
+		next = shimmie.Cursor{ID: int64(tags[limit-1].ID)}.Encode()
+	}
+	return tags, next, nil
+}
+
 const (
 	tagGetQuery = `
-SELECT *
+SELECT id, tag, count
 FROM tags
 WHERE tag = ?
 `
@@ -97,14 +149,20 @@ WHERE tag = ?
 `
 
 	tagInsertStmt = `
-INSERT tags
-SET
-  tag = ?,
-  count = ?
+INSERT INTO tags (tag, count)
+VALUES (?, ?)
 `
 	tagsGetAllQuery = `
-SELECT *
+SELECT id, tag, count
 FROM tags
+ORDER BY id
 LIMIT ? OFFSET ?
+`
+	tagsListQuery = `
+SELECT id, tag, count
+FROM tags
+WHERE id > ?
+ORDER BY id
+LIMIT ?
 `
 )
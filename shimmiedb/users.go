@@ -1,28 +1,33 @@
 package shimmiedb
 
 import (
+	"context"
 	"database/sql"
 
 	"github.com/kusubooru/shimmie"
 )
 
 // GetUser gets a user by ID.
-func (db *DB) GetUser(userID int64) (*shimmie.User, error) {
-	return db.getUserBy(userGetQuery, userID)
+func (db *DB) GetUser(ctx context.Context, userID int64) (*shimmie.User, error) {
+	return db.getUserBy(ctx, userGetQuery, userID)
 }
 
 // GetUserByName gets a user by unique username.
-func (db *DB) GetUserByName(username string) (*shimmie.User, error) {
-	return db.getUserBy(userGetByNameQuery, username)
+func (db *DB) GetUserByName(ctx context.Context, username string) (*shimmie.User, error) {
+	return db.getUserBy(ctx, userGetByNameQuery, username)
 }
 
-func (db *DB) getUserBy(query string, id interface{}) (*shimmie.User, error) {
+func (db *DB) getUserBy(ctx context.Context, query string, id interface{}) (*shimmie.User, error) {
+	return scanUser(db.QueryRowContext(ctx, db.rebind(query), id))
+}
+
+func scanUser(row scanner) (*shimmie.User, error) {
 	var (
 		u     shimmie.User
 		pass  sql.NullString
 		email sql.NullString
 	)
-	err := db.QueryRow(query, id).Scan(
+	err := row.Scan(
 		&u.ID,
 		&u.Name,
 		&pass,
@@ -43,27 +48,25 @@ func (db *DB) getUserBy(query string, id interface{}) (*shimmie.User, error) {
 	return &u, nil
 }
 
-// DeleteUser deletes a user based on their ID.
-func (db *DB) DeleteUser(id int64) error {
-	stmt, err := db.Prepare(userDeleteStmt)
-	if err != nil {
-		return err
-	}
-	defer func() {
-		if cerr := stmt.Close(); err == nil {
-			err = cerr
-			return
+// DeleteUser deletes a user based on their ID. The favorites counts and
+// numeric scores of the images that the user has favorited or voted are
+// updated.
+func (db *DB) DeleteUser(ctx context.Context, id int64) error {
+	return Tx(ctx, db.DB, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, db.rebind(userDeleteFavoritesStmt), id); err != nil {
+			return err
 		}
-	}()
-	if _, err := stmt.Exec(id); err != nil {
+		if _, err := tx.ExecContext(ctx, db.rebind(userDeleteVotesStmt), id, id); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, db.rebind(userDeleteStmt), id)
 		return err
-	}
-	return nil
+	})
 }
 
 // CreateUser creates a new user and returns their ID.
-func (db *DB) CreateUser(u *shimmie.User) error {
-	stmt, err := db.Prepare(userInsertStmt)
+func (db *DB) CreateUser(ctx context.Context, u *shimmie.User) error {
+	stmt, err := db.PrepareContext(ctx, db.rebind(userInsertStmt))
 	if err != nil {
 		return err
 	}
@@ -80,16 +83,16 @@ func (db *DB) CreateUser(u *shimmie.User) error {
 		u.Admin = "N"
 	}
 	hash := shimmie.PasswordHash(u.Name, u.Pass)
-	_, err = stmt.Exec(u.Name, hash, u.Email, u.Class)
+	_, err = stmt.ExecContext(ctx, u.Name, hash, u.Class, u.Email)
 	if err != nil {
 		return err
 	}
 
 	// Executing an extra statement in order to get the value of JoinDate as
-	// its value is created by the database with NOW(). Creating the value of
-	// JoinDate with time.Now() beforehand, results in slightly different dates
-	// as time.Time has 9 point decimal precision while MySQL DATETIME has 6 at
-	// max.
+	// its value is created by the database with CURRENT_TIMESTAMP. Creating
+	// the value of JoinDate with time.Now() beforehand, results in slightly
+	// different dates as time.Time has 9 point decimal precision while MySQL
+	// DATETIME has 6 at max.
 	//
 	// If a better solution for getting the JoinDate value can be found then we
 	// can avoid the extra execution by simply filling the value of ID:
@@ -99,7 +102,7 @@ func (db *DB) CreateUser(u *shimmie.User) error {
 	//		return err
 	//    }
 	//    u.ID = id
-	storedUser, err := db.GetUserByName(u.Name)
+	storedUser, err := db.GetUserByName(ctx, u.Name)
 	if err != nil {
 		return err
 	}
@@ -109,15 +112,15 @@ func (db *DB) CreateUser(u *shimmie.User) error {
 }
 
 // CountUsers returns how many user entries exist in the database.
-func (db *DB) CountUsers() (int, error) {
-	return count(db.DB, userCountQuery)
+func (db *DB) CountUsers(ctx context.Context) (int, error) {
+	return count(ctx, db.DB, db.rebind(userCountQuery))
 }
 
-func count(db *sql.DB, query string) (int, error) {
+func count(ctx context.Context, db *sql.DB, query string) (int, error) {
 	var (
 		count int
 	)
-	err := db.QueryRow(query).Scan(&count)
+	err := db.QueryRowContext(ctx, query).Scan(&count)
 	if err != nil {
 		return -1, err
 	}
@@ -129,15 +132,15 @@ func count(db *sql.DB, query string) (int, error) {
 // maximum limit and return all user entries. Offset still works in this
 // case. For example, assuming 10 entries, GetAllUsers(-1, 0), will return
 // all 10 entries and GetAllUsers(-1, 8) will return the last 2 entries.
-func (db *DB) GetAllUsers(limit, offset int) ([]shimmie.User, error) {
+func (db *DB) GetAllUsers(ctx context.Context, limit, offset int) ([]shimmie.User, error) {
 	if limit < 0 {
-		count, cerr := db.CountUsers()
+		count, cerr := db.CountUsers(ctx)
 		if cerr != nil {
 			return nil, cerr
 		}
 		limit = count
 	}
-	rows, err := db.Query(userGetAllQuery, limit, offset)
+	rows, err := db.QueryContext(ctx, db.rebind(userGetAllQuery), limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -150,53 +153,92 @@ func (db *DB) GetAllUsers(limit, offset int) ([]shimmie.User, error) {
 
 	var users []shimmie.User
 	for rows.Next() {
-		var (
-			u     shimmie.User
-			pass  sql.NullString
-			email sql.NullString
-		)
-		err = rows.Scan(
-			&u.ID,
-			&u.Name,
-			&pass,
-			&u.JoinDate,
-			&u.Admin,
-			&email,
-			&u.Class,
-		)
+		u, err := scanUser(rows)
 		if err != nil {
 			return nil, err
 		}
-		if pass.Valid {
-			u.Pass = pass.String
+		users = append(users, *u)
+	}
+	return users, err
+}
+
+// ListUsers returns a page of users ordered by ID along with the cursor token
+// of the next page. An empty cursor returns the first page and an empty next
+// cursor is returned when there are no more pages. If limit <= 0 then a
+// default page size is used.
+func (db *DB) ListUsers(ctx context.Context, limit int, cursor string) ([]shimmie.User, string, error) {
+	c, err := shimmie.DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	limit = pageLimit(limit)
+	var afterID int64
+	if c != nil {
+		afterID = c.ID
+	}
+	rows, err := db.QueryContext(ctx, db.rebind(userListQuery), afterID, limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() {
+		if cerr := rows.Close(); err == nil {
+			err = cerr
+			return
 		}
-		if email.Valid {
-			u.Email = email.String
+	}()
+
+	var users []shimmie.User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, "", err
 		}
-		users = append(users, u)
+		users = append(users, *u)
 	}
-	return users, err
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(users) > limit {
+		users = users[:limit]
+		next = shimmie.Cursor{ID: users[limit-1].ID}.Encode()
+	}
+	return users, next, nil
 }
 
 const (
+	// userColumns are the columns of the users table in the order expected
+	// by scanUser.
+	userColumns = `id, name, pass, joindate, admin, email, class`
+
 	userGetQuery = `
-SELECT *
+SELECT ` + userColumns + `
 FROM users
 WHERE id = ?
 `
 	userGetByNameQuery = `
-SELECT *
+SELECT ` + userColumns + `
 FROM users
 WHERE name = ?
 `
 	userInsertStmt = `
-INSERT users
-SET
-  name=?,
-  pass=?,
-  joindate=NOW(),
-  class=?,
-  email=?
+INSERT INTO users (name, pass, joindate, class, email)
+VALUES (?, ?, CURRENT_TIMESTAMP, ?, ?)
+`
+	userDeleteFavoritesStmt = `
+UPDATE images
+SET favorites = favorites - 1
+WHERE id IN (SELECT image_id FROM user_favorites WHERE user_id = ?)
+`
+	userDeleteVotesStmt = `
+UPDATE images
+SET numeric_score = numeric_score - (
+	SELECT score
+	FROM numeric_score_votes
+	WHERE image_id = images.id AND user_id = ?
+)
+WHERE id IN (SELECT image_id FROM numeric_score_votes WHERE user_id = ?)
 `
 	userDeleteStmt = `
 DELETE
@@ -210,8 +252,17 @@ FROM users
 `
 
 	userGetAllQuery = `
-SELECT *
+SELECT ` + userColumns + `
 FROM users
+ORDER BY id
 LIMIT ? OFFSET ?
+`
+
+	userListQuery = `
+SELECT ` + userColumns + `
+FROM users
+WHERE id > ?
+ORDER BY id
+LIMIT ?
 `
 )
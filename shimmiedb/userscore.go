@@ -1,10 +1,14 @@
 package shimmiedb
 
-import "github.com/kusubooru/shimmie"
+import (
+	"context"
+
+	"github.com/kusubooru/shimmie"
+)
 
 // MostImageUploads can be used to find which users have the highest number of
 // image uploads.
-func (db *DB) MostImageUploads(limit int) ([]shimmie.UserScore, error) {
+func (db *DB) MostImageUploads(ctx context.Context, limit int) ([]shimmie.UserScore, error) {
 	const query = `
 	SELECT
 		count(img.owner_id) as score,
@@ -16,16 +20,16 @@ func (db *DB) MostImageUploads(limit int) ([]shimmie.UserScore, error) {
 	FROM images img
 	  JOIN users u
 	  ON img.owner_id=u.id
-	GROUP BY img.owner_id
+	GROUP BY u.id
 	ORDER BY score DESC
 	LIMIT ?;`
 
-	return db.userScore(query, limit)
+	return db.userScore(ctx, query, limit)
 }
 
 // MostTagEdits can be used to find which users have the highest number of tag
 // edits.
-func (db *DB) MostTagEdits(limit int) ([]shimmie.UserScore, error) {
+func (db *DB) MostTagEdits(ctx context.Context, limit int) ([]shimmie.UserScore, error) {
 	const query = `
 	SELECT
 		count(th.user_id) as score,
@@ -37,15 +41,15 @@ func (db *DB) MostTagEdits(limit int) ([]shimmie.UserScore, error) {
 	FROM tag_histories th
 	  JOIN users u
 	  ON th.user_id=u.id
-	GROUP BY th.user_id
+	GROUP BY u.id
 	ORDER BY score DESC
 	LIMIT ?;`
 
-	return db.userScore(query, limit)
+	return db.userScore(ctx, query, limit)
 }
 
-func (db *DB) userScore(query string, limit int) ([]shimmie.UserScore, error) {
-	rows, err := db.Query(query, limit)
+func (db *DB) userScore(ctx context.Context, query string, limit int) ([]shimmie.UserScore, error) {
+	rows, err := db.QueryContext(ctx, db.rebind(query), limit)
 	if err != nil {
 		return nil, err
 	}
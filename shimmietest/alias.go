@@ -0,0 +1,108 @@
+package shimmietest
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+
+	"github.com/kusubooru/shimmie"
+)
+
+// GetAlias returns an alias based on its old tag.
+func (s *Store) GetAlias(ctx context.Context, oldTag string) (*shimmie.Alias, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	newTag, ok := s.aliases[oldTag]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &shimmie.Alias{OldTag: oldTag, NewTag: newTag}, nil
+}
+
+// DeleteAlias deletes an alias based on its old tag.
+func (s *Store) DeleteAlias(ctx context.Context, oldTag string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.aliases, oldTag)
+	return nil
+}
+
+// CreateAlias creates a new alias.
+func (s *Store) CreateAlias(ctx context.Context, alias *shimmie.Alias) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.aliases[alias.OldTag]; ok {
+		return duplicateEntry("PRIMARY", alias.OldTag)
+	}
+	s.aliases[alias.OldTag] = alias.NewTag
+	return nil
+}
+
+// CountAlias returns how many alias exist.
+func (s *Store) CountAlias(ctx context.Context) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.aliases), nil
+}
+
+// sortedAlias returns all the alias ordered by old tag.
+func (s *Store) sortedAlias() []shimmie.Alias {
+	alias := make([]shimmie.Alias, 0, len(s.aliases))
+	for oldTag, newTag := range s.aliases {
+		alias = append(alias, shimmie.Alias{OldTag: oldTag, NewTag: newTag})
+	}
+	sort.Slice(alias, func(i, j int) bool { return alias[i].OldTag < alias[j].OldTag })
+	return alias
+}
+
+// GetAllAlias returns alias based on a limit and an offset. If limit < 0,
+// all alias starting from offset are returned.
+func (s *Store) GetAllAlias(ctx context.Context, limit, offset int) ([]shimmie.Alias, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	alias := s.sortedAlias()
+	start, end := window(len(alias), limit, offset)
+	if start == end {
+		return nil, nil
+	}
+	return alias[start:end], nil
+}
+
+// ListAlias returns a page of alias ordered by old tag along with the cursor
+// token of the next page.
+func (s *Store) ListAlias(ctx context.Context, limit int, cursor string) ([]shimmie.Alias, string, error) {
+	c, err := shimmie.DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	limit = pageLimit(limit)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var alias []shimmie.Alias
+	for _, a := range s.sortedAlias() {
+		if c == nil || a.OldTag > c.Name {
+			alias = append(alias, a)
+		}
+	}
+
+	var next string
+	if len(alias) > limit {
+		alias = alias[:limit]
+		next = shimmie.Cursor{Name: alias[limit-1].OldTag}.Encode()
+	}
+	return alias, next, nil
+}
+
+// FindAlias returns all alias matching an oldTag or a newTag or both.
+func (s *Store) FindAlias(ctx context.Context, oldTag, newTag string) ([]shimmie.Alias, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var alias []shimmie.Alias
+	for _, a := range s.sortedAlias() {
+		if like(a.OldTag, oldTag) && like(a.NewTag, newTag) {
+			alias = append(alias, a)
+		}
+	}
+	return alias, nil
+}
@@ -0,0 +1,27 @@
+package shimmietest
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+
+	"github.com/kusubooru/shimmie"
+)
+
+// Verify compares the provided username and password with the stored username
+// and password hash. It returns the same errors as the shimmie database.
+func (s *Store) Verify(ctx context.Context, username, password string) (*shimmie.User, error) {
+	u, err := s.GetUserByName(ctx, username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, shimmie.ErrNotFound
+		}
+		return nil, err
+	}
+	storedHash := []byte(u.Pass)
+	newHash := []byte(shimmie.PasswordHash(username, password))
+	if subtle.ConstantTimeCompare(storedHash, newHash) == 1 {
+		return u, nil
+	}
+	return nil, shimmie.ErrWrongCredentials
+}
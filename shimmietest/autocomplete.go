@@ -0,0 +1,64 @@
+package shimmietest
+
+import (
+	"context"
+	"sort"
+
+	"github.com/kusubooru/shimmie"
+)
+
+// Autocomplete searches tags and tag alias for a term and returns
+// suggestions tags to be used for a UI autocomplete.
+func (s *Store) Autocomplete(ctx context.Context, q string, limit, offset int) ([]*shimmie.Autocomplete, error) {
+	if q == "" {
+		return []*shimmie.Autocomplete{}, nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var (
+		autocomplete []*shimmie.Autocomplete
+		seen         = make(map[shimmie.Autocomplete]bool)
+		aliased      = make(map[string]bool)
+	)
+	add := func(a shimmie.Autocomplete) {
+		if !seen[a] {
+			seen[a] = true
+			autocomplete = append(autocomplete, &a)
+		}
+	}
+
+	// Alias whose old or new tag match along with the count of the new tag.
+	for oldTag, newTag := range s.aliases {
+		if like(oldTag, q) {
+			aliased[oldTag] = true
+		}
+		if like(newTag, q) {
+			aliased[newTag] = true
+		}
+		t, ok := s.tags[newTag]
+		if !ok || !(like(oldTag, q) || like(t.Tag, q)) {
+			continue
+		}
+		add(shimmie.Autocomplete{Old: oldTag, Name: newTag, Count: t.Count})
+	}
+	// Used tags that match and are not part of a matching alias.
+	for _, t := range s.tags {
+		if like(t.Tag, q) && t.Count > 0 && !aliased[t.Tag] {
+			add(shimmie.Autocomplete{Name: t.Tag, Count: t.Count})
+		}
+	}
+
+	sort.Slice(autocomplete, func(i, j int) bool {
+		a, b := autocomplete[i], autocomplete[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Old < b.Old
+	})
+	start, end := window(len(autocomplete), limit, offset)
+	return autocomplete[start:end], nil
+}
@@ -0,0 +1,63 @@
+package shimmietest
+
+import (
+	"context"
+
+	"github.com/kusubooru/shimmie"
+)
+
+// GetCommon gets common configuration values.
+func (s *Store) GetCommon(ctx context.Context) (*shimmie.Common, error) {
+	c, err := s.GetConfig(ctx, "title", "site_description", "site_keywords", "google_analytics_id", "ga_profile_id")
+	if err != nil {
+		return nil, err
+	}
+	conf := shimmie.Common{
+		Title:       c["title"],
+		Description: c["site_description"],
+		Keywords:    c["site_keywords"],
+		AnalyticsID: c["google_analytics_id"],
+	}
+	if conf.AnalyticsID == "" {
+		conf.AnalyticsID = c["ga_profile_id"]
+	}
+	return &conf, nil
+}
+
+// GetConfig gets config values. If no keys are given, all the config values
+// are returned.
+func (s *Store) GetConfig(ctx context.Context, keys ...string) (map[string]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m := make(map[string]string)
+	if len(keys) == 0 {
+		for k, v := range s.config {
+			m[k] = v
+		}
+		return m, nil
+	}
+	for _, k := range keys {
+		if v, ok := s.config[k]; ok {
+			m[k] = v
+		}
+	}
+	return m, nil
+}
+
+// SetConfig sets a config value, creating it if it does not exist.
+func (s *Store) SetConfig(ctx context.Context, name, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config[name] = value
+	return nil
+}
+
+// SetConfigs sets many config values at once.
+func (s *Store) SetConfigs(ctx context.Context, values map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, value := range values {
+		s.config[name] = value
+	}
+	return nil
+}
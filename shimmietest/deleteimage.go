@@ -0,0 +1,52 @@
+package shimmietest
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/kusubooru/shimmie"
+)
+
+// DeleteImage deletes an image along with its tag history, perceptual hash,
+// favorites and votes, removes it from its pools, detaches its children and
+// logs the deletion. If d.BanHash is set, the hash of the image is also
+// banned. It returns the deleted image or sql.ErrNoRows if it does not
+// exist. The store does not keep image tags so there are no tag counts to
+// update.
+func (s *Store) DeleteImage(ctx context.Context, id int64, d shimmie.ImageDeletion) (*shimmie.Image, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	img, ok := s.images[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	delete(s.images, id)
+	delete(s.phashes, id)
+	delete(s.favorites, id)
+	delete(s.votes, id)
+	for poolID, images := range s.poolImages {
+		if i := poolIndex(images, id); i >= 0 {
+			s.poolImages[poolID] = append(images[:i:i], images[i+1:]...)
+			p := s.pools[poolID]
+			p.Posts--
+			s.pools[poolID] = p
+		}
+	}
+	for _, c := range s.children(id) {
+		c.ParentID = 0
+		s.images[c.ID] = c
+	}
+	if img.ParentID != 0 {
+		s.updateHasChildren(img.ParentID)
+	}
+	for thID, th := range s.tagHistories {
+		if th.ImageID == id {
+			delete(s.tagHistories, thID)
+		}
+	}
+	s.log("core-image", d.Username(), d.Address, shimmie.PriorityInfo, d.LogMessage(&img))
+	if d.BanHash {
+		s.banHash(img.Hash, d.Reason, d.User, d.Address)
+	}
+	return &img, nil
+}
@@ -0,0 +1,157 @@
+package shimmietest
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/kusubooru/shimmie"
+)
+
+// AddFavorite adds an image to the favorites of a user and updates the
+// favorites count of the image. Adding a favorite twice has no effect. It
+// returns sql.ErrNoRows if the user or the image does not exist.
+func (s *Store) AddFavorite(ctx context.Context, userID, imageID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.images[imageID]; !ok {
+		return sql.ErrNoRows
+	}
+	if _, ok := s.users[userID]; !ok {
+		return sql.ErrNoRows
+	}
+	users, ok := s.favorites[imageID]
+	if !ok {
+		users = make(map[int64]time.Time)
+		s.favorites[imageID] = users
+	}
+	if _, ok := users[userID]; ok {
+		return nil
+	}
+	users[userID] = time.Now()
+	s.updateFavorites(imageID)
+	return nil
+}
+
+// RemoveFavorite removes an image from the favorites of a user and updates
+// the favorites count of the image. Removing a favorite that does not exist
+// has no effect.
+func (s *Store) RemoveFavorite(ctx context.Context, userID, imageID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.favorites[imageID][userID]; !ok {
+		return nil
+	}
+	delete(s.favorites[imageID], userID)
+	s.updateFavorites(imageID)
+	return nil
+}
+
+// updateFavorites sets the favorites count of an image.
+func (s *Store) updateFavorites(imageID int64) {
+	img, ok := s.images[imageID]
+	if !ok {
+		return
+	}
+	img.Favorites = len(s.favorites[imageID])
+	s.images[imageID] = img
+}
+
+// ListFavorites returns the favorite images of a user, most recently
+// favorited first.
+func (s *Store) ListFavorites(ctx context.Context, userID int64, limit int, cursor string) ([]shimmie.Image, string, error) {
+	c, err := shimmie.DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	limit = pageLimit(limit)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	type favorite struct {
+		img   shimmie.Image
+		added time.Time
+	}
+	var favs []favorite
+	for imageID, users := range s.favorites {
+		added, ok := users[userID]
+		if !ok {
+			continue
+		}
+		if c != nil && c.Time != nil {
+			if added.After(*c.Time) || added.Equal(*c.Time) && imageID >= c.ID {
+				continue
+			}
+		}
+		favs = append(favs, favorite{s.images[imageID], added})
+	}
+	sort.Slice(favs, func(i, j int) bool {
+		if !favs[i].added.Equal(favs[j].added) {
+			return favs[i].added.After(favs[j].added)
+		}
+		return favs[i].img.ID > favs[j].img.ID
+	})
+
+	var (
+		images []shimmie.Image
+		next   string
+	)
+	for _, f := range favs {
+		images = append(images, f.img)
+	}
+	if len(images) > limit {
+		images = images[:limit]
+		last := favs[limit-1]
+		next = shimmie.Cursor{ID: last.img.ID, Time: &last.added}.Encode()
+	}
+	return images, next, nil
+}
+
+// FavoritedBy returns the users that have favorited an image, ordered by
+// name.
+func (s *Store) FavoritedBy(ctx context.Context, imageID int64) ([]shimmie.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var users []shimmie.User
+	for userID := range s.favorites[imageID] {
+		users = append(users, s.users[userID])
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+	return users, nil
+}
+
+// MostFavorited returns the images that were favorited the most times since
+// a time, most favorited first and then by descending ID.
+func (s *Store) MostFavorited(ctx context.Context, since time.Time, limit int) ([]shimmie.ImageScore, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var scores []shimmie.ImageScore
+	for imageID, users := range s.favorites {
+		var n int
+		for _, added := range users {
+			if !added.Before(since) {
+				n++
+			}
+		}
+		if n != 0 {
+			scores = append(scores, shimmie.ImageScore{Score: n, Image: s.images[imageID]})
+		}
+	}
+	sortImageScores(scores)
+	if limit = pageLimit(limit); len(scores) > limit {
+		scores = scores[:limit]
+	}
+	return scores, nil
+}
+
+// sortImageScores sorts scores by descending score and then by descending
+// image ID.
+func sortImageScores(scores []shimmie.ImageScore) {
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Score != scores[j].Score {
+			return scores[i].Score > scores[j].Score
+		}
+		return scores[i].Image.ID > scores[j].Image.ID
+	})
+}
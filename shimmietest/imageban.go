@@ -0,0 +1,98 @@
+package shimmietest
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/kusubooru/shimmie"
+)
+
+// BanHash bans an image hash so that images with it cannot be created and
+// logs the ban. Banning a hash that is already banned has no effect.
+func (s *Store) BanHash(ctx context.Context, hash, reason string, user *shimmie.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.banHash(hash, reason, user, "")
+	return nil
+}
+
+// banHash bans hash, unless it is already banned, and logs the ban.
+func (s *Store) banHash(hash, reason string, user *shimmie.User, address string) {
+	hash = strings.ToLower(hash)
+	if s.hashBan(hash) != nil {
+		return
+	}
+	s.lastImageBanID++
+	b := shimmie.ImageBan{ID: s.lastImageBanID, Hash: hash, Date: time.Now(), Reason: reason}
+	var username string
+	if user != nil {
+		b.UserID, username = user.ID, user.Name
+	}
+	s.imageBans = append(s.imageBans, b)
+	s.log("image_hash_ban", username, address, shimmie.PriorityInfo, shimmie.HashBanLogMessage(hash, reason))
+}
+
+// hashBan returns the ban of hash or nil.
+func (s *Store) hashBan(hash string) *shimmie.ImageBan {
+	hash = strings.ToLower(hash)
+	for i := range s.imageBans {
+		if s.imageBans[i].Hash == hash {
+			return &s.imageBans[i]
+		}
+	}
+	return nil
+}
+
+// IsHashBanned reports whether an image hash is banned.
+func (s *Store) IsHashBanned(ctx context.Context, hash string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.hashBan(hash) != nil, nil
+}
+
+// UnbanHash removes the ban of an image hash. It returns sql.ErrNoRows if
+// the hash is not banned.
+func (s *Store) UnbanHash(ctx context.Context, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hash = strings.ToLower(hash)
+	for i, b := range s.imageBans {
+		if b.Hash == hash {
+			s.imageBans = append(s.imageBans[:i], s.imageBans[i+1:]...)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+// ListHashBans returns the banned image hashes, newest ban first.
+func (s *Store) ListHashBans(ctx context.Context, limit int, cursor string) ([]shimmie.ImageBan, string, error) {
+	c, err := shimmie.DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	limit = pageLimit(limit)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var bans []shimmie.ImageBan
+	for i := len(s.imageBans) - 1; i >= 0; i-- {
+		b := s.imageBans[i]
+		if c != nil && b.ID >= c.ID {
+			continue
+		}
+		if b.UserID != 0 {
+			b.UserName = s.users[b.UserID].Name
+		}
+		bans = append(bans, b)
+	}
+
+	var next string
+	if len(bans) > limit {
+		bans = bans[:limit]
+		next = shimmie.Cursor{ID: bans[limit-1].ID}.Encode()
+	}
+	return bans, next, nil
+}
@@ -0,0 +1,186 @@
+package shimmietest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kusubooru/shimmie"
+)
+
+// CreateImage inserts a new image. Like the shimmie database, it ignores the
+// values of the columns that are added by extensions and uses their defaults
+// instead. It returns a *shimmie.HashBannedError if the hash of the image is
+// banned.
+func (s *Store) CreateImage(ctx context.Context, img shimmie.Image) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[img.OwnerID]; !ok {
+		return 0, fmt.Errorf("cannot create image: owner %d does not exist", img.OwnerID)
+	}
+	if b := s.hashBan(img.Hash); b != nil {
+		return 0, &shimmie.HashBannedError{Hash: img.Hash, Reason: b.Reason}
+	}
+	for _, other := range s.images {
+		if other.Hash == img.Hash {
+			return 0, duplicateEntry("hash", img.Hash)
+		}
+	}
+	if img.ID == 0 {
+		img.ID = s.lastImageID + 1
+	}
+	if _, ok := s.images[img.ID]; ok {
+		return 0, duplicateEntry("PRIMARY", img.ID)
+	}
+	if img.ID > s.lastImageID {
+		s.lastImageID = img.ID
+	}
+	if img.Posted == nil {
+		now := time.Now().UTC().Truncate(time.Second)
+		img.Posted = &now
+	}
+	img.NumericScore = 0
+	img.Rating = "?"
+	img.Favorites = 0
+	img.ParentID = 0
+	img.HasChildren = false
+	img.Author = ""
+	img.Notes = 0
+	s.images[img.ID] = img
+	return img.ID, nil
+}
+
+// RateImage sets the rating for an image.
+func (s *Store) RateImage(ctx context.Context, id int, rating string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	img, ok := s.images[int64(id)]
+	if !ok {
+		return nil
+	}
+	img.Rating = rating
+	s.images[img.ID] = img
+	return nil
+}
+
+// GetImage gets a shimmie Image metadata.
+func (s *Store) GetImage(ctx context.Context, id int) (*shimmie.Image, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	img, ok := s.images[int64(id)]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &img, nil
+}
+
+// GetRatedImages returns all the images that have been rated as safe
+// ignoring the ones from username. Like the shimmie database, it finds the
+// raters by searching the log.
+func (s *Store) GetRatedImages(ctx context.Context, username string) ([]shimmie.RatedImage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Keep the latest "set to: Safe" log per image ID.
+	latest := make(map[int64]shimmie.SCoreLog)
+	for _, l := range s.logs {
+		if l.Section != "rating" || !strings.HasSuffix(strings.ToLower(l.Message), "set to: safe") {
+			continue
+		}
+		ratedID := l.Message[strings.LastIndex(l.Message, "#")+1:]
+		if i := strings.Index(ratedID, " "); i != -1 {
+			ratedID = ratedID[:i]
+		}
+		id, err := strconv.ParseInt(ratedID, 10, 64)
+		if err != nil {
+			continue
+		}
+		if prev, ok := latest[id]; !ok || l.ID > prev.ID {
+			latest[id] = l
+		}
+	}
+
+	var images []shimmie.RatedImage
+	for id, l := range latest {
+		img, ok := s.images[id]
+		if !ok || img.Rating != "s" || l.Username == username {
+			continue
+		}
+		images = append(images, shimmie.RatedImage{
+			Image:    img,
+			Rater:    l.Username,
+			RaterIP:  l.Address,
+			RateDate: l.DateSent,
+		})
+	}
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].RateDate.After(*images[j].RateDate)
+	})
+	return images, nil
+}
+
+// ListImages returns a page of the images that match filter, ordered by
+// filter.Order, along with the cursor token of the next page.
+func (s *Store) ListImages(ctx context.Context, filter shimmie.ImageFilter, limit int, cursor string) ([]shimmie.Image, string, error) {
+	c, err := shimmie.DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	if c != nil && filter.Order == shimmie.ImageOrderPosted && c.Time == nil {
+		return nil, "", shimmie.ErrInvalidCursor
+	}
+	limit = pageLimit(limit)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// less reports whether a comes after b in descending order.
+	less := func(a, b shimmie.Image) bool {
+		switch filter.Order {
+		case shimmie.ImageOrderPosted:
+			if !a.Posted.Equal(*b.Posted) {
+				return a.Posted.After(*b.Posted)
+			}
+		case shimmie.ImageOrderScore:
+			if a.NumericScore != b.NumericScore {
+				return a.NumericScore > b.NumericScore
+			}
+		}
+		return a.ID > b.ID
+	}
+	var last shimmie.Image
+	if c != nil {
+		last = shimmie.Image{ID: c.ID, Posted: c.Time, NumericScore: c.Score}
+	}
+
+	var images []shimmie.Image
+	for _, img := range s.images {
+		switch {
+		case filter.OwnerID != 0 && img.OwnerID != filter.OwnerID:
+		case filter.Rating != "" && img.Rating != filter.Rating:
+		case filter.Ext != "" && img.Ext != filter.Ext:
+		case filter.PostedAfter != nil && img.Posted.Before(*filter.PostedAfter):
+		case filter.PostedBefore != nil && !img.Posted.Before(*filter.PostedBefore):
+		case c != nil && !less(last, img):
+		default:
+			images = append(images, img)
+		}
+	}
+	sort.Slice(images, func(i, j int) bool { return less(images[i], images[j]) })
+
+	var next string
+	if len(images) > limit {
+		images = images[:limit]
+		last := images[limit-1]
+		next = shimmie.Cursor{
+			ID:    last.ID,
+			Time:  last.Posted,
+			Score: last.NumericScore,
+		}.Encode()
+	}
+	return images, next, nil
+}
@@ -0,0 +1,98 @@
+package shimmietest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/kusubooru/shimmie"
+)
+
+// AddIPBan bans an IP address or range. It sets the ID and Added time of
+// the ban and stores its IP in the form of shimmie.NormalizeIPBan.
+func (s *Store) AddIPBan(ctx context.Context, ban *shimmie.IPBan) error {
+	ip, err := shimmie.NormalizeIPBan(ban.IP)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[ban.BannerID]; !ok {
+		return fmt.Errorf("cannot ban IP: banner %d does not exist", ban.BannerID)
+	}
+	s.lastIPBanID++
+	ban.ID, ban.IP, ban.Added = s.lastIPBanID, ip, time.Now()
+	b := *ban
+	if b.Expires != nil {
+		expires := *b.Expires
+		b.Expires = &expires
+	}
+	s.ipBans = append(s.ipBans, b)
+	return nil
+}
+
+// RemoveIPBan removes a ban. It returns sql.ErrNoRows if there is no ban
+// with that ID.
+func (s *Store) RemoveIPBan(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, b := range s.ipBans {
+		if b.ID == id {
+			s.ipBans = append(s.ipBans[:i], s.ipBans[i+1:]...)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+// ListIPBans returns the IP bans, including the expired ones, newest first.
+func (s *Store) ListIPBans(ctx context.Context, limit int, cursor string) ([]shimmie.IPBan, string, error) {
+	c, err := shimmie.DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	limit = pageLimit(limit)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var bans []shimmie.IPBan
+	for i := len(s.ipBans) - 1; i >= 0; i-- {
+		if c != nil && s.ipBans[i].ID >= c.ID {
+			continue
+		}
+		bans = append(bans, s.ipBan(i))
+	}
+
+	var next string
+	if len(bans) > limit {
+		bans = bans[:limit]
+		next = shimmie.Cursor{ID: bans[limit-1].ID}.Encode()
+	}
+	return bans, next, nil
+}
+
+// ActiveIPBans returns the IP bans that have not expired.
+func (s *Store) ActiveIPBans(ctx context.Context) ([]shimmie.IPBan, error) {
+	now := time.Now()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var bans []shimmie.IPBan
+	for i, b := range s.ipBans {
+		if b.Active(now) {
+			bans = append(bans, s.ipBan(i))
+		}
+	}
+	return bans, nil
+}
+
+// ipBan returns a copy of the i-th ban with the name of its banner.
+func (s *Store) ipBan(i int) shimmie.IPBan {
+	b := s.ipBans[i]
+	b.BannerName = s.users[b.BannerID].Name
+	if b.Expires != nil {
+		expires := *b.Expires
+		b.Expires = &expires
+	}
+	return b
+}
@@ -0,0 +1,84 @@
+package shimmietest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/kusubooru/shimmie"
+)
+
+// LogRating logs when an image rating is set.
+func (s *Store) LogRating(ctx context.Context, imgID int, imgRating, username, userIP string) error {
+	rating := shimmie.ImageRating(imgRating)
+	msg := fmt.Sprintf("Rating for Image #%d set to: %v", imgID, rating)
+
+	_, err := s.Log(ctx, "rating", username, userIP, shimmie.PriorityInfo, msg)
+
+	return err
+}
+
+// Log stores a message in the log.
+func (s *Store) Log(ctx context.Context, section, username, address string, priority int, message string) (*shimmie.SCoreLog, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.log(section, username, address, priority, message), nil
+}
+
+func (s *Store) log(section, username, address string, priority int, message string) *shimmie.SCoreLog {
+	now := time.Now()
+	s.lastLogID++
+	log := shimmie.SCoreLog{
+		ID:       s.lastLogID,
+		DateSent: &now,
+		Section:  section,
+		Username: username,
+		Address:  address,
+		Priority: priority,
+		Message:  message,
+	}
+	s.logs = append(s.logs, log)
+	return &log
+}
+
+// QueryLogs returns the log entries that match filter, newest first.
+func (s *Store) QueryLogs(ctx context.Context, filter shimmie.LogFilter, limit int, cursor string) ([]shimmie.SCoreLog, string, error) {
+	c, err := shimmie.DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	network, err := filter.Network()
+	if err != nil {
+		return nil, "", err
+	}
+	limit = pageLimit(limit)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var logs []shimmie.SCoreLog
+	for _, l := range s.logs {
+		switch {
+		case c != nil && l.ID >= c.ID:
+		case filter.Section != "" && l.Section != filter.Section:
+		case filter.Username != "" && l.Username != filter.Username:
+		case network == nil && filter.Address != "" && l.Address != filter.Address:
+		case network != nil && !network.Contains(net.ParseIP(l.Address)):
+		case l.Priority < filter.MinPriority:
+		case filter.After != nil && l.DateSent.Before(*filter.After):
+		case filter.Before != nil && !l.DateSent.Before(*filter.Before):
+		case filter.Message != "" && !like(l.Message, filter.Message):
+		default:
+			logs = append(logs, l)
+		}
+	}
+	sort.Slice(logs, func(i, j int) bool { return logs[i].ID > logs[j].ID })
+
+	var next string
+	if len(logs) > limit {
+		logs = logs[:limit]
+		next = shimmie.Cursor{ID: logs[limit-1].ID}.Encode()
+	}
+	return logs, next, nil
+}
@@ -0,0 +1,61 @@
+package shimmietest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/kusubooru/shimmie"
+)
+
+// SetImagePHash stores the perceptual hash of an image, replacing its
+// previous one.
+func (s *Store) SetImagePHash(ctx context.Context, imageID int64, phash uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.images[imageID]; !ok {
+		return fmt.Errorf("cannot set perceptual hash: image %d does not exist", imageID)
+	}
+	s.phashes[imageID] = phash
+	return nil
+}
+
+// GetImagePHash returns the perceptual hash of an image or sql.ErrNoRows if
+// it has none.
+func (s *Store) GetImagePHash(ctx context.Context, imageID int64) (uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	phash, ok := s.phashes[imageID]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	return phash, nil
+}
+
+// ListImagePHashes returns the perceptual hashes of the images in ascending
+// order of image ID.
+func (s *Store) ListImagePHashes(ctx context.Context, limit int, cursor string) ([]shimmie.ImagePHash, string, error) {
+	c, err := shimmie.DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	limit = pageLimit(limit)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var phashes []shimmie.ImagePHash
+	for id, phash := range s.phashes {
+		if c == nil || id > c.ID {
+			phashes = append(phashes, shimmie.ImagePHash{ImageID: id, PHash: phash})
+		}
+	}
+	sort.Slice(phashes, func(i, j int) bool { return phashes[i].ImageID < phashes[j].ImageID })
+
+	var next string
+	if len(phashes) > limit {
+		phashes = phashes[:limit]
+		next = shimmie.Cursor{ID: phashes[limit-1].ImageID}.Encode()
+	}
+	return phashes, next, nil
+}
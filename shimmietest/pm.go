@@ -0,0 +1,246 @@
+package shimmietest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/kusubooru/shimmie"
+)
+
+// pmEntry is a stored private message along with the side that deleted it.
+type pmEntry struct {
+	shimmie.PM
+	deletedBySender    bool
+	deletedByRecipient bool
+}
+
+// visibleTo reports whether userID has sent or received the message and has
+// not deleted it.
+func (e pmEntry) visibleTo(userID int64) bool {
+	return (e.FromID == userID && !e.deletedBySender) || (e.ToID == userID && !e.deletedByRecipient)
+}
+
+// CreatePM inserts a new private message.
+func (s *Store) CreatePM(ctx context.Context, pm *shimmie.PM) error {
+	if pm == nil {
+		return fmt.Errorf("cannot create nil private message")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.createPM(pm)
+}
+
+func (s *Store) createPM(pm *shimmie.PM) error {
+	if _, ok := s.users[pm.FromID]; !ok {
+		return fmt.Errorf("cannot create private message: sender %d does not exist", pm.FromID)
+	}
+	if _, ok := s.users[pm.ToID]; !ok {
+		return fmt.Errorf("cannot create private message: recipient %d does not exist", pm.ToID)
+	}
+	s.lastPMID++
+	pm.ID = s.lastPMID
+	stored := *pm
+	stored.FromUser, stored.ToUser = "", ""
+	s.pms = append(s.pms, pmEntry{PM: stored})
+	return nil
+}
+
+// withNames returns a copy of a stored message with the user names filled.
+func (s *Store) withNames(e pmEntry) *shimmie.PM {
+	pm := e.PM
+	pm.FromUser = s.users[pm.FromID].Name
+	pm.ToUser = s.users[pm.ToID].Name
+	return &pm
+}
+
+// pmIndex returns the index of the message with the given id or -1.
+func (s *Store) pmIndex(id int64) int {
+	for i, e := range s.pms {
+		if e.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// GetPMs returns the private messages exchanged from a user to another user.
+// The arguments from and to are user names and either or both can be left
+// empty.
+func (s *Store) GetPMs(ctx context.Context, from, to string, choice shimmie.PMChoice) ([]*shimmie.PM, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var pms []*shimmie.PM
+	for _, e := range s.pms {
+		pm := s.withNames(e)
+		switch {
+		case from != "" && (pm.FromUser != from || e.deletedBySender):
+		case to != "" && (pm.ToUser != to || e.deletedByRecipient):
+		case choice == shimmie.PMRead && !pm.IsRead:
+		case choice == shimmie.PMUnread && pm.IsRead:
+		default:
+			pms = append(pms, pm)
+		}
+	}
+	sort.Slice(pms, func(i, j int) bool { return pms[i].ID < pms[j].ID })
+	return pms, nil
+}
+
+// MarkPMRead marks a private message that was received by userID as read. It
+// returns sql.ErrNoRows if userID has not received the message or has
+// deleted it.
+func (s *Store) MarkPMRead(ctx context.Context, id, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.pmIndex(id)
+	if i == -1 || s.pms[i].ToID != userID || s.pms[i].deletedByRecipient {
+		return sql.ErrNoRows
+	}
+	s.pms[i].IsRead = true
+	return nil
+}
+
+// DeletePM deletes a private message for userID only. It returns
+// sql.ErrNoRows if userID has not sent or received the message or has
+// already deleted it.
+func (s *Store) DeletePM(ctx context.Context, id, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.pmIndex(id)
+	if i == -1 || !s.pms[i].visibleTo(userID) {
+		return sql.ErrNoRows
+	}
+	if s.pms[i].FromID == userID {
+		s.pms[i].deletedBySender = true
+	}
+	if s.pms[i].ToID == userID {
+		s.pms[i].deletedByRecipient = true
+	}
+	return nil
+}
+
+// ReplyPM sends reply as an answer to the private message parentID with the
+// same safeguards as SendPM. It returns sql.ErrNoRows if the sender of the
+// reply is not a side of the parent message.
+func (s *Store) ReplyPM(ctx context.Context, parentID int64, reply *shimmie.PM) error {
+	if reply == nil {
+		return fmt.Errorf("cannot create nil private message")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.pmIndex(parentID)
+	if i == -1 {
+		return sql.ErrNoRows
+	}
+	parent := s.pms[i]
+	switch reply.FromID {
+	case parent.FromID:
+		reply.ToID = parent.ToID
+	case parent.ToID:
+		reply.ToID = parent.FromID
+	default:
+		return sql.ErrNoRows
+	}
+	if reply.Subject == "" {
+		reply.Subject = shimmie.ReplySubject(parent.Subject)
+	}
+	reply.ParentID = parentID
+	return s.sendPM(reply)
+}
+
+// GetThread returns the conversation between userID and otherID, newest
+// message first, leaving out the messages that userID has deleted.
+func (s *Store) GetThread(ctx context.Context, userID, otherID int64, limit int, cursor string) ([]*shimmie.PM, string, error) {
+	c, err := shimmie.DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	if c != nil && c.Time == nil {
+		return nil, "", shimmie.ErrInvalidCursor
+	}
+	limit = pageLimit(limit)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// less reports whether a comes after b in descending order.
+	less := func(a, b *shimmie.PM) bool {
+		if !a.SentDate.Equal(b.SentDate) {
+			return a.SentDate.After(b.SentDate)
+		}
+		return a.ID > b.ID
+	}
+	var last *shimmie.PM
+	if c != nil {
+		last = &shimmie.PM{ID: c.ID, SentDate: *c.Time}
+	}
+
+	var pms []*shimmie.PM
+	for _, e := range s.pms {
+		switch {
+		case !(e.FromID == userID && e.ToID == otherID && !e.deletedBySender) &&
+			!(e.FromID == otherID && e.ToID == userID && !e.deletedByRecipient):
+		case last != nil && !less(last, &e.PM):
+		default:
+			pms = append(pms, s.withNames(e))
+		}
+	}
+	sort.Slice(pms, func(i, j int) bool { return less(pms[i], pms[j]) })
+
+	var next string
+	if len(pms) > limit {
+		pms = pms[:limit]
+		last := pms[limit-1]
+		next = shimmie.Cursor{ID: last.ID, Time: &last.SentDate}.Encode()
+	}
+	return pms, next, nil
+}
+
+// PMInboxSummary returns, per sender, how many messages userID has received
+// and not deleted, how many of them are unread and a preview of the latest
+// one.
+func (s *Store) PMInboxSummary(ctx context.Context, userID int64) (*shimmie.PMInbox, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	senders := make(map[int64]*shimmie.PMSenderSummary)
+	latest := make(map[int64]pmEntry)
+	for _, e := range s.pms {
+		if e.ToID != userID || e.deletedByRecipient {
+			continue
+		}
+		sum, ok := senders[e.FromID]
+		if !ok {
+			sum = &shimmie.PMSenderSummary{FromID: e.FromID, FromUser: s.users[e.FromID].Name}
+			senders[e.FromID] = sum
+		}
+		sum.Total++
+		if !e.IsRead {
+			sum.Unread++
+		}
+		if e.ID > latest[e.FromID].ID {
+			latest[e.FromID] = e
+		}
+	}
+
+	inbox := &shimmie.PMInbox{Senders: []shimmie.PMSenderSummary{}}
+	for id, sum := range senders {
+		l := latest[id]
+		sum.LatestID = l.ID
+		sum.LatestDate = l.SentDate
+		sum.Subject = l.Subject
+		sum.Preview = shimmie.PMPreview(l.Message)
+		inbox.Total += sum.Total
+		inbox.Unread += sum.Unread
+		inbox.Senders = append(inbox.Senders, *sum)
+	}
+	sort.Slice(inbox.Senders, func(i, j int) bool {
+		a, b := inbox.Senders[i], inbox.Senders[j]
+		if !a.LatestDate.Equal(b.LatestDate) {
+			return a.LatestDate.After(b.LatestDate)
+		}
+		return a.LatestID > b.LatestID
+	})
+	return inbox, nil
+}
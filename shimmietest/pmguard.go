@@ -0,0 +1,153 @@
+package shimmietest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/kusubooru/shimmie"
+)
+
+// SendPM validates pm with shimmie.CheckPM and inserts it unless the
+// recipient has blocked the sender or the sender has exceeded their rate
+// limit. SentDate is always set to the current time.
+func (s *Store) SendPM(ctx context.Context, pm *shimmie.PM) error {
+	if pm == nil {
+		return fmt.Errorf("cannot create nil private message")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sendPM(pm)
+}
+
+func (s *Store) sendPM(pm *shimmie.PM) error {
+	if err := shimmie.CheckPM(pm); err != nil {
+		return err
+	}
+	now := time.Now()
+	pm.SentDate = now
+	if s.pmBlocks[pm.ToID][pm.FromID] {
+		return shimmie.ErrPMBlocked
+	}
+	limit := s.pmRateLimit(pm.FromID)
+	if limit.Messages > 0 {
+		since := now.Add(-limit.Period)
+		sent := 0
+		for _, e := range s.pms {
+			if e.FromID == pm.FromID && !e.SentDate.Before(since) {
+				sent++
+			}
+		}
+		if sent >= limit.Messages {
+			return shimmie.ErrPMRateLimited
+		}
+	}
+	return s.createPM(pm)
+}
+
+// BlockPMSender prevents blockedID from sending private messages to userID.
+func (s *Store) BlockPMSender(ctx context.Context, userID, blockedID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[userID]; !ok {
+		return fmt.Errorf("cannot block sender: user %d does not exist", userID)
+	}
+	if _, ok := s.users[blockedID]; !ok {
+		return fmt.Errorf("cannot block sender: user %d does not exist", blockedID)
+	}
+	if s.pmBlocks[userID] == nil {
+		s.pmBlocks[userID] = make(map[int64]bool)
+	}
+	s.pmBlocks[userID][blockedID] = true
+	return nil
+}
+
+// UnblockPMSender allows blockedID to send private messages to userID again.
+func (s *Store) UnblockPMSender(ctx context.Context, userID, blockedID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pmBlocks[userID], blockedID)
+	return nil
+}
+
+// GetPMBlocks returns the IDs of the users that userID has blocked.
+func (s *Store) GetPMBlocks(ctx context.Context, userID int64) ([]int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var ids []int64
+	for id := range s.pmBlocks[userID] {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// SetPMRateLimit sets the rate limit of a user. Like the database, it stores
+// the period in seconds.
+func (s *Store) SetPMRateLimit(ctx context.Context, userID int64, limit shimmie.PMRateLimit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[userID]; !ok {
+		return fmt.Errorf("cannot set rate limit: user %d does not exist", userID)
+	}
+	limit.Period = limit.Period.Truncate(time.Second)
+	s.pmRateLimits[userID] = limit
+	return nil
+}
+
+// GetPMRateLimit returns the rate limit of a user or
+// shimmie.DefaultPMRateLimit if they do not have one.
+func (s *Store) GetPMRateLimit(ctx context.Context, userID int64) (shimmie.PMRateLimit, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.pmRateLimit(userID), nil
+}
+
+func (s *Store) pmRateLimit(userID int64) shimmie.PMRateLimit {
+	if limit, ok := s.pmRateLimits[userID]; ok {
+		return limit
+	}
+	return shimmie.DefaultPMRateLimit
+}
+
+// ListFlaggedPMs returns the private messages that are flagged for review,
+// newest first.
+func (s *Store) ListFlaggedPMs(ctx context.Context, limit int, cursor string) ([]*shimmie.PM, string, error) {
+	c, err := shimmie.DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	limit = pageLimit(limit)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var pms []*shimmie.PM
+	for _, e := range s.pms {
+		if e.Flagged && (c == nil || e.ID < c.ID) {
+			pms = append(pms, s.withNames(e))
+		}
+	}
+	sort.Slice(pms, func(i, j int) bool { return pms[i].ID > pms[j].ID })
+
+	var next string
+	if len(pms) > limit {
+		pms = pms[:limit]
+		next = shimmie.Cursor{ID: pms[limit-1].ID}.Encode()
+	}
+	return pms, next, nil
+}
+
+// UnflagPM clears the review flag of a private message. It returns
+// sql.ErrNoRows if the message does not exist.
+func (s *Store) UnflagPM(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.pmIndex(id)
+	if i == -1 {
+		return sql.ErrNoRows
+	}
+	s.pms[i].Flagged = false
+	return nil
+}
@@ -0,0 +1,324 @@
+package shimmietest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kusubooru/shimmie"
+)
+
+// CreatePool creates a new pool owned by p.UserID. It sets the ID, Date and
+// LastUpdated time of p and returns shimmie.ErrPoolTitleTaken if another
+// pool has the same title, ignoring case.
+func (s *Store) CreatePool(ctx context.Context, p *shimmie.Pool) error {
+	title := strings.TrimSpace(p.Title)
+	if title == "" {
+		return shimmie.ErrPoolTitleEmpty
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[p.UserID]; !ok {
+		return fmt.Errorf("cannot create pool: user %d does not exist", p.UserID)
+	}
+	if s.poolTitleTaken(0, title) {
+		return shimmie.ErrPoolTitleTaken
+	}
+	now := time.Now()
+	s.lastPoolID++
+	p.ID, p.Title, p.Date, p.LastUpdated, p.Posts = s.lastPoolID, title, now, now, 0
+	s.pools[p.ID] = *p
+	return nil
+}
+
+func (s *Store) poolTitleTaken(id int64, title string) bool {
+	for _, p := range s.pools {
+		if p.ID != id && strings.EqualFold(p.Title, title) {
+			return true
+		}
+	}
+	return false
+}
+
+// pool returns a pool with the name of its user.
+func (s *Store) pool(id int64) (shimmie.Pool, bool) {
+	p, ok := s.pools[id]
+	p.UserName = s.users[p.UserID].Name
+	return p, ok
+}
+
+// GetPool returns a pool or sql.ErrNoRows if it does not exist.
+func (s *Store) GetPool(ctx context.Context, id int64) (*shimmie.Pool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.pool(id)
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &p, nil
+}
+
+// UpdatePool changes the title, description and visibility of a pool. It
+// returns sql.ErrNoRows if the pool does not exist.
+func (s *Store) UpdatePool(ctx context.Context, p *shimmie.Pool) error {
+	title := strings.TrimSpace(p.Title)
+	if title == "" {
+		return shimmie.ErrPoolTitleEmpty
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.pools[p.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if s.poolTitleTaken(p.ID, title) {
+		return shimmie.ErrPoolTitleTaken
+	}
+	p.Title, p.LastUpdated = title, time.Now()
+	old.Public, old.Title, old.Description, old.LastUpdated = p.Public, p.Title, p.Description, p.LastUpdated
+	s.pools[p.ID] = old
+	return nil
+}
+
+// DeletePool deletes a pool along with its history. The images of the pool
+// are not deleted. It returns sql.ErrNoRows if the pool does not exist.
+func (s *Store) DeletePool(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.pools[id]; !ok {
+		return sql.ErrNoRows
+	}
+	s.deletePools(func(p shimmie.Pool) bool { return p.ID == id })
+	return nil
+}
+
+// deletePools deletes the pools that match along with their images and
+// history.
+func (s *Store) deletePools(match func(shimmie.Pool) bool) {
+	for id, p := range s.pools {
+		if match(p) {
+			delete(s.pools, id)
+			delete(s.poolImages, id)
+		}
+	}
+	history := s.poolHistory[:0]
+	for _, h := range s.poolHistory {
+		if _, ok := s.pools[h.PoolID]; ok {
+			history = append(history, h)
+		}
+	}
+	s.poolHistory = history
+}
+
+// ListPools returns the pools, newest first.
+func (s *Store) ListPools(ctx context.Context, limit int, cursor string) ([]shimmie.Pool, string, error) {
+	c, err := shimmie.DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	limit = pageLimit(limit)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var pools []shimmie.Pool
+	for id := s.lastPoolID; id > 0; id-- {
+		if c != nil && id >= c.ID {
+			continue
+		}
+		if p, ok := s.pool(id); ok {
+			pools = append(pools, p)
+		}
+	}
+
+	var next string
+	if len(pools) > limit {
+		pools = pools[:limit]
+		next = shimmie.Cursor{ID: pools[limit-1].ID}.Encode()
+	}
+	return pools, next, nil
+}
+
+// ImagePools returns the pools that contain an image, ordered by ID.
+func (s *Store) ImagePools(ctx context.Context, imageID int64) ([]shimmie.Pool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var pools []shimmie.Pool
+	for id := int64(1); id <= s.lastPoolID; id++ {
+		if poolIndex(s.poolImages[id], imageID) < 0 {
+			continue
+		}
+		if p, ok := s.pool(id); ok {
+			pools = append(pools, p)
+		}
+	}
+	return pools, nil
+}
+
+// poolIndex returns the position of imageID in images or -1.
+func poolIndex(images []int64, imageID int64) int {
+	for i, id := range images {
+		if id == imageID {
+			return i
+		}
+	}
+	return -1
+}
+
+// AddPoolImages appends images to the end of a pool and records them in the
+// history of the pool. Images that are already in the pool are skipped. It
+// returns sql.ErrNoRows if the pool or one of the images does not exist.
+func (s *Store) AddPoolImages(ctx context.Context, poolID, userID int64, imageIDs []int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.pools[poolID]; !ok {
+		return sql.ErrNoRows
+	}
+	images := append([]int64(nil), s.poolImages[poolID]...)
+	var added []int64
+	for _, id := range imageIDs {
+		if _, ok := s.images[id]; !ok {
+			return sql.ErrNoRows
+		}
+		if poolIndex(images, id) < 0 {
+			images = append(images, id)
+			added = append(added, id)
+		}
+	}
+	s.poolChanged(poolID, userID, shimmie.PoolAdd, images, added)
+	return nil
+}
+
+// RemovePoolImages removes images from a pool and records them in the
+// history of the pool. Images that are not in the pool are skipped. It
+// returns sql.ErrNoRows if the pool does not exist.
+func (s *Store) RemovePoolImages(ctx context.Context, poolID, userID int64, imageIDs []int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.pools[poolID]; !ok {
+		return sql.ErrNoRows
+	}
+	images := append([]int64(nil), s.poolImages[poolID]...)
+	var removed []int64
+	for _, id := range imageIDs {
+		if i := poolIndex(images, id); i >= 0 {
+			images = append(images[:i], images[i+1:]...)
+			removed = append(removed, id)
+		}
+	}
+	s.poolChanged(poolID, userID, shimmie.PoolRemove, images, removed)
+	return nil
+}
+
+// poolChanged stores the images of a pool, updates its number of images and
+// last update time and records the images that were changed in its history.
+func (s *Store) poolChanged(poolID, userID int64, action shimmie.PoolAction, images, changed []int64) {
+	if len(changed) == 0 {
+		return
+	}
+	now := time.Now()
+	s.poolImages[poolID] = images
+	p := s.pools[poolID]
+	p.Posts, p.LastUpdated = len(images), now
+	s.pools[poolID] = p
+	s.lastPoolHistoryID++
+	s.poolHistory = append(s.poolHistory, shimmie.PoolHistory{
+		ID:     s.lastPoolHistoryID,
+		PoolID: poolID,
+		UserID: userID,
+		Action: action,
+		Images: changed,
+		Count:  len(images),
+		Date:   now,
+	})
+}
+
+// SetPoolOrder moves images, which must be in the pool, to the start of a
+// pool in the given order. The rest of the images keep their order after
+// them. It returns sql.ErrNoRows if the pool does not exist or one of the
+// images is not in the pool.
+func (s *Store) SetPoolOrder(ctx context.Context, poolID int64, imageIDs []int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.pools[poolID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	order, err := shimmie.ReorderPool(s.poolImages[poolID], imageIDs)
+	if err != nil {
+		return err
+	}
+	s.poolImages[poolID] = order
+	p.LastUpdated = time.Now()
+	s.pools[poolID] = p
+	return nil
+}
+
+// GetPoolImages returns the images of a pool in order. It returns
+// sql.ErrNoRows if the pool does not exist.
+func (s *Store) GetPoolImages(ctx context.Context, poolID int64) ([]shimmie.Image, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, ok := s.pools[poolID]; !ok {
+		return nil, sql.ErrNoRows
+	}
+	var images []shimmie.Image
+	for _, id := range s.poolImages[poolID] {
+		images = append(images, s.images[id])
+	}
+	return images, nil
+}
+
+// PoolNeighbors returns the images before and after an image of a pool, or
+// zero if the image is at the start or end of the pool. It returns
+// sql.ErrNoRows if the image is not in the pool.
+func (s *Store) PoolNeighbors(ctx context.Context, poolID, imageID int64) (prev, next int64, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	images := s.poolImages[poolID]
+	i := poolIndex(images, imageID)
+	if i < 0 {
+		return 0, 0, sql.ErrNoRows
+	}
+	if i > 0 {
+		prev = images[i-1]
+	}
+	if i < len(images)-1 {
+		next = images[i+1]
+	}
+	return prev, next, nil
+}
+
+// ListPoolHistory returns the history of a pool, or of all pools if poolID
+// is zero, newest first.
+func (s *Store) ListPoolHistory(ctx context.Context, poolID int64, limit int, cursor string) ([]shimmie.PoolHistory, string, error) {
+	c, err := shimmie.DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	limit = pageLimit(limit)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var history []shimmie.PoolHistory
+	for i := len(s.poolHistory) - 1; i >= 0; i-- {
+		h := s.poolHistory[i]
+		if poolID != 0 && h.PoolID != poolID {
+			continue
+		}
+		if c != nil && h.ID >= c.ID {
+			continue
+		}
+		h.UserName = s.users[h.UserID].Name
+		h.Images = append([]int64(nil), h.Images...)
+		history = append(history, h)
+	}
+
+	var next string
+	if len(history) > limit {
+		history = history[:limit]
+		next = shimmie.Cursor{ID: history[limit-1].ID}.Encode()
+	}
+	return history, next, nil
+}
@@ -0,0 +1,136 @@
+package shimmietest
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+
+	"github.com/kusubooru/shimmie"
+)
+
+// SetParent makes parentID the parent of childID and logs the change. It
+// returns shimmie.ErrParentCycle if parentID is childID or one of its
+// descendants and sql.ErrNoRows if either image does not exist.
+func (s *Store) SetParent(ctx context.Context, childID, parentID int64, user *shimmie.User, address string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	child, ok := s.images[childID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if _, ok := s.images[parentID]; !ok {
+		return sql.ErrNoRows
+	}
+	seen := make(map[int64]bool)
+	for id := parentID; id != 0 && !seen[id]; id = s.images[id].ParentID {
+		if id == childID {
+			return shimmie.ErrParentCycle
+		}
+		seen[id] = true
+	}
+	oldParentID := child.ParentID
+	if oldParentID == parentID {
+		return nil
+	}
+
+	child.ParentID = parentID
+	s.images[childID] = child
+	s.updateHasChildren(parentID)
+	if oldParentID != 0 {
+		s.updateHasChildren(oldParentID)
+	}
+	s.log("relationships", username(user), address, shimmie.PriorityInfo, shimmie.SetParentLogMessage(childID, parentID))
+	return nil
+}
+
+// RemoveParent removes the parent of childID and logs the change. It
+// returns sql.ErrNoRows if the image does not exist.
+func (s *Store) RemoveParent(ctx context.Context, childID int64, user *shimmie.User, address string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	child, ok := s.images[childID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	parentID := child.ParentID
+	if parentID == 0 {
+		return nil
+	}
+	child.ParentID = 0
+	s.images[childID] = child
+	s.updateHasChildren(parentID)
+	s.log("relationships", username(user), address, shimmie.PriorityInfo, shimmie.RemoveParentLogMessage(childID, parentID))
+	return nil
+}
+
+// updateHasChildren sets the HasChildren flag of an image according to the
+// images whose parent it is.
+func (s *Store) updateHasChildren(id int64) {
+	img, ok := s.images[id]
+	if !ok {
+		return
+	}
+	img.HasChildren = len(s.children(id)) != 0
+	s.images[id] = img
+}
+
+// children returns the images whose parent is parentID, ordered by ID.
+func (s *Store) children(parentID int64) []shimmie.Image {
+	var images []shimmie.Image
+	for _, img := range s.images {
+		if img.ParentID == parentID {
+			images = append(images, img)
+		}
+	}
+	sort.Slice(images, func(i, j int) bool { return images[i].ID < images[j].ID })
+	return images
+}
+
+// GetChildren returns the images whose parent is parentID, ordered by ID.
+func (s *Store) GetChildren(ctx context.Context, parentID int64) ([]shimmie.Image, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.children(parentID), nil
+}
+
+// GetFamily returns the topmost ancestor of an image along with all of its
+// descendants, ordered by ID. It returns sql.ErrNoRows if the image does not
+// exist.
+func (s *Store) GetFamily(ctx context.Context, id int64) ([]shimmie.Image, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	root, ok := s.images[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	seen := map[int64]bool{root.ID: true}
+	for root.ParentID != 0 && !seen[root.ParentID] {
+		parent, ok := s.images[root.ParentID]
+		if !ok {
+			break
+		}
+		seen[parent.ID] = true
+		root = parent
+	}
+
+	family := []shimmie.Image{root}
+	seen = map[int64]bool{root.ID: true}
+	for i := 0; i < len(family); i++ {
+		for _, c := range s.children(family[i].ID) {
+			if !seen[c.ID] {
+				seen[c.ID] = true
+				family = append(family, c)
+			}
+		}
+	}
+	sort.Slice(family, func(i, j int) bool { return family[i].ID < family[j].ID })
+	return family, nil
+}
+
+// username returns the name of user or an empty string if it is nil.
+func username(user *shimmie.User) string {
+	if user == nil {
+		return ""
+	}
+	return user.Name
+}
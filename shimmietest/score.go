@@ -0,0 +1,89 @@
+package shimmietest
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/kusubooru/shimmie"
+)
+
+// Vote sets the numeric score vote of a user for an image, where 0 removes
+// the vote, and recomputes the numeric score of the image. It returns
+// shimmie.ErrInvalidVote if score is not -1, 0 or 1 and sql.ErrNoRows if the
+// user or the image does not exist.
+func (s *Store) Vote(ctx context.Context, userID, imageID int64, score int) error {
+	if !shimmie.ValidVote(score) {
+		return shimmie.ErrInvalidVote
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[userID]; !ok {
+		return sql.ErrNoRows
+	}
+	if _, ok := s.images[imageID]; !ok {
+		return sql.ErrNoRows
+	}
+	votes, ok := s.votes[imageID]
+	if !ok {
+		votes = make(map[int64]int)
+		s.votes[imageID] = votes
+	}
+	if score == 0 {
+		delete(votes, userID)
+	} else {
+		votes[userID] = score
+	}
+	s.updateScore(imageID)
+	return nil
+}
+
+// updateScore sets the numeric score of an image to the sum of its votes.
+func (s *Store) updateScore(imageID int64) {
+	img, ok := s.images[imageID]
+	if !ok {
+		return
+	}
+	img.NumericScore = 0
+	for _, score := range s.votes[imageID] {
+		img.NumericScore += score
+	}
+	s.images[imageID] = img
+}
+
+// GetVote returns the numeric score vote of a user for an image or 0 if the
+// user has not voted.
+func (s *Store) GetVote(ctx context.Context, userID, imageID int64) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.votes[imageID][userID], nil
+}
+
+// TopImages returns the images with a positive numeric score that were
+// posted since a time, highest score first and then by descending ID. A
+// zero time includes all images.
+func (s *Store) TopImages(ctx context.Context, since time.Time, limit int) ([]shimmie.Image, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var images []shimmie.Image
+	for _, img := range s.images {
+		if img.NumericScore <= 0 {
+			continue
+		}
+		if !since.IsZero() && (img.Posted == nil || img.Posted.Before(since)) {
+			continue
+		}
+		images = append(images, img)
+	}
+	sort.Slice(images, func(i, j int) bool {
+		if images[i].NumericScore != images[j].NumericScore {
+			return images[i].NumericScore > images[j].NumericScore
+		}
+		return images[i].ID > images[j].ID
+	})
+	if limit = pageLimit(limit); len(images) > limit {
+		images = images[:limit]
+	}
+	return images, nil
+}
@@ -0,0 +1,133 @@
+// Package shimmietest provides an in-memory implementation of the shimmie
+// stores which can be used in tests instead of a shimmie database.
+package shimmietest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kusubooru/shimmie"
+)
+
+// Store is an in-memory shimmie store. It mimics the behavior of the shimmie
+// database including the errors returned when an entry is not found. It is
+// safe for concurrent use.
+type Store struct {
+	mu sync.RWMutex
+
+	users      map[int64]shimmie.User
+	lastUserID int64
+
+	images      map[int64]shimmie.Image
+	lastImageID int64
+	phashes     map[int64]uint64
+	// favorites maps images to the users that favorited them and when.
+	favorites map[int64]map[int64]time.Time
+	// votes maps images to the numeric score votes of users.
+	votes map[int64]map[int64]int
+
+	tags      map[string]shimmie.Tag
+	lastTagID int
+
+	tagHistories     map[int64]shimmie.TagHistory
+	lastTagHistoryID int64
+
+	// aliases maps old tags to new tags.
+	aliases map[string]string
+
+	pms       []pmEntry
+	lastPMID  int64
+	logs      []shimmie.SCoreLog
+	lastLogID int64
+
+	// pmBlocks maps users to the senders they have blocked.
+	pmBlocks     map[int64]map[int64]bool
+	pmRateLimits map[int64]shimmie.PMRateLimit
+
+	config map[string]string
+
+	imageBans      []shimmie.ImageBan
+	lastImageBanID int64
+
+	ipBans      []shimmie.IPBan
+	lastIPBanID int64
+
+	pools      map[int64]shimmie.Pool
+	lastPoolID int64
+	// poolImages holds the images of each pool in order.
+	poolImages        map[int64][]int64
+	poolHistory       []shimmie.PoolHistory
+	lastPoolHistoryID int64
+}
+
+var (
+	_ shimmie.UserGetter        = (*Store)(nil)
+	_ shimmie.UserStore         = (*Store)(nil)
+	_ shimmie.ImageStore        = (*Store)(nil)
+	_ shimmie.RelationshipStore = (*Store)(nil)
+	_ shimmie.FavoriteStore     = (*Store)(nil)
+	_ shimmie.ScoreStore        = (*Store)(nil)
+	_ shimmie.PHashStore        = (*Store)(nil)
+	_ shimmie.HashBanStore      = (*Store)(nil)
+	_ shimmie.IPBanStore        = (*Store)(nil)
+	_ shimmie.PoolStore         = (*Store)(nil)
+	_ shimmie.TagStore          = (*Store)(nil)
+	_ shimmie.TagHistoryStore   = (*Store)(nil)
+	_ shimmie.AliasStore        = (*Store)(nil)
+	_ shimmie.PMStore           = (*Store)(nil)
+	_ shimmie.LogStore          = (*Store)(nil)
+	_ shimmie.ConfigStore       = (*Store)(nil)
+)
+
+// New returns a new empty in-memory store.
+func New() *Store {
+	return &Store{
+		users:  make(map[int64]shimmie.User),
+		images: make(map[int64]shimmie.Image),
+		tags:   make(map[string]shimmie.Tag),
+
+		tagHistories: make(map[int64]shimmie.TagHistory),
+		aliases:      make(map[string]string),
+		config:       make(map[string]string),
+		pmBlocks:     make(map[int64]map[int64]bool),
+		pmRateLimits: make(map[int64]shimmie.PMRateLimit),
+		phashes:      make(map[int64]uint64),
+		pools:        make(map[int64]shimmie.Pool),
+		favorites:    make(map[int64]map[int64]time.Time),
+		votes:        make(map[int64]map[int64]int),
+		poolImages:   make(map[int64][]int64),
+	}
+}
+
+// duplicateEntry returns the error of an insert that violates a unique key.
+func duplicateEntry(key string, value interface{}) error {
+	return fmt.Errorf("duplicate entry '%v' for key '%s'", value, key)
+}
+
+// like mimics a case insensitive SQL LIKE '%sub%' comparison.
+func like(s, sub string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(sub))
+}
+
+// pageLimit mimics the default page size of the shimmie database listings.
+func pageLimit(limit int) int {
+	if limit <= 0 {
+		return 50
+	}
+	return limit
+}
+
+// window mimics SQL LIMIT and OFFSET for a slice of n entries and returns
+// the bounds of the window.
+func window(n, limit, offset int) (int, int) {
+	if offset > n {
+		offset = n
+	}
+	end := n
+	if limit >= 0 && offset+limit < n {
+		end = offset + limit
+	}
+	return offset, end
+}
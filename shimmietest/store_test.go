@@ -0,0 +1,77 @@
+package shimmietest_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/kusubooru/shimmie"
+	"github.com/kusubooru/shimmie/shimmietest"
+	"github.com/kusubooru/shimmie/storetest"
+)
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storetest.Store {
+		return shimmietest.New()
+	})
+}
+
+// TestConcurrentAccess is meant to be run with the race detector.
+func TestConcurrentAccess(t *testing.T) {
+	shim := shimmietest.New()
+	ctx := context.Background()
+
+	const workers = 8
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			u := &shimmie.User{Name: fmt.Sprintf("user%d", i)}
+			if err := shim.CreateUser(ctx, u); err != nil {
+				t.Errorf("CreateUser(%q) returned err: %v", u.Name, err)
+				return
+			}
+			img := shimmie.Image{OwnerID: u.ID, Hash: fmt.Sprintf("%032d", i)}
+			imgID, err := shim.CreateImage(ctx, img)
+			if err != nil {
+				t.Errorf("CreateImage(%#v) returned err: %v", img, err)
+				return
+			}
+			th := shimmie.TagHistory{ImageID: imgID, UserID: u.ID}
+			if _, err := shim.CreateTagHistory(ctx, th); err != nil {
+				t.Errorf("CreateTagHistory(%#v) returned err: %v", th, err)
+			}
+			tag := &shimmie.Tag{Tag: fmt.Sprintf("tag%d", i), Count: i}
+			if err := shim.CreateTag(ctx, tag); err != nil {
+				t.Errorf("CreateTag(%q) returned err: %v", tag.Tag, err)
+			}
+			if _, err := shim.Log(ctx, "test", u.Name, "127.0.0.1", 20, "hello"); err != nil {
+				t.Errorf("Log returned err: %v", err)
+			}
+			if _, _, err := shim.ListImages(ctx, shimmie.ImageFilter{}, 0, ""); err != nil {
+				t.Errorf("ListImages returned err: %v", err)
+			}
+			if _, err := shim.Autocomplete(ctx, "tag", 10, 0); err != nil {
+				t.Errorf("Autocomplete returned err: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	count, err := shim.CountUsers(ctx)
+	if err != nil {
+		t.Fatalf("CountUsers() returned err: %v", err)
+	}
+	if got, want := count, workers; got != want {
+		t.Errorf("CountUsers() = %d, want %d", got, want)
+	}
+	scores, err := shim.MostTagEdits(ctx, workers)
+	if err != nil {
+		t.Fatalf("MostTagEdits() returned err: %v", err)
+	}
+	if got, want := len(scores), workers; got != want {
+		t.Errorf("MostTagEdits() returned %d scores, want %d", got, want)
+	}
+}
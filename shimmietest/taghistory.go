@@ -0,0 +1,103 @@
+package shimmietest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/kusubooru/shimmie"
+)
+
+// CreateTagHistory inserts a new tag history for an image.
+func (s *Store) CreateTagHistory(ctx context.Context, th shimmie.TagHistory) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.images[th.ImageID]; !ok {
+		return 0, fmt.Errorf("cannot create tag history: image %d does not exist", th.ImageID)
+	}
+	if _, ok := s.users[th.UserID]; !ok {
+		return 0, fmt.Errorf("cannot create tag history: user %d does not exist", th.UserID)
+	}
+	if th.DateSet == nil {
+		now := time.Now()
+		th.DateSet = &now
+	}
+	dateSet := th.DateSet.UTC().Truncate(time.Second)
+	th.DateSet = &dateSet
+	if th.ID == 0 {
+		th.ID = s.lastTagHistoryID + 1
+	}
+	if _, ok := s.tagHistories[th.ID]; ok {
+		return 0, duplicateEntry("PRIMARY", th.ID)
+	}
+	if th.ID > s.lastTagHistoryID {
+		s.lastTagHistoryID = th.ID
+	}
+	th.Name = ""
+	s.tagHistories[th.ID] = th
+	return th.ID, nil
+}
+
+// GetImageTagHistory returns the previous tags of an image, latest first.
+func (s *Store) GetImageTagHistory(ctx context.Context, imageID int) ([]shimmie.TagHistory, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var ths []shimmie.TagHistory
+	for _, th := range s.tagHistories {
+		if th.ImageID == int64(imageID) {
+			th.Name = s.users[th.UserID].Name
+			ths = append(ths, th)
+		}
+	}
+	sort.Slice(ths, func(i, j int) bool { return ths[i].ID > ths[j].ID })
+	return ths, nil
+}
+
+// GetTagHistory returns a tag history entry.
+func (s *Store) GetTagHistory(ctx context.Context, id int) (*shimmie.TagHistory, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	th, ok := s.tagHistories[int64(id)]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &th, nil
+}
+
+// GetContributedTagHistory returns the latest tag history per image of the
+// images owned by imageOwnerUsername, if that latest change was done by a
+// contributor instead of the owner.
+func (s *Store) GetContributedTagHistory(ctx context.Context, imageOwnerUsername string) ([]shimmie.ContributedTagHistory, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	latest := make(map[int64]shimmie.TagHistory)
+	for _, th := range s.tagHistories {
+		if prev, ok := latest[th.ImageID]; !ok || th.ID > prev.ID {
+			latest[th.ImageID] = th
+		}
+	}
+
+	var ths []shimmie.ContributedTagHistory
+	for _, th := range latest {
+		img := s.images[th.ImageID]
+		owner := s.users[img.OwnerID]
+		if th.UserID == img.OwnerID || owner.Name != imageOwnerUsername {
+			continue
+		}
+		ths = append(ths, shimmie.ContributedTagHistory{
+			ID:         int(th.ID),
+			ImageID:    int(img.ID),
+			OwnerID:    int(owner.ID),
+			OwnerName:  owner.Name,
+			TaggerID:   int(th.UserID),
+			TaggerName: s.users[th.UserID].Name,
+			TaggerIP:   th.UserIP,
+			Tags:       th.Tags,
+			DateSet:    th.DateSet,
+		})
+	}
+	sort.Slice(ths, func(i, j int) bool { return ths[i].DateSet.After(*ths[j].DateSet) })
+	return ths, nil
+}
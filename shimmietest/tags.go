@@ -0,0 +1,89 @@
+package shimmietest
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+
+	"github.com/kusubooru/shimmie"
+)
+
+// GetTag returns an image tag.
+func (s *Store) GetTag(ctx context.Context, tag string) (*shimmie.Tag, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tags[tag]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &t, nil
+}
+
+// DeleteTag deletes an image tag.
+func (s *Store) DeleteTag(ctx context.Context, tag string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tags, tag)
+	return nil
+}
+
+// CreateTag inserts an image tag.
+func (s *Store) CreateTag(ctx context.Context, t *shimmie.Tag) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tags[t.Tag]; ok {
+		return duplicateEntry("tag", t.Tag)
+	}
+	s.lastTagID++
+	s.tags[t.Tag] = shimmie.Tag{ID: s.lastTagID, Tag: t.Tag, Count: t.Count}
+	return nil
+}
+
+// sortedTags returns all the tags ordered by ID.
+func (s *Store) sortedTags() []*shimmie.Tag {
+	tags := make([]*shimmie.Tag, 0, len(s.tags))
+	for _, t := range s.tags {
+		t := t
+		tags = append(tags, &t)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].ID < tags[j].ID })
+	return tags
+}
+
+// GetAllTags returns stored tags based on a limit and an offset.
+func (s *Store) GetAllTags(ctx context.Context, limit, offset int) ([]*shimmie.Tag, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tags := s.sortedTags()
+	start, end := window(len(tags), limit, offset)
+	if start == end {
+		return nil, nil
+	}
+	return tags[start:end], nil
+}
+
+// ListTags returns a page of tags ordered by ID along with the cursor token of
+// the next page.
+func (s *Store) ListTags(ctx context.Context, limit int, cursor string) ([]*shimmie.Tag, string, error) {
+	c, err := shimmie.DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	limit = pageLimit(limit)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var tags []*shimmie.Tag
+	for _, t := range s.sortedTags() {
+		if c == nil || int64(t.ID) > c.ID {
+			tags = append(tags, t)
+		}
+	}
+
+	var next string
+	if len(tags) > limit {
+		tags = tags[:limit]
+		next = shimmie.Cursor{ID: int64(tags[limit-1].ID)}.Encode()
+	}
+	return tags, next, nil
+}
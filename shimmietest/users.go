@@ -0,0 +1,186 @@
+package shimmietest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/kusubooru/shimmie"
+)
+
+// GetUser gets a user by ID.
+func (s *Store) GetUser(ctx context.Context, userID int64) (*shimmie.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &u, nil
+}
+
+// GetUserByName gets a user by unique username.
+func (s *Store) GetUserByName(ctx context.Context, username string) (*shimmie.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.userByName(username)
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &u, nil
+}
+
+func (s *Store) userByName(username string) (shimmie.User, bool) {
+	for _, u := range s.users {
+		if u.Name == username {
+			return u, true
+		}
+	}
+	return shimmie.User{}, false
+}
+
+// CreateUser creates a new user and fills in the ID, password hash, join date
+// and default values of u the same way the shimmie database does.
+func (s *Store) CreateUser(ctx context.Context, u *shimmie.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.userByName(u.Name); ok {
+		return duplicateEntry("name", u.Name)
+	}
+	if u.Class == "" {
+		u.Class = "user"
+	}
+	if u.Admin == "" {
+		u.Admin = "N"
+	}
+	s.lastUserID++
+	now := time.Now().UTC().Truncate(time.Second)
+	u.ID = s.lastUserID
+	u.Pass = shimmie.PasswordHash(u.Name, u.Pass)
+	u.JoinDate = &now
+	s.users[u.ID] = *u
+	return nil
+}
+
+// DeleteUser deletes a user based on their ID. Like the shimmie database, it
+// fails if the user owns images and it also deletes the user's tag history,
+// private messages, blocks, rate limit, favorites, votes, pool history and
+// the IP bans and pools they made.
+func (s *Store) DeleteUser(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, img := range s.images {
+		if img.OwnerID == id {
+			return fmt.Errorf("cannot delete user %d: owns image %d", id, img.ID)
+		}
+	}
+	delete(s.users, id)
+	for thID, th := range s.tagHistories {
+		if th.UserID == id {
+			delete(s.tagHistories, thID)
+		}
+	}
+	pms := s.pms[:0]
+	for _, pm := range s.pms {
+		if pm.FromID != id && pm.ToID != id {
+			pms = append(pms, pm)
+		}
+	}
+	s.pms = pms
+	delete(s.pmBlocks, id)
+	for _, blocked := range s.pmBlocks {
+		delete(blocked, id)
+	}
+	delete(s.pmRateLimits, id)
+	for i := range s.imageBans {
+		if s.imageBans[i].UserID == id {
+			s.imageBans[i].UserID = 0
+		}
+	}
+	ipBans := s.ipBans[:0]
+	for _, b := range s.ipBans {
+		if b.BannerID != id {
+			ipBans = append(ipBans, b)
+		}
+	}
+	s.ipBans = ipBans
+	for imageID, users := range s.favorites {
+		if _, ok := users[id]; ok {
+			delete(users, id)
+			s.updateFavorites(imageID)
+		}
+	}
+	for imageID, votes := range s.votes {
+		if _, ok := votes[id]; ok {
+			delete(votes, id)
+			s.updateScore(imageID)
+		}
+	}
+	s.deletePools(func(p shimmie.Pool) bool { return p.UserID == id })
+	history := s.poolHistory[:0]
+	for _, h := range s.poolHistory {
+		if h.UserID != id {
+			history = append(history, h)
+		}
+	}
+	s.poolHistory = history
+	return nil
+}
+
+// CountUsers returns how many users exist.
+func (s *Store) CountUsers(ctx context.Context) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.users), nil
+}
+
+// sortedUsers returns all the users ordered by ID.
+func (s *Store) sortedUsers() []shimmie.User {
+	users := make([]shimmie.User, 0, len(s.users))
+	for _, u := range s.users {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users
+}
+
+// GetAllUsers returns users based on a limit and an offset. If limit < 0, all
+// users starting from offset are returned.
+func (s *Store) GetAllUsers(ctx context.Context, limit, offset int) ([]shimmie.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	users := s.sortedUsers()
+	start, end := window(len(users), limit, offset)
+	if start == end {
+		return nil, nil
+	}
+	return users[start:end], nil
+}
+
+// ListUsers returns a page of users ordered by ID along with the cursor token
+// of the next page.
+func (s *Store) ListUsers(ctx context.Context, limit int, cursor string) ([]shimmie.User, string, error) {
+	c, err := shimmie.DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	limit = pageLimit(limit)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var users []shimmie.User
+	for _, u := range s.sortedUsers() {
+		if c == nil || u.ID > c.ID {
+			users = append(users, u)
+		}
+	}
+
+	var next string
+	if len(users) > limit {
+		users = users[:limit]
+		next = shimmie.Cursor{ID: users[limit-1].ID}.Encode()
+	}
+	return users, next, nil
+}
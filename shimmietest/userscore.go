@@ -0,0 +1,60 @@
+package shimmietest
+
+import (
+	"context"
+	"sort"
+
+	"github.com/kusubooru/shimmie"
+)
+
+// MostImageUploads can be used to find which users have the highest number of
+// image uploads.
+func (s *Store) MostImageUploads(ctx context.Context, limit int) ([]shimmie.UserScore, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	scores := make(map[int64]int)
+	for _, img := range s.images {
+		scores[img.OwnerID]++
+	}
+	return s.userScore(scores, limit), nil
+}
+
+// MostTagEdits can be used to find which users have the highest number of tag
+// edits.
+func (s *Store) MostTagEdits(ctx context.Context, limit int) ([]shimmie.UserScore, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	scores := make(map[int64]int)
+	for _, th := range s.tagHistories {
+		scores[th.UserID]++
+	}
+	return s.userScore(scores, limit), nil
+}
+
+func (s *Store) userScore(scores map[int64]int, limit int) []shimmie.UserScore {
+	ss := []shimmie.UserScore{}
+	for id, score := range scores {
+		u, ok := s.users[id]
+		if !ok {
+			continue
+		}
+		ss = append(ss, shimmie.UserScore{
+			Score:    score,
+			ID:       u.ID,
+			Name:     u.Name,
+			JoinDate: u.JoinDate,
+			Email:    u.Email,
+			Class:    u.Class,
+		})
+	}
+	sort.Slice(ss, func(i, j int) bool {
+		if ss[i].Score != ss[j].Score {
+			return ss[i].Score > ss[j].Score
+		}
+		return ss[i].ID < ss[j].ID
+	})
+	if limit >= 0 && len(ss) > limit {
+		ss = ss[:limit]
+	}
+	return ss
+}
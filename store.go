@@ -0,0 +1,200 @@
+package shimmie
+
+import (
+	"context"
+	"time"
+)
+
+// ImageStore describes operations on image metadata. CreateImage returns a
+// *HashBannedError if the hash of the image is banned. DeleteImage only
+// deletes the metadata of an image, use Shimmie.DeleteImage to also remove
+// its files.
+type ImageStore interface {
+	CreateImage(ctx context.Context, img Image) (int64, error)
+	GetImage(ctx context.Context, id int) (*Image, error)
+	RateImage(ctx context.Context, id int, rating string) error
+	GetRatedImages(ctx context.Context, username string) ([]RatedImage, error)
+	ListImages(ctx context.Context, filter ImageFilter, limit int, cursor string) ([]Image, string, error)
+	DeleteImage(ctx context.Context, id int64, d ImageDeletion) (*Image, error)
+}
+
+// RelationshipStore describes operations on the parent and child
+// relationships of images, which also keep the HasChildren flag of the
+// parents up to date and are logged. SetParent returns ErrParentCycle if
+// the parent is the child or one of its descendants and sql.ErrNoRows if
+// either image does not exist. Removing the parent of an image that has
+// none has no effect. GetFamily returns the topmost ancestor of an image
+// with all of its descendants, ordered by ID.
+type RelationshipStore interface {
+	SetParent(ctx context.Context, childID, parentID int64, user *User, address string) error
+	RemoveParent(ctx context.Context, childID int64, user *User, address string) error
+	GetChildren(ctx context.Context, parentID int64) ([]Image, error)
+	GetFamily(ctx context.Context, id int64) ([]Image, error)
+}
+
+// FavoriteStore describes operations on the favorite images of users, which
+// also keep the Favorites count of the images up to date. Adding a favorite
+// twice or removing one that does not exist has no effect. AddFavorite
+// returns sql.ErrNoRows if the user or the image does not exist.
+// ListFavorites returns the favorites of a user, most recent first, and
+// FavoritedBy the users that favorited an image, ordered by name.
+// MostFavorited returns the images that were favorited the most times since
+// a time, most favorited first.
+type FavoriteStore interface {
+	AddFavorite(ctx context.Context, userID, imageID int64) error
+	RemoveFavorite(ctx context.Context, userID, imageID int64) error
+	ListFavorites(ctx context.Context, userID int64, limit int, cursor string) ([]Image, string, error)
+	FavoritedBy(ctx context.Context, imageID int64) ([]User, error)
+	MostFavorited(ctx context.Context, since time.Time, limit int) ([]ImageScore, error)
+}
+
+// ScoreStore describes operations on the numeric score votes of images.
+// Each user has one vote per image of -1, 0 or +1, where 0 removes the vote,
+// and the NumericScore of an image is the sum of its votes. Vote returns
+// ErrInvalidVote for other scores and sql.ErrNoRows if the user or the image
+// does not exist. GetVote returns 0 if the user has not voted. TopImages
+// returns the images with a positive score that were posted since a time,
+// highest score first; a zero time includes all images.
+type ScoreStore interface {
+	Vote(ctx context.Context, userID, imageID int64, score int) error
+	GetVote(ctx context.Context, userID, imageID int64) (int, error)
+	TopImages(ctx context.Context, since time.Time, limit int) ([]Image, error)
+}
+
+// PHashStore describes operations on the perceptual hashes of images.
+// GetImagePHash returns sql.ErrNoRows if the image has no hash.
+type PHashStore interface {
+	SetImagePHash(ctx context.Context, imageID int64, phash uint64) error
+	GetImagePHash(ctx context.Context, imageID int64) (uint64, error)
+	ListImagePHashes(ctx context.Context, limit int, cursor string) ([]ImagePHash, string, error)
+}
+
+// HashBanStore describes operations on the banned image hashes. Banning a
+// hash that is already banned has no effect. UnbanHash returns
+// sql.ErrNoRows if the hash is not banned.
+type HashBanStore interface {
+	BanHash(ctx context.Context, hash, reason string, user *User) error
+	IsHashBanned(ctx context.Context, hash string) (bool, error)
+	ListHashBans(ctx context.Context, limit int, cursor string) ([]ImageBan, string, error)
+	UnbanHash(ctx context.Context, hash string) error
+}
+
+// IPBanStore describes operations on the bans of IP addresses and ranges.
+// AddIPBan sets the ID and Added time of the ban and stores its IP in
+// canonical form. RemoveIPBan returns sql.ErrNoRows if there is no such ban.
+// ActiveIPBans returns all the bans that have not expired, which is what an
+// IPBanList loads.
+type IPBanStore interface {
+	AddIPBan(ctx context.Context, ban *IPBan) error
+	RemoveIPBan(ctx context.Context, id int64) error
+	ListIPBans(ctx context.Context, limit int, cursor string) ([]IPBan, string, error)
+	ActiveIPBans(ctx context.Context) ([]IPBan, error)
+}
+
+// PoolStore describes operations on pools. CreatePool and UpdatePool return
+// ErrPoolTitleEmpty or ErrPoolTitleTaken for invalid titles. The methods
+// return sql.ErrNoRows if a pool or image does not exist.
+//
+// AddPoolImages appends images to the end of a pool, skipping the ones that
+// it already has, and RemovePoolImages removes them. Both record the images
+// that were actually changed in the history of the pool. SetPoolOrder moves
+// the given images, which must be in the pool, to its start in that order
+// and keeps the order of the rest after them. PoolNeighbors returns the
+// images before and after an image of a pool, or zero at either end.
+type PoolStore interface {
+	CreatePool(ctx context.Context, p *Pool) error
+	GetPool(ctx context.Context, id int64) (*Pool, error)
+	UpdatePool(ctx context.Context, p *Pool) error
+	DeletePool(ctx context.Context, id int64) error
+	ListPools(ctx context.Context, limit int, cursor string) ([]Pool, string, error)
+	AddPoolImages(ctx context.Context, poolID, userID int64, imageIDs []int64) error
+	RemovePoolImages(ctx context.Context, poolID, userID int64, imageIDs []int64) error
+	SetPoolOrder(ctx context.Context, poolID int64, imageIDs []int64) error
+	GetPoolImages(ctx context.Context, poolID int64) ([]Image, error)
+	ImagePools(ctx context.Context, imageID int64) ([]Pool, error)
+	PoolNeighbors(ctx context.Context, poolID, imageID int64) (prev, next int64, err error)
+	ListPoolHistory(ctx context.Context, poolID int64, limit int, cursor string) ([]PoolHistory, string, error)
+}
+
+// TagStore describes operations on image tags.
+type TagStore interface {
+	GetTag(ctx context.Context, tag string) (*Tag, error)
+	DeleteTag(ctx context.Context, tag string) error
+	CreateTag(ctx context.Context, t *Tag) error
+	GetAllTags(ctx context.Context, limit, offset int) ([]*Tag, error)
+	ListTags(ctx context.Context, limit int, cursor string) ([]*Tag, string, error)
+	Autocomplete(ctx context.Context, q string, limit, offset int) ([]*Autocomplete, error)
+}
+
+// AliasStore describes operations on tag alias.
+type AliasStore interface {
+	GetAlias(ctx context.Context, oldTag string) (*Alias, error)
+	DeleteAlias(ctx context.Context, oldTag string) error
+	CreateAlias(ctx context.Context, alias *Alias) error
+	CountAlias(ctx context.Context) (int, error)
+	GetAllAlias(ctx context.Context, limit, offset int) ([]Alias, error)
+	ListAlias(ctx context.Context, limit int, cursor string) ([]Alias, string, error)
+	FindAlias(ctx context.Context, oldTag, newTag string) ([]Alias, error)
+}
+
+// PMStore describes operations on private messages. MarkPMRead, DeletePM
+// and GetThread act on behalf of userID and only see the messages that userID
+// has sent or received and has not deleted. CreatePM stores a message as it
+// is while SendPM and ReplyPM apply the limits of CheckPM, the block list of
+// the recipient and the rate limit of the sender.
+type PMStore interface {
+	CreatePM(ctx context.Context, pm *PM) error
+	SendPM(ctx context.Context, pm *PM) error
+	GetPMs(ctx context.Context, from, to string, choice PMChoice) ([]*PM, error)
+	MarkPMRead(ctx context.Context, id, userID int64) error
+	DeletePM(ctx context.Context, id, userID int64) error
+	ReplyPM(ctx context.Context, parentID int64, reply *PM) error
+	GetThread(ctx context.Context, userID, otherID int64, limit int, cursor string) ([]*PM, string, error)
+	PMInboxSummary(ctx context.Context, userID int64) (*PMInbox, error)
+	BlockPMSender(ctx context.Context, userID, blockedID int64) error
+	UnblockPMSender(ctx context.Context, userID, blockedID int64) error
+	GetPMBlocks(ctx context.Context, userID int64) ([]int64, error)
+	SetPMRateLimit(ctx context.Context, userID int64, limit PMRateLimit) error
+	GetPMRateLimit(ctx context.Context, userID int64) (PMRateLimit, error)
+	ListFlaggedPMs(ctx context.Context, limit int, cursor string) ([]*PM, string, error)
+	UnflagPM(ctx context.Context, id int64) error
+}
+
+// LogStore describes operations on the shimmie log.
+type LogStore interface {
+	Log(ctx context.Context, section, username, address string, priority int, message string) (*SCoreLog, error)
+	LogRating(ctx context.Context, imgID int, imgRating, username, userIP string) error
+	QueryLogs(ctx context.Context, filter LogFilter, limit int, cursor string) ([]SCoreLog, string, error)
+}
+
+// ConfigStore describes operations on the shimmie configuration.
+type ConfigStore interface {
+	GetConfig(ctx context.Context, keys ...string) (map[string]string, error)
+	GetCommon(ctx context.Context) (*Common, error)
+	SetConfig(ctx context.Context, name, value string) error
+	// SetConfigs sets many config values at once. Either all of them are
+	// set or none is.
+	SetConfigs(ctx context.Context, values map[string]string) error
+}
+
+// UserStore describes operations on users.
+type UserStore interface {
+	UserGetter
+	GetUser(ctx context.Context, userID int64) (*User, error)
+	CreateUser(ctx context.Context, u *User) error
+	DeleteUser(ctx context.Context, id int64) error
+	CountUsers(ctx context.Context) (int, error)
+	GetAllUsers(ctx context.Context, limit, offset int) ([]User, error)
+	ListUsers(ctx context.Context, limit int, cursor string) ([]User, string, error)
+	Verify(ctx context.Context, username, password string) (*User, error)
+	MostImageUploads(ctx context.Context, limit int) ([]UserScore, error)
+	MostTagEdits(ctx context.Context, limit int) ([]UserScore, error)
+}
+
+// TagHistoryStore describes operations on the tag history of images.
+type TagHistoryStore interface {
+	CreateTagHistory(ctx context.Context, th TagHistory) (int64, error)
+	GetImageTagHistory(ctx context.Context, imageID int) ([]TagHistory, error)
+	GetTagHistory(ctx context.Context, id int) (*TagHistory, error)
+	GetContributedTagHistory(ctx context.Context, imageOwnerUsername string) ([]ContributedTagHistory, error)
+}
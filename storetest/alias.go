@@ -1,6 +1,7 @@
-package shimmiedb_test
+package storetest
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"reflect"
@@ -9,9 +10,8 @@ import (
 	"github.com/kusubooru/shimmie"
 )
 
-func TestAlias(t *testing.T) {
-	shim, schema := setup(t)
-	defer teardown(t, shim, schema)
+func testAlias(t *testing.T, shim Store) {
+	ctx := context.Background()
 
 	oldTag := "old_tag"
 	alias := &shimmie.Alias{
@@ -19,7 +19,7 @@ func TestAlias(t *testing.T) {
 		NewTag: "new_tag",
 	}
 	// Create an Alias.
-	err := shim.CreateAlias(alias)
+	err := shim.CreateAlias(ctx, alias)
 	if err != nil {
 		t.Fatalf("CreateAlias(%q) returned err: %v", alias, err)
 	}
@@ -30,14 +30,14 @@ func TestAlias(t *testing.T) {
 	}
 	// Attempt to create a new alias that has the same old tag and expect
 	// error.
-	err = shim.CreateAlias(anotherAlias)
+	err = shim.CreateAlias(ctx, anotherAlias)
 	if err == nil {
 		t.Fatalf("CreateAlias(%q) must return err because it has\n"+
 			"  the same old tag as %q which already exists in the database.", anotherAlias, alias)
 	}
 
 	// Get successfully created alias.
-	got, err := shim.GetAlias(oldTag)
+	got, err := shim.GetAlias(ctx, oldTag)
 	if err != nil {
 		t.Fatalf("GetAlias(%q) returned err: %v", oldTag, err)
 	}
@@ -46,7 +46,7 @@ func TestAlias(t *testing.T) {
 	}
 
 	// Count created alias and find only 1.
-	count, err := shim.CountAlias()
+	count, err := shim.CountAlias(ctx)
 	if err != nil {
 		t.Errorf("CountAlias() returned err: %v", err)
 	}
@@ -55,21 +55,20 @@ func TestAlias(t *testing.T) {
 	}
 
 	// Deleted created alias.
-	if err := shim.DeleteAlias(oldTag); err != nil {
+	if err := shim.DeleteAlias(ctx, oldTag); err != nil {
 		t.Errorf("DeleteAlias(%q) returned err: %v", oldTag, err)
 	}
 
 	// Attempt to get alias again and expect no rows err.
-	_, err = shim.GetAlias(oldTag)
+	_, err = shim.GetAlias(ctx, oldTag)
 	if got, want := err, sql.ErrNoRows; got != want {
 		t.Errorf("GetAlias(%q) after delete returned err = %v, want %v", oldTag, got, want)
 	}
 
 }
 
-func TestGetAllAlias(t *testing.T) {
-	shim, schema := setup(t)
-	defer teardown(t, shim, schema)
+func testGetAllAlias(t *testing.T, shim Store) {
+	ctx := context.Background()
 
 	newTag, max := "old_tag", 10
 	for i := 0; i < max; i++ {
@@ -77,7 +76,7 @@ func TestGetAllAlias(t *testing.T) {
 			OldTag: fmt.Sprintf("old_tag%d", i),
 			NewTag: newTag,
 		}
-		err := shim.CreateAlias(a)
+		err := shim.CreateAlias(ctx, a)
 		if err != nil {
 			t.Fatalf("CreateAlias(%q) returned err: %v", a, err)
 		}
@@ -98,7 +97,7 @@ func TestGetAllAlias(t *testing.T) {
 
 	for _, tt := range getAllAliasTests {
 		limit, offset := tt.limit, tt.offset
-		alias, err := shim.GetAllAlias(limit, offset)
+		alias, err := shim.GetAllAlias(ctx, limit, offset)
 		if err != nil {
 			t.Fatalf("GetAllAlias(%d, %d) returned err: %v", limit, offset, err)
 		}
@@ -108,9 +107,8 @@ func TestGetAllAlias(t *testing.T) {
 	}
 }
 
-func TestFindAlias(t *testing.T) {
-	shim, schema := setup(t)
-	defer teardown(t, shim, schema)
+func testFindAlias(t *testing.T, shim Store) {
+	ctx := context.Background()
 
 	alias := []shimmie.Alias{
 		{NewTag: "character:sarah_fortune", OldTag: "character:miss_fortune"},
@@ -120,7 +118,7 @@ func TestFindAlias(t *testing.T) {
 		{NewTag: "character:sarah_fortune", OldTag: "sarah_fortune"},
 	}
 	for _, a := range alias {
-		err := shim.CreateAlias(&a)
+		err := shim.CreateAlias(ctx, &a)
 		if err != nil {
 			t.Fatalf("CreateAlias(%q) returned err: %v", a, err)
 		}
@@ -138,7 +136,7 @@ func TestFindAlias(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		res, err := shim.FindAlias(tt.oldTag, tt.newTag)
+		res, err := shim.FindAlias(ctx, tt.oldTag, tt.newTag)
 		if err != nil {
 			t.Fatalf("FindAlias(%q, %q) returned err: %v", tt.oldTag, tt.newTag, err)
 		}
@@ -1,15 +1,15 @@
-package shimmiedb_test
+package storetest
 
 import (
+	"context"
 	"reflect"
 	"testing"
 
 	"github.com/kusubooru/shimmie"
 )
 
-func TestVerify(t *testing.T) {
-	shim, schema := setup(t)
-	defer teardown(t, shim, schema)
+func testVerify(t *testing.T, shim Store) {
+	ctx := context.Background()
 
 	username := "john"
 	password := "1234"
@@ -20,13 +20,13 @@ func TestVerify(t *testing.T) {
 	}
 
 	// Create a user.
-	err := shim.CreateUser(u)
+	err := shim.CreateUser(ctx, u)
 	if err != nil {
 		t.Fatalf("CreateUser(%q) returned err: %v", u, err)
 	}
 
 	// Verify success case.
-	got, err := shim.Verify(username, password)
+	got, err := shim.Verify(ctx, username, password)
 	if err != nil {
 		t.Fatalf("Verify(%q, %q) returned err: %v", username, password, err)
 	}
@@ -36,7 +36,7 @@ func TestVerify(t *testing.T) {
 
 	// Verify wrong password case.
 	password = "wrongpassword"
-	_, err = shim.Verify(username, password)
+	_, err = shim.Verify(ctx, username, password)
 	if err == nil {
 		t.Fatalf("Verify(%q, %q) expected to return err", username, password)
 	}
@@ -47,7 +47,7 @@ func TestVerify(t *testing.T) {
 	// Verify user not found case.
 	username = "nonexistentuser"
 	password = "wrongpassword"
-	_, err = shim.Verify(username, password)
+	_, err = shim.Verify(ctx, username, password)
 	if err == nil {
 		t.Fatalf("Verify(%q, %q) expected to return err", username, password)
 	}
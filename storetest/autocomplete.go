@@ -1,21 +1,20 @@
-package shimmiedb_test
+package storetest
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
 	"reflect"
 	"testing"
 
 	"github.com/kusubooru/shimmie"
 )
 
-func TestAutocomplete(t *testing.T) {
-	shim, schema := setup(t)
-	defer teardown(t, shim, schema)
+func testAutocomplete(t *testing.T, shim Store) {
+	ctx := context.Background()
 
 	// Test that searching with empty query returns empty results.
 	empty := ""
-	emptyAutocomplete, err := shim.Autocomplete(empty, 10, 0)
+	emptyAutocomplete, err := shim.Autocomplete(ctx, empty, 10, 0)
 	if err != nil {
 		t.Fatalf("Autocomplete(%q) returned err: %v", empty, err)
 	}
@@ -26,7 +25,7 @@ func TestAutocomplete(t *testing.T) {
 	tagName := "character:chun-li"
 	chunLiTag := &shimmie.Tag{Tag: tagName, Count: 5}
 	// Create a tag.
-	if err := shim.CreateTag(chunLiTag); err != nil {
+	if err := shim.CreateTag(ctx, chunLiTag); err != nil {
 		t.Fatalf("CreateTag(%q) returned err: %v", chunLiTag, err)
 	}
 
@@ -35,20 +34,20 @@ func TestAutocomplete(t *testing.T) {
 		NewTag: tagName,
 	}
 	// Create an Alias for the previous tag.
-	if err := shim.CreateAlias(alias); err != nil {
+	if err := shim.CreateAlias(ctx, alias); err != nil {
 		t.Fatalf("CreateAlias(%q) returned err: %v", alias, err)
 	}
 
 	chunTag := &shimmie.Tag{Tag: "chun", Count: 1}
 	// Create another unrelated tag.
-	if err := shim.CreateTag(chunTag); err != nil {
+	if err := shim.CreateTag(ctx, chunTag); err != nil {
 		t.Fatalf("CreateTag(%q) returned err: %v", chunTag, err)
 	}
 
 	// Do an autocomplete query for a term that should include both the tag
 	// with its alias and the unrelated tag.
 	q := "chun"
-	tags, err := shim.Autocomplete(q, 10, 0)
+	tags, err := shim.Autocomplete(ctx, q, 10, 0)
 	if err != nil {
 		t.Fatalf("Autocomplete(%q) returned err: %v", q, err)
 	}
@@ -63,8 +62,23 @@ func TestAutocomplete(t *testing.T) {
 	if got, want := tags, expected; !reflect.DeepEqual(got, want) {
 		t.Errorf("Autocomplete(%q) -> %#+v, want %#+v", q, got, want)
 		data, _ := json.Marshal(got)
-		fmt.Println(string(data))
+		t.Logf("got:  %s", data)
 		data, _ = json.Marshal(want)
-		fmt.Println(string(data))
+		t.Logf("want: %s", data)
+	}
+
+	// Searching is case insensitive, unused tags are ignored and results
+	// can be paginated.
+	unusedTag := &shimmie.Tag{Tag: "chun_unused", Count: 0}
+	if err := shim.CreateTag(ctx, unusedTag); err != nil {
+		t.Fatalf("CreateTag(%q) returned err: %v", unusedTag, err)
+	}
+	q = "CHUN"
+	tags, err = shim.Autocomplete(ctx, q, 1, 1)
+	if err != nil {
+		t.Fatalf("Autocomplete(%q, 1, 1) returned err: %v", q, err)
+	}
+	if got, want := tags, expected[1:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("Autocomplete(%q, 1, 1) -> %#+v, want %#+v", q, got, want)
 	}
 }
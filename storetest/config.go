@@ -0,0 +1,64 @@
+package storetest
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func testConfig(t *testing.T, shim Store) {
+	ctx := context.Background()
+
+	values := map[string]string{
+		"title":        "kusubooru",
+		"thumb_width":  "192",
+		"it's":         "quoted",
+		"index_images": "",
+	}
+	for name, value := range values {
+		if err := shim.SetConfig(ctx, name, value); err != nil {
+			t.Fatalf("SetConfig(%q, %q) failed: %v", name, value, err)
+		}
+	}
+	if err := shim.SetConfig(ctx, "thumb_width", "250"); err != nil {
+		t.Fatalf("SetConfig overwrite failed: %v", err)
+	}
+	values["thumb_width"] = "250"
+
+	got, err := shim.GetConfig(ctx)
+	if err != nil {
+		t.Fatalf("GetConfig() failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, values) {
+		t.Errorf("GetConfig() = %v, want %v", got, values)
+	}
+
+	got, err = shim.GetConfig(ctx, "it's", "thumb_width", "missing")
+	if err != nil {
+		t.Fatalf("GetConfig(keys) failed: %v", err)
+	}
+	want := map[string]string{"it's": "quoted", "thumb_width": "250"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetConfig(keys) = %v, want %v", got, want)
+	}
+
+	if err := shim.SetConfigs(ctx, map[string]string{"title": "kusubooru 2", "ext_tagger_version": "1"}); err != nil {
+		t.Fatalf("SetConfigs failed: %v", err)
+	}
+	got, err = shim.GetConfig(ctx, "title", "ext_tagger_version", "thumb_width")
+	if err != nil {
+		t.Fatalf("GetConfig(keys) failed: %v", err)
+	}
+	want = map[string]string{"title": "kusubooru 2", "ext_tagger_version": "1", "thumb_width": "250"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetConfig(keys) after SetConfigs = %v, want %v", got, want)
+	}
+
+	common, err := shim.GetCommon(ctx)
+	if err != nil {
+		t.Fatalf("GetCommon() failed: %v", err)
+	}
+	if common.Title != "kusubooru 2" {
+		t.Errorf("GetCommon().Title = %q, want %q", common.Title, "kusubooru 2")
+	}
+}
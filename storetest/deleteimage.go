@@ -0,0 +1,68 @@
+package storetest
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/kusubooru/shimmie"
+)
+
+func testDeleteImage(t *testing.T, shim Store) {
+	ctx := context.Background()
+
+	u := shimmie.User{Name: "bob"}
+	if err := shim.CreateUser(ctx, &u); err != nil {
+		t.Fatalf("CreateUser(%#v) returned err: %v", u, err)
+	}
+	hash := "0123456789abcdef0123456789abcdef"
+	id, err := shim.CreateImage(ctx, shimmie.Image{OwnerID: u.ID, Hash: hash})
+	if err != nil {
+		t.Fatalf("CreateImage returned err: %v", err)
+	}
+	if err := shim.SetImagePHash(ctx, id, 42); err != nil {
+		t.Fatalf("SetImagePHash returned err: %v", err)
+	}
+	if _, err := shim.CreateTagHistory(ctx, shimmie.TagHistory{ImageID: id, UserID: u.ID, Tags: "a b"}); err != nil {
+		t.Fatalf("CreateTagHistory returned err: %v", err)
+	}
+
+	d := shimmie.ImageDeletion{User: &u, Address: "10.0.0.1", Reason: "DMCA", BanHash: true}
+	img, err := shim.DeleteImage(ctx, id, d)
+	if err != nil {
+		t.Fatalf("DeleteImage returned err: %v", err)
+	}
+	if img.ID != id || img.Hash != hash {
+		t.Errorf("DeleteImage returned image %d with hash %q, want %d with hash %q", img.ID, img.Hash, id, hash)
+	}
+	if _, err := shim.GetImage(ctx, int(id)); err != sql.ErrNoRows {
+		t.Errorf("GetImage(deleted) err = %v, want %v", err, sql.ErrNoRows)
+	}
+	if _, err := shim.GetImagePHash(ctx, id); err != sql.ErrNoRows {
+		t.Errorf("GetImagePHash(deleted) err = %v, want %v", err, sql.ErrNoRows)
+	}
+	history, err := shim.GetImageTagHistory(ctx, int(id))
+	if err != nil {
+		t.Fatalf("GetImageTagHistory returned err: %v", err)
+	}
+	if len(history) != 0 {
+		t.Errorf("GetImageTagHistory(deleted) = %v, want none", history)
+	}
+
+	for section, want := range map[string]string{
+		"core-image":     d.LogMessage(img),
+		"image_hash_ban": shimmie.HashBanLogMessage(hash, "DMCA"),
+	} {
+		logs, _, err := shim.QueryLogs(ctx, shimmie.LogFilter{Section: section}, 0, "")
+		if err != nil {
+			t.Fatalf("QueryLogs returned err: %v", err)
+		}
+		if len(logs) != 1 || logs[0].Message != want || logs[0].Username != "bob" || logs[0].Address != "10.0.0.1" {
+			t.Errorf("%s logs = %+v, want one by bob from 10.0.0.1 with message %q", section, logs, want)
+		}
+	}
+
+	if _, err := shim.DeleteImage(ctx, id, d); err != sql.ErrNoRows {
+		t.Errorf("DeleteImage(deleted) err = %v, want %v", err, sql.ErrNoRows)
+	}
+}
@@ -0,0 +1,222 @@
+package storetest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kusubooru/shimmie"
+)
+
+func testFavorites(t *testing.T, shim Store) {
+	ctx := context.Background()
+
+	var users []shimmie.User
+	for _, name := range []string{"bob", "ann", "cid"} {
+		u := shimmie.User{Name: name}
+		if err := shim.CreateUser(ctx, &u); err != nil {
+			t.Fatalf("CreateUser(%#v) returned err: %v", u, err)
+		}
+		users = append(users, u)
+	}
+	bob, ann, cid := users[0], users[1], users[2]
+	var ids []int64
+	for i := 0; i < 4; i++ {
+		id, err := shim.CreateImage(ctx, shimmie.Image{OwnerID: bob.ID, Hash: fmt.Sprintf("%032d", i)})
+		if err != nil {
+			t.Fatalf("CreateImage returned err: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	favorite := func(u shimmie.User, imageID int64) {
+		t.Helper()
+		if err := shim.AddFavorite(ctx, u.ID, imageID); err != nil {
+			t.Fatalf("AddFavorite(%s, %d) returned err: %v", u.Name, imageID, err)
+		}
+	}
+	favorites := func(imageID int64) int {
+		t.Helper()
+		img, err := shim.GetImage(ctx, int(imageID))
+		if err != nil {
+			t.Fatalf("GetImage(%d) returned err: %v", imageID, err)
+		}
+		return img.Favorites
+	}
+
+	for _, id := range ids {
+		favorite(bob, id)
+	}
+	favorite(ann, ids[0])
+	favorite(cid, ids[0])
+	// Adding again has no effect.
+	favorite(cid, ids[0])
+	if err := shim.AddFavorite(ctx, bob.ID, 999); err != sql.ErrNoRows {
+		t.Errorf("AddFavorite(missing image) err = %v, want %v", err, sql.ErrNoRows)
+	}
+	if err := shim.AddFavorite(ctx, 999, ids[0]); err != sql.ErrNoRows {
+		t.Errorf("AddFavorite(missing user) err = %v, want %v", err, sql.ErrNoRows)
+	}
+	if got := favorites(ids[0]); got != 3 {
+		t.Errorf("image %d has %d favorites, want 3", ids[0], got)
+	}
+
+	by, err := shim.FavoritedBy(ctx, ids[0])
+	if err != nil {
+		t.Fatalf("FavoritedBy returned err: %v", err)
+	}
+	var names []string
+	for _, u := range by {
+		names = append(names, u.Name)
+	}
+	if got, want := fmt.Sprint(names), "[ann bob cid]"; got != want {
+		t.Errorf("FavoritedBy(%d) = %v, want %v", ids[0], got, want)
+	}
+
+	var (
+		list   []int64
+		cursor string
+	)
+	for {
+		page, next, err := shim.ListFavorites(ctx, bob.ID, 3, cursor)
+		if err != nil {
+			t.Fatalf("ListFavorites returned err: %v", err)
+		}
+		for _, img := range page {
+			list = append(list, img.ID)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if got, want := fmt.Sprint(list), fmt.Sprint([]int64{ids[3], ids[2], ids[1], ids[0]}); got != want {
+		t.Errorf("ListFavorites(bob) = %v, want %v", got, want)
+	}
+
+	if err := shim.RemoveFavorite(ctx, ann.ID, ids[0]); err != nil {
+		t.Fatalf("RemoveFavorite returned err: %v", err)
+	}
+	if err := shim.RemoveFavorite(ctx, ann.ID, ids[0]); err != nil {
+		t.Errorf("RemoveFavorite(not favorite) returned err: %v", err)
+	}
+	if got := favorites(ids[0]); got != 2 {
+		t.Errorf("image %d has %d favorites after remove, want 2", ids[0], got)
+	}
+
+	// Deleting a user removes their favorites.
+	if err := shim.DeleteUser(ctx, cid.ID); err != nil {
+		t.Fatalf("DeleteUser returned err: %v", err)
+	}
+	if got := favorites(ids[0]); got != 1 {
+		t.Errorf("image %d has %d favorites after DeleteUser, want 1", ids[0], got)
+	}
+	if _, err := shim.DeleteImage(ctx, ids[1], shimmie.ImageDeletion{}); err != nil {
+		t.Fatalf("DeleteImage returned err: %v", err)
+	}
+	page, _, err := shim.ListFavorites(ctx, bob.ID, 0, "")
+	if err != nil {
+		t.Fatalf("ListFavorites returned err: %v", err)
+	}
+	if len(page) != 3 {
+		t.Errorf("ListFavorites(bob) after DeleteImage returned %d images, want 3", len(page))
+	}
+
+	// Adding the same favorite at the same time has no effect either.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := shim.AddFavorite(ctx, ann.ID, ids[2]); err != nil {
+				t.Errorf("concurrent AddFavorite returned err: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := favorites(ids[2]); got != 2 {
+		t.Errorf("image %d has %d favorites after concurrent adds, want 2", ids[2], got)
+	}
+
+	// Favorites added and removed by different users at the same time are
+	// all counted.
+	var adders []shimmie.User
+	for i := 0; i < 5; i++ {
+		u := shimmie.User{Name: fmt.Sprintf("fan%d", i)}
+		if err := shim.CreateUser(ctx, &u); err != nil {
+			t.Fatalf("CreateUser(%#v) returned err: %v", u, err)
+		}
+		adders = append(adders, u)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := shim.RemoveFavorite(ctx, bob.ID, ids[2]); err != nil {
+			t.Errorf("concurrent RemoveFavorite returned err: %v", err)
+		}
+	}()
+	for _, u := range adders {
+		wg.Add(1)
+		go func(u shimmie.User) {
+			defer wg.Done()
+			if err := shim.AddFavorite(ctx, u.ID, ids[2]); err != nil {
+				t.Errorf("concurrent AddFavorite(%s) returned err: %v", u.Name, err)
+			}
+		}(u)
+	}
+	wg.Wait()
+	if got, want := favorites(ids[2]), 1+len(adders); got != want {
+		t.Errorf("image %d has %d favorites after concurrent changes, want %d", ids[2], got, want)
+	}
+}
+
+func testMostFavorited(t *testing.T, shim Store) {
+	ctx := context.Background()
+
+	var users []shimmie.User
+	for i := 0; i < 3; i++ {
+		u := shimmie.User{Name: fmt.Sprintf("user%d", i)}
+		if err := shim.CreateUser(ctx, &u); err != nil {
+			t.Fatalf("CreateUser(%#v) returned err: %v", u, err)
+		}
+		users = append(users, u)
+	}
+	var ids []int64
+	for i := 0; i < 4; i++ {
+		id, err := shim.CreateImage(ctx, shimmie.Image{OwnerID: users[0].ID, Hash: fmt.Sprintf("%032d", i)})
+		if err != nil {
+			t.Fatalf("CreateImage returned err: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	// Image 2 gets 3 favorites, images 0 and 1 get 1 and image 3 none.
+	for _, f := range []struct {
+		user  int
+		image int
+	}{{0, 2}, {1, 2}, {2, 2}, {0, 0}, {1, 1}} {
+		if err := shim.AddFavorite(ctx, users[f.user].ID, ids[f.image]); err != nil {
+			t.Fatalf("AddFavorite returned err: %v", err)
+		}
+	}
+
+	scores, err := shim.MostFavorited(ctx, time.Now().Add(-time.Hour), 2)
+	if err != nil {
+		t.Fatalf("MostFavorited returned err: %v", err)
+	}
+	if len(scores) != 2 || scores[0].Image.ID != ids[2] || scores[0].Score != 3 || scores[1].Image.ID != ids[1] || scores[1].Score != 1 {
+		t.Errorf("MostFavorited = %+v, want image %d with 3 and %d with 1", scores, ids[2], ids[1])
+	}
+	if scores[0].Image.Hash != fmt.Sprintf("%032d", 2) {
+		t.Errorf("MostFavorited returned image with hash %q, want the hash of image %d", scores[0].Image.Hash, ids[2])
+	}
+
+	scores, err = shim.MostFavorited(ctx, time.Now().Add(time.Hour), 0)
+	if err != nil {
+		t.Fatalf("MostFavorited returned err: %v", err)
+	}
+	if len(scores) != 0 {
+		t.Errorf("MostFavorited(future) = %+v, want none", scores)
+	}
+}
@@ -0,0 +1,96 @@
+package storetest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/kusubooru/shimmie"
+)
+
+func testHashBan(t *testing.T, shim Store) {
+	ctx := context.Background()
+
+	u := shimmie.User{Name: "bob"}
+	if err := shim.CreateUser(ctx, &u); err != nil {
+		t.Fatalf("CreateUser(%#v) returned err: %v", u, err)
+	}
+	hashes := []string{
+		"0123456789abcdef0123456789abcdef",
+		"11111111111111111111111111111111",
+		"22222222222222222222222222222222",
+	}
+	for i, hash := range hashes {
+		var user *shimmie.User
+		if i == 0 {
+			user = &u
+		}
+		if err := shim.BanHash(ctx, hash, fmt.Sprintf("reason %d", i), user); err != nil {
+			t.Fatalf("BanHash(%q) returned err: %v", hash, err)
+		}
+	}
+	// Banning again keeps the first ban.
+	if err := shim.BanHash(ctx, "0123456789ABCDEF0123456789ABCDEF", "again", nil); err != nil {
+		t.Fatalf("BanHash(again) returned err: %v", err)
+	}
+
+	banned, err := shim.IsHashBanned(ctx, hashes[0])
+	if err != nil {
+		t.Fatalf("IsHashBanned returned err: %v", err)
+	}
+	if !banned {
+		t.Errorf("IsHashBanned(%q) = false, want true", hashes[0])
+	}
+	banned, err = shim.IsHashBanned(ctx, "33333333333333333333333333333333")
+	if err != nil {
+		t.Fatalf("IsHashBanned returned err: %v", err)
+	}
+	if banned {
+		t.Error("IsHashBanned(not banned) = true, want false")
+	}
+
+	_, err = shim.CreateImage(ctx, shimmie.Image{OwnerID: u.ID, Hash: hashes[0]})
+	var bannedErr *shimmie.HashBannedError
+	if !errors.As(err, &bannedErr) || bannedErr.Reason != "reason 0" {
+		t.Errorf("CreateImage(banned) err = %v, want a HashBannedError with reason %q", err, "reason 0")
+	}
+
+	var (
+		bans   []shimmie.ImageBan
+		cursor string
+	)
+	for {
+		page, next, err := shim.ListHashBans(ctx, 2, cursor)
+		if err != nil {
+			t.Fatalf("ListHashBans returned err: %v", err)
+		}
+		bans = append(bans, page...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if len(bans) != len(hashes) {
+		t.Fatalf("ListHashBans returned %d bans, want %d", len(bans), len(hashes))
+	}
+	for i, b := range bans {
+		if want := hashes[len(hashes)-1-i]; b.Hash != want {
+			t.Errorf("ban %d has hash %q, want %q", i, b.Hash, want)
+		}
+	}
+	if b := bans[len(bans)-1]; b.UserID != u.ID || b.UserName != "bob" || b.Reason != "reason 0" || b.Date.IsZero() {
+		t.Errorf("oldest ban = %+v, want reason 0 by bob", b)
+	}
+
+	if err := shim.UnbanHash(ctx, hashes[0]); err != nil {
+		t.Fatalf("UnbanHash returned err: %v", err)
+	}
+	if err := shim.UnbanHash(ctx, hashes[0]); err != sql.ErrNoRows {
+		t.Errorf("UnbanHash(not banned) err = %v, want %v", err, sql.ErrNoRows)
+	}
+	if _, err := shim.CreateImage(ctx, shimmie.Image{OwnerID: u.ID, Hash: hashes[0]}); err != nil {
+		t.Errorf("CreateImage(unbanned) returned err: %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package storetest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kusubooru/shimmie"
+)
+
+func testCreateImage(t *testing.T, shim Store) {
+	ctx := context.Background()
+
+	u := shimmie.User{Name: "bob", Pass: "bob123"}
+	if err := shim.CreateUser(ctx, &u); err != nil {
+		t.Fatalf("CreateUser(%#v) returned err: %v", u, err)
+	}
+
+	img := shimmie.Image{OwnerID: u.ID}
+	t.Logf("CreateImage(img) should succeed: img=%#v", img)
+	id, err := shim.CreateImage(ctx, img)
+	if err != nil {
+		t.Errorf("CreateImage(img) returned error: %v", err)
+	}
+	if id == 0 {
+		t.Error("CreateImage(img) should return a non-zero id")
+	}
+}
+
+func testListImages(t *testing.T, shim Store) {
+	ctx := context.Background()
+
+	users := []*shimmie.User{
+		{Name: "bob", Pass: "bob123"},
+		{Name: "ann", Pass: "ann123"},
+	}
+	for _, u := range users {
+		if err := shim.CreateUser(ctx, u); err != nil {
+			t.Fatalf("CreateUser(%#v) returned err: %v", u, err)
+		}
+	}
+
+	day := time.Date(2016, 8, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		posted := day.Add(time.Duration(i/2) * 24 * time.Hour)
+		img := shimmie.Image{
+			OwnerID: users[i%2].ID,
+			Hash:    fmt.Sprintf("%032d", i),
+			Ext:     "jpg",
+			Posted:  &posted,
+		}
+		if i >= 8 {
+			img.Ext = "png"
+		}
+		if _, err := shim.CreateImage(ctx, img); err != nil {
+			t.Fatalf("CreateImage(%#v) returned err: %v", img, err)
+		}
+	}
+
+	after, before := day.Add(24*time.Hour), day.Add(3*24*time.Hour)
+	tests := []struct {
+		filter shimmie.ImageFilter
+		want   int
+	}{
+		{filter: shimmie.ImageFilter{}, want: 10},
+		{filter: shimmie.ImageFilter{Order: shimmie.ImageOrderPosted}, want: 10},
+		{filter: shimmie.ImageFilter{Order: shimmie.ImageOrderScore}, want: 10},
+		{filter: shimmie.ImageFilter{OwnerID: users[0].ID}, want: 5},
+		{filter: shimmie.ImageFilter{Ext: "png"}, want: 2},
+		{filter: shimmie.ImageFilter{PostedAfter: &after, PostedBefore: &before}, want: 4},
+	}
+	for _, tt := range tests {
+		// Walk all the pages 3 images at a time and make sure that each
+		// image appears only once.
+		seen := make(map[int64]bool)
+		cursor := ""
+		for {
+			images, next, err := shim.ListImages(ctx, tt.filter, 3, cursor)
+			if err != nil {
+				t.Fatalf("ListImages(%#v, 3, %q) returned err: %v", tt.filter, cursor, err)
+			}
+			for _, img := range images {
+				if seen[img.ID] {
+					t.Errorf("ListImages(%#v) returned image %d twice", tt.filter, img.ID)
+				}
+				seen[img.ID] = true
+			}
+			if next == "" {
+				break
+			}
+			cursor = next
+		}
+		if got, want := len(seen), tt.want; got != want {
+			t.Errorf("ListImages(%#v) returned %d images in total, want %d", tt.filter, got, want)
+		}
+	}
+
+	if _, _, err := shim.ListImages(ctx, shimmie.ImageFilter{}, 3, "bad cursor"); err != shimmie.ErrInvalidCursor {
+		t.Errorf("ListImages with bad cursor returned err = %v, want %v", err, shimmie.ErrInvalidCursor)
+	}
+}
+
+func testGetRatedImages(t *testing.T, shim Store) {
+	ctx := context.Background()
+
+	users := []*shimmie.User{
+		{Name: "bob", Pass: "bob123"},
+		{Name: "ann", Pass: "ann123"},
+	}
+	for _, u := range users {
+		if err := shim.CreateUser(ctx, u); err != nil {
+			t.Fatalf("CreateUser(%#v) returned err: %v", u, err)
+		}
+	}
+
+	var ids []int
+	for i := 0; i < 3; i++ {
+		img := shimmie.Image{OwnerID: users[0].ID, Hash: fmt.Sprintf("%032d", i)}
+		id, err := shim.CreateImage(ctx, img)
+		if err != nil {
+			t.Fatalf("CreateImage(%#v) returned err: %v", img, err)
+		}
+		ids = append(ids, int(id))
+	}
+	// Image 0 is rated safe by ann, image 1 safe by bob and image 2
+	// questionable by ann.
+	ratings := []struct {
+		id       int
+		rating   string
+		username string
+	}{
+		{ids[0], "s", "ann"},
+		{ids[1], "s", "bob"},
+		{ids[2], "q", "ann"},
+	}
+	for _, r := range ratings {
+		if err := shim.RateImage(ctx, r.id, r.rating); err != nil {
+			t.Fatalf("RateImage(%d, %q) returned err: %v", r.id, r.rating, err)
+		}
+		if err := shim.LogRating(ctx, r.id, r.rating, r.username, "127.0.0.1"); err != nil {
+			t.Fatalf("LogRating(%d, %q, %q) returned err: %v", r.id, r.rating, r.username, err)
+		}
+	}
+
+	images, err := shim.GetRatedImages(ctx, "bob")
+	if err != nil {
+		t.Fatalf("GetRatedImages(%q) returned err: %v", "bob", err)
+	}
+	if got, want := len(images), 1; got != want {
+		t.Fatalf("GetRatedImages(%q) returned %d images, want %d: %#v", "bob", got, want, images)
+	}
+	got := images[0]
+	if got.ID != int64(ids[0]) || got.Rater != "ann" || got.RaterIP != "127.0.0.1" || got.Rating != "s" {
+		t.Errorf("GetRatedImages(%q) = %#v, want image %d rated s by ann from 127.0.0.1", "bob", got, ids[0])
+	}
+	if got.RateDate == nil {
+		t.Errorf("GetRatedImages(%q) returned image without RateDate", "bob")
+	}
+}
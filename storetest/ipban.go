@@ -0,0 +1,91 @@
+package storetest
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/kusubooru/shimmie"
+)
+
+func testIPBan(t *testing.T, shim Store) {
+	ctx := context.Background()
+
+	u := shimmie.User{Name: "bob"}
+	if err := shim.CreateUser(ctx, &u); err != nil {
+		t.Fatalf("CreateUser(%#v) returned err: %v", u, err)
+	}
+	if err := shim.AddIPBan(ctx, &shimmie.IPBan{IP: "not an ip", BannerID: u.ID}); err == nil {
+		t.Error("AddIPBan(invalid IP) returned no error")
+	}
+
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	bans := []shimmie.IPBan{
+		{IP: "10.0.0.1", Reason: "spam", BannerID: u.ID},
+		{IP: "192.168.1.77/24", Reason: "range", BannerID: u.ID, Expires: &future},
+		{IP: "10.0.0.2", Reason: "expired", BannerID: u.ID, Expires: &past},
+	}
+	for i := range bans {
+		if err := shim.AddIPBan(ctx, &bans[i]); err != nil {
+			t.Fatalf("AddIPBan(%q) returned err: %v", bans[i].IP, err)
+		}
+		if bans[i].ID == 0 || bans[i].Added.IsZero() {
+			t.Errorf("AddIPBan(%q) did not set the ID and Added time: %+v", bans[i].IP, bans[i])
+		}
+	}
+	if got, want := bans[1].IP, "192.168.1.0/24"; got != want {
+		t.Errorf("AddIPBan stored range as %q, want %q", got, want)
+	}
+
+	var (
+		all    []shimmie.IPBan
+		cursor string
+	)
+	for {
+		page, next, err := shim.ListIPBans(ctx, 2, cursor)
+		if err != nil {
+			t.Fatalf("ListIPBans returned err: %v", err)
+		}
+		all = append(all, page...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if len(all) != len(bans) {
+		t.Fatalf("ListIPBans returned %d bans, want %d", len(all), len(bans))
+	}
+	for i, b := range all {
+		want := bans[len(bans)-1-i]
+		if b.ID != want.ID || b.IP != want.IP || b.Reason != want.Reason || b.BannerID != u.ID || b.BannerName != "bob" {
+			t.Errorf("ban %d = %+v, want %+v by bob", i, b, want)
+		}
+		if (b.Expires == nil) != (want.Expires == nil) {
+			t.Errorf("ban %d expires %v, want %v", i, b.Expires, want.Expires)
+		}
+	}
+
+	active, err := shim.ActiveIPBans(ctx)
+	if err != nil {
+		t.Fatalf("ActiveIPBans returned err: %v", err)
+	}
+	if len(active) != 2 || active[0].ID != bans[0].ID || active[1].ID != bans[1].ID {
+		t.Errorf("ActiveIPBans = %+v, want the bans of %q and %q", active, bans[0].IP, bans[1].IP)
+	}
+
+	if err := shim.RemoveIPBan(ctx, bans[0].ID); err != nil {
+		t.Fatalf("RemoveIPBan returned err: %v", err)
+	}
+	if err := shim.RemoveIPBan(ctx, bans[0].ID); err != sql.ErrNoRows {
+		t.Errorf("RemoveIPBan(removed) err = %v, want %v", err, sql.ErrNoRows)
+	}
+	active, err = shim.ActiveIPBans(ctx)
+	if err != nil {
+		t.Fatalf("ActiveIPBans returned err: %v", err)
+	}
+	if len(active) != 1 || active[0].ID != bans[1].ID {
+		t.Errorf("ActiveIPBans after remove = %+v, want the ban of %q", active, bans[1].IP)
+	}
+}
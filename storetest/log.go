@@ -0,0 +1,102 @@
+package storetest
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kusubooru/shimmie"
+)
+
+func testQueryLogs(t *testing.T, shim Store) {
+	ctx := context.Background()
+
+	var entries = []struct {
+		section  string
+		username string
+		address  string
+		priority int
+		message  string
+	}{
+		{"user", "bob", "10.0.0.1", 20, "bob logged in"},
+		{"user", "ann", "10.0.1.7", 20, "ann logged in"},
+		{"upload", "bob", "10.0.0.1", 20, "Uploaded image #1"},
+		{"admin", "zoe", "192.168.1.5", 40, "Banned 10.0.0.9: 100% spam_bot"},
+		{"upload", "ann", "2001:db8::1", 30, "Upload failed"},
+		{"user", "bob", "10.1.0.1", 50, "bob deleted user ann"},
+		{"upload", "zoe", "100.0.0.2", 20, "Uploaded image #2"},
+	}
+	for _, e := range entries {
+		if _, err := shim.Log(ctx, e.section, e.username, e.address, e.priority, e.message); err != nil {
+			t.Fatalf("Log(%q) returned err: %v", e.message, err)
+		}
+	}
+	hourAgo := time.Now().Add(-time.Hour)
+	hourLater := time.Now().Add(time.Hour)
+
+	var tests = []struct {
+		filter shimmie.LogFilter
+		want   []string
+	}{
+		{shimmie.LogFilter{Section: "upload"}, []string{"Uploaded image #2", "Upload failed", "Uploaded image #1"}},
+		{shimmie.LogFilter{Username: "bob", Section: "user"}, []string{"bob deleted user ann", "bob logged in"}},
+		{shimmie.LogFilter{Address: "10.0.0.1"}, []string{"Uploaded image #1", "bob logged in"}},
+		{shimmie.LogFilter{Address: "10.0.0.0/16"}, []string{"Uploaded image #1", "ann logged in", "bob logged in"}},
+		{shimmie.LogFilter{Address: "10.0.0.0/8"}, []string{"bob deleted user ann", "Uploaded image #1", "ann logged in", "bob logged in"}},
+		{shimmie.LogFilter{Address: "2001:db8::/32"}, []string{"Upload failed"}},
+		{shimmie.LogFilter{MinPriority: 30}, []string{"bob deleted user ann", "Upload failed", "Banned 10.0.0.9: 100% spam_bot"}},
+		{shimmie.LogFilter{Message: "UPLOAD"}, []string{"Uploaded image #2", "Upload failed", "Uploaded image #1"}},
+		{shimmie.LogFilter{Message: "100%"}, []string{"Banned 10.0.0.9: 100% spam_bot"}},
+		{shimmie.LogFilter{Message: "m_b"}, []string{"Banned 10.0.0.9: 100% spam_bot"}},
+		{shimmie.LogFilter{Message: "0%"}, []string{"Banned 10.0.0.9: 100% spam_bot"}},
+		{shimmie.LogFilter{Message: "d_u"}, nil},
+		{shimmie.LogFilter{After: &hourAgo, Before: &hourLater, Section: "admin"}, []string{"Banned 10.0.0.9: 100% spam_bot"}},
+		{shimmie.LogFilter{Before: &hourAgo}, nil},
+		{shimmie.LogFilter{After: &hourLater}, nil},
+	}
+	for _, tt := range tests {
+		logs, next, err := shim.QueryLogs(ctx, tt.filter, 0, "")
+		if err != nil {
+			t.Errorf("QueryLogs(%+v) returned err: %v", tt.filter, err)
+			continue
+		}
+		var got []string
+		for _, l := range logs {
+			got = append(got, l.Message)
+		}
+		if !reflect.DeepEqual(got, tt.want) || next != "" {
+			t.Errorf("QueryLogs(%+v) = %q, next %q, want %q", tt.filter, got, next, tt.want)
+		}
+	}
+
+	// Page through the CIDR matches one at a time.
+	var got []string
+	cursor := ""
+	for {
+		logs, next, err := shim.QueryLogs(ctx, shimmie.LogFilter{Address: "10.0.0.0/8"}, 1, cursor)
+		if err != nil {
+			t.Fatalf("QueryLogs(10.0.0.0/8, 1, %q) returned err: %v", cursor, err)
+		}
+		for _, l := range logs {
+			got = append(got, l.Message)
+			if l.DateSent == nil || l.Section == "" || l.Username == "" || l.Priority == 0 {
+				t.Errorf("QueryLogs returned incomplete entry %#v", l)
+			}
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if want := []string{"bob deleted user ann", "Uploaded image #1", "ann logged in", "bob logged in"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("paging QueryLogs(10.0.0.0/8) = %q, want %q", got, want)
+	}
+
+	if _, _, err := shim.QueryLogs(ctx, shimmie.LogFilter{Address: "10.0.0.0/99"}, 0, ""); err == nil {
+		t.Errorf("QueryLogs with invalid CIDR should return error")
+	}
+	if _, _, err := shim.QueryLogs(ctx, shimmie.LogFilter{}, 0, "%%%"); err != shimmie.ErrInvalidCursor {
+		t.Errorf("QueryLogs with invalid cursor returned err %v, want %v", err, shimmie.ErrInvalidCursor)
+	}
+}
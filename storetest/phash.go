@@ -0,0 +1,76 @@
+package storetest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/kusubooru/shimmie"
+)
+
+func testImagePHash(t *testing.T, shim Store) {
+	ctx := context.Background()
+
+	u := shimmie.User{Name: "bob", Pass: "bob123"}
+	if err := shim.CreateUser(ctx, &u); err != nil {
+		t.Fatalf("CreateUser(%#v) returned err: %v", u, err)
+	}
+	var ids []int64
+	for i := 0; i < 4; i++ {
+		id, err := shim.CreateImage(ctx, shimmie.Image{OwnerID: u.ID, Hash: fmt.Sprintf("%032d", i)})
+		if err != nil {
+			t.Fatalf("CreateImage returned err: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if _, err := shim.GetImagePHash(ctx, ids[0]); err != sql.ErrNoRows {
+		t.Errorf("GetImagePHash(no hash) err = %v, want %v", err, sql.ErrNoRows)
+	}
+
+	// The highest bit must survive signed integer columns.
+	phashes := []uint64{1<<63 | 5, 0xdeadbeef, 7}
+	for i, phash := range phashes {
+		if err := shim.SetImagePHash(ctx, ids[i], phash); err != nil {
+			t.Fatalf("SetImagePHash(%d, %x) returned err: %v", ids[i], phash, err)
+		}
+	}
+	if err := shim.SetImagePHash(ctx, ids[2], 8); err != nil {
+		t.Fatalf("SetImagePHash(replace) returned err: %v", err)
+	}
+	phashes[2] = 8
+	got, err := shim.GetImagePHash(ctx, ids[0])
+	if err != nil {
+		t.Fatalf("GetImagePHash returned err: %v", err)
+	}
+	if got != phashes[0] {
+		t.Errorf("GetImagePHash = %x, want %x", got, phashes[0])
+	}
+
+	var (
+		all    []shimmie.ImagePHash
+		cursor string
+		pages  int
+	)
+	for {
+		page, next, err := shim.ListImagePHashes(ctx, 2, cursor)
+		if err != nil {
+			t.Fatalf("ListImagePHashes returned err: %v", err)
+		}
+		all = append(all, page...)
+		pages++
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	var want []shimmie.ImagePHash
+	for i, phash := range phashes {
+		want = append(want, shimmie.ImagePHash{ImageID: ids[i], PHash: phash})
+	}
+	if !reflect.DeepEqual(all, want) || pages != 2 {
+		t.Errorf("ListImagePHashes = %v in %d pages, want %v in 2 pages", all, pages, want)
+	}
+}
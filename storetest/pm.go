@@ -0,0 +1,289 @@
+package storetest
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kusubooru/shimmie"
+)
+
+func testGetPMs(t *testing.T, shim Store) {
+	ctx := context.Background()
+
+	var users = []*shimmie.User{
+		&shimmie.User{Name: "bob", Pass: "bob123"},
+		&shimmie.User{Name: "ann", Pass: "ann123"},
+		&shimmie.User{Name: "zoe", Pass: "zoe123"},
+	}
+	for _, u := range users {
+		if err := shim.CreateUser(ctx, u); err != nil {
+			t.Fatalf("CreateUser(%q) returned err: %v", u, err)
+		}
+	}
+
+	var pms = []*shimmie.PM{
+		&shimmie.PM{FromID: 1, ToID: 2, Subject: "bob greets ann", SentDate: time.Now(), IsRead: true},
+		&shimmie.PM{FromID: 2, ToID: 1, Subject: "ann greets bob", SentDate: time.Now(), IsRead: true},
+		&shimmie.PM{FromID: 2, ToID: 3, Subject: "ann greets zoe", SentDate: time.Now(), IsRead: true},
+		&shimmie.PM{FromID: 1, ToID: 3, Subject: "bob greets zoe", SentDate: time.Now(), IsRead: true},
+
+		&shimmie.PM{FromID: 1, ToID: 2, Subject: "bob texts ann (Unread)", SentDate: time.Now()},
+		&shimmie.PM{FromID: 2, ToID: 1, Subject: "ann texts bob (Unread)", SentDate: time.Now()},
+		&shimmie.PM{FromID: 2, ToID: 3, Subject: "ann texts zoe (Unread)", SentDate: time.Now()},
+		&shimmie.PM{FromID: 1, ToID: 3, Subject: "bob texts zoe (Unread)", SentDate: time.Now()},
+	}
+	for _, pm := range pms {
+		if err := shim.CreatePM(ctx, pm); err != nil {
+			t.Fatalf("error creating pm %#v: %v", pm, err)
+		}
+	}
+
+	var tests = []struct {
+		from string
+		to   string
+		r    shimmie.PMChoice
+		want int
+	}{
+		{want: 8},
+		{want: 4, r: shimmie.PMRead},
+		{want: 4, r: shimmie.PMUnread},
+
+		{from: "bob", to: "ann", want: 1, r: shimmie.PMRead},
+		{from: "ann", to: "bob", want: 1, r: shimmie.PMRead},
+		{from: "bob", want: 2, r: shimmie.PMRead},
+		{from: "ann", want: 2, r: shimmie.PMRead},
+		{to: "zoe", want: 2, r: shimmie.PMRead},
+
+		{from: "bob", to: "ann", want: 2, r: shimmie.PMAny},
+	}
+
+	for i, tt := range tests {
+		pms, err := shim.GetPMs(ctx, tt.from, tt.to, tt.r)
+		if err != nil {
+			t.Fatalf("%d: getting pms from %q, to %q, choice %d returned err: %v", i, tt.from, tt.to, tt.r, err)
+		}
+		if got, want := len(pms), tt.want; got != want {
+			t.Errorf("%d: getting pms from %q, to %q, choice %d -> len(pms) = %d, want %d", i, tt.from, tt.to, tt.r, got, want)
+			data, _ := json.Marshal(pms)
+			t.Logf("pms: %s", data)
+		}
+	}
+}
+
+func testCreatePM(t *testing.T, shim Store) {
+	ctx := context.Background()
+
+	err := shim.CreatePM(ctx, nil)
+	if err == nil {
+		t.Errorf("creating nil PM should return error")
+	}
+}
+
+func testPMThread(t *testing.T, shim Store) {
+	ctx := context.Background()
+
+	var users = []*shimmie.User{
+		{Name: "bob", Pass: "bob123"},
+		{Name: "ann", Pass: "ann123"},
+		{Name: "zoe", Pass: "zoe123"},
+	}
+	for _, u := range users {
+		if err := shim.CreateUser(ctx, u); err != nil {
+			t.Fatalf("CreateUser(%q) returned err: %v", u.Name, err)
+		}
+	}
+	bob, ann, zoe := users[0].ID, users[1].ID, users[2].ID
+
+	day := time.Date(2016, 8, 1, 0, 0, 0, 0, time.UTC)
+	first := &shimmie.PM{FromID: bob, ToID: ann, Subject: "hello", Message: "hi ann", SentDate: day}
+	if err := shim.CreatePM(ctx, first); err != nil {
+		t.Fatalf("CreatePM(%#v) returned err: %v", first, err)
+	}
+	if err := shim.CreatePM(ctx, &shimmie.PM{FromID: bob, ToID: zoe, Subject: "other", SentDate: day}); err != nil {
+		t.Fatalf("CreatePM returned err: %v", err)
+	}
+
+	// Ann and bob take turns replying to the previous message.
+	parent := first
+	for i := 1; i <= 4; i++ {
+		from := ann
+		if i%2 == 0 {
+			from = bob
+		}
+		reply := &shimmie.PM{FromID: from, Message: fmt.Sprintf("reply %d", i), SentDate: day.Add(time.Duration(i) * time.Hour)}
+		if err := shim.ReplyPM(ctx, parent.ID, reply); err != nil {
+			t.Fatalf("ReplyPM(%d, %#v) returned err: %v", parent.ID, reply, err)
+		}
+		if reply.ToID == from || reply.ParentID != parent.ID || reply.Subject != "Re: hello" {
+			t.Errorf("ReplyPM(%d) set ToID=%d ParentID=%d Subject=%q, want other side, %d and %q", parent.ID, reply.ToID, reply.ParentID, reply.Subject, parent.ID, "Re: hello")
+		}
+		parent = reply
+	}
+	if err := shim.ReplyPM(ctx, first.ID, &shimmie.PM{FromID: zoe, SentDate: day}); err != sql.ErrNoRows {
+		t.Errorf("ReplyPM by a user outside the conversation returned err %v, want %v", err, sql.ErrNoRows)
+	}
+
+	// Walk the thread two messages at a time, newest first.
+	var got []string
+	cursor := ""
+	for {
+		pms, next, err := shim.GetThread(ctx, ann, bob, 2, cursor)
+		if err != nil {
+			t.Fatalf("GetThread(ann, bob, 2, %q) returned err: %v", cursor, err)
+		}
+		for _, pm := range pms {
+			got = append(got, pm.Message)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	want := []string{"reply 4", "reply 3", "reply 2", "reply 1", "hi ann"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetThread(ann, bob) messages = %q, want %q", got, want)
+	}
+
+	// Only the recipient can mark a message as read.
+	if err := shim.MarkPMRead(ctx, first.ID, bob); err != sql.ErrNoRows {
+		t.Errorf("MarkPMRead by the sender returned err %v, want %v", err, sql.ErrNoRows)
+	}
+	for i := 0; i < 2; i++ {
+		if err := shim.MarkPMRead(ctx, first.ID, ann); err != nil {
+			t.Errorf("MarkPMRead(%d, ann) returned err: %v", first.ID, err)
+		}
+	}
+	pms, err := shim.GetPMs(ctx, "bob", "ann", shimmie.PMRead)
+	if err != nil {
+		t.Fatalf("GetPMs returned err: %v", err)
+	}
+	if len(pms) != 1 || pms[0].ID != first.ID {
+		t.Errorf("GetPMs(bob, ann, PMRead) = %#v, want only message %d", pms, first.ID)
+	}
+
+	// Deleting hides the message from one side only.
+	if err := shim.DeletePM(ctx, first.ID, ann); err != nil {
+		t.Fatalf("DeletePM(%d, ann) returned err: %v", first.ID, err)
+	}
+	if err := shim.DeletePM(ctx, first.ID, ann); err != sql.ErrNoRows {
+		t.Errorf("DeletePM twice returned err %v, want %v", err, sql.ErrNoRows)
+	}
+	if err := shim.DeletePM(ctx, first.ID, zoe); err != sql.ErrNoRows {
+		t.Errorf("DeletePM by a user outside the conversation returned err %v, want %v", err, sql.ErrNoRows)
+	}
+	if err := shim.MarkPMRead(ctx, first.ID, ann); err != sql.ErrNoRows {
+		t.Errorf("MarkPMRead of a deleted message returned err %v, want %v", err, sql.ErrNoRows)
+	}
+	annThread, _, err := shim.GetThread(ctx, ann, bob, 0, "")
+	if err != nil {
+		t.Fatalf("GetThread(ann, bob) returned err: %v", err)
+	}
+	bobThread, _, err := shim.GetThread(ctx, bob, ann, 0, "")
+	if err != nil {
+		t.Fatalf("GetThread(bob, ann) returned err: %v", err)
+	}
+	if got, want := len(annThread), 4; got != want {
+		t.Errorf("GetThread(ann, bob) after delete returned %d messages, want %d", got, want)
+	}
+	if got, want := len(bobThread), 5; got != want {
+		t.Errorf("GetThread(bob, ann) after delete returned %d messages, want %d", got, want)
+	}
+	received, err := shim.GetPMs(ctx, "bob", "ann", shimmie.PMAny)
+	if err != nil {
+		t.Fatalf("GetPMs returned err: %v", err)
+	}
+	sent, err := shim.GetPMs(ctx, "bob", "", shimmie.PMAny)
+	if err != nil {
+		t.Fatalf("GetPMs returned err: %v", err)
+	}
+	if got, want := len(received), 2; got != want {
+		t.Errorf("GetPMs(bob, ann) after ann deleted a message returned %d messages, want %d", got, want)
+	}
+	if got, want := len(sent), 4; got != want {
+		t.Errorf("GetPMs(bob, \"\") after ann deleted a message returned %d messages, want %d", got, want)
+	}
+	if len(bobThread) != 0 {
+		if pm := bobThread[len(bobThread)-1]; pm.FromUser != "bob" || pm.ToUser != "ann" {
+			t.Errorf("GetThread(bob, ann) oldest message from %q to %q, want bob to ann", pm.FromUser, pm.ToUser)
+		}
+	}
+}
+
+func testPMInboxSummary(t *testing.T, shim Store) {
+	ctx := context.Background()
+
+	var users = []*shimmie.User{
+		{Name: "bob", Pass: "bob123"},
+		{Name: "ann", Pass: "ann123"},
+		{Name: "zoe", Pass: "zoe123"},
+	}
+	for _, u := range users {
+		if err := shim.CreateUser(ctx, u); err != nil {
+			t.Fatalf("CreateUser(%q) returned err: %v", u.Name, err)
+		}
+	}
+	bob, ann, zoe := users[0].ID, users[1].ID, users[2].ID
+
+	inbox, err := shim.PMInboxSummary(ctx, bob)
+	if err != nil {
+		t.Fatalf("PMInboxSummary(bob) on empty inbox returned err: %v", err)
+	}
+	if inbox.Total != 0 || inbox.Unread != 0 || len(inbox.Senders) != 0 {
+		t.Errorf("PMInboxSummary(bob) on empty inbox = %#v, want empty", inbox)
+	}
+
+	day := time.Date(2016, 8, 1, 0, 0, 0, 0, time.UTC)
+	var pms = []*shimmie.PM{
+		{FromID: ann, ToID: bob, Subject: "ann 1", Message: "first", SentDate: day, IsRead: true},
+		{FromID: ann, ToID: bob, Subject: "ann 2", Message: "second", SentDate: day.Add(1 * time.Hour)},
+		{FromID: zoe, ToID: bob, Subject: "zoe 1", Message: "zoe  says\nhi", SentDate: day.Add(2 * time.Hour)},
+		{FromID: zoe, ToID: bob, Subject: "zoe 2", Message: "deleted", SentDate: day.Add(3 * time.Hour)},
+		{FromID: ann, ToID: bob, Subject: "ann 3", Message: "third", SentDate: day.Add(4 * time.Hour)},
+		{FromID: bob, ToID: ann, Subject: "sent by bob", SentDate: day.Add(5 * time.Hour)},
+	}
+	for _, pm := range pms {
+		if err := shim.CreatePM(ctx, pm); err != nil {
+			t.Fatalf("CreatePM(%#v) returned err: %v", pm, err)
+		}
+	}
+	if err := shim.DeletePM(ctx, pms[3].ID, bob); err != nil {
+		t.Fatalf("DeletePM(%d, bob) returned err: %v", pms[3].ID, err)
+	}
+
+	inbox, err = shim.PMInboxSummary(ctx, bob)
+	if err != nil {
+		t.Fatalf("PMInboxSummary(bob) returned err: %v", err)
+	}
+	if got, want := inbox.Total, 4; got != want {
+		t.Errorf("PMInboxSummary(bob).Total = %d, want %d", got, want)
+	}
+	if got, want := inbox.Unread, 3; got != want {
+		t.Errorf("PMInboxSummary(bob).Unread = %d, want %d", got, want)
+	}
+	if got, want := len(inbox.Senders), 2; got != want {
+		t.Fatalf("PMInboxSummary(bob) returned %d senders, want %d: %#v", got, want, inbox.Senders)
+	}
+	var tests = []struct {
+		from    string
+		total   int
+		unread  int
+		latest  int64
+		subject string
+		preview string
+	}{
+		{"ann", 3, 2, pms[4].ID, "ann 3", "third"},
+		{"zoe", 1, 1, pms[2].ID, "zoe 1", "zoe says hi"},
+	}
+	for i, tt := range tests {
+		s := inbox.Senders[i]
+		if s.FromUser != tt.from || s.Total != tt.total || s.Unread != tt.unread || s.LatestID != tt.latest || s.Subject != tt.subject || s.Preview != tt.preview {
+			t.Errorf("PMInboxSummary(bob) sender %d = %#v, want from %q total %d unread %d latest %d subject %q preview %q",
+				i, s, tt.from, tt.total, tt.unread, tt.latest, tt.subject, tt.preview)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package storetest
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kusubooru/shimmie"
+)
+
+func testSendPM(t *testing.T, shim Store) {
+	ctx := context.Background()
+
+	var users = []*shimmie.User{
+		{Name: "bob", Pass: "bob123"},
+		{Name: "ann", Pass: "ann123"},
+		{Name: "zoe", Pass: "zoe123"},
+	}
+	for _, u := range users {
+		if err := shim.CreateUser(ctx, u); err != nil {
+			t.Fatalf("CreateUser(%q) returned err: %v", u.Name, err)
+		}
+	}
+	bob, ann, zoe := users[0].ID, users[1].ID, users[2].ID
+
+	if err := shim.SendPM(ctx, nil); err == nil {
+		t.Errorf("SendPM(nil) should return error")
+	}
+
+	// Content limits.
+	var tests = []struct {
+		pm  shimmie.PM
+		err error
+	}{
+		{shimmie.PM{FromID: bob, ToID: ann, Subject: strings.Repeat("a", 65)}, shimmie.ErrPMSubjectTooLong},
+		{shimmie.PM{FromID: bob, ToID: ann, Message: strings.Repeat("a", shimmie.MaxPMMessageLength+1)}, shimmie.ErrPMMessageTooLong},
+	}
+	for _, tt := range tests {
+		pm := tt.pm
+		if err := shim.SendPM(ctx, &pm); err != tt.err {
+			t.Errorf("SendPM(%.20q) returned err %v, want %v", pm.Subject+pm.Message, err, tt.err)
+		}
+	}
+
+	// Messages with many links are delivered but flagged for review.
+	spam := &shimmie.PM{FromID: zoe, ToID: bob, Subject: "deals", Message: "www.a.com www.b.com www.c.com www.d.com"}
+	if err := shim.SendPM(ctx, spam); err != nil {
+		t.Fatalf("SendPM(spam) returned err: %v", err)
+	}
+	if !spam.Flagged || spam.SentDate.IsZero() {
+		t.Errorf("SendPM(spam) set Flagged=%t SentDate=%v, want flagged with a sent date", spam.Flagged, spam.SentDate)
+	}
+	ham := &shimmie.PM{FromID: ann, ToID: bob, Subject: "hi", Message: "see www.a.com"}
+	if err := shim.SendPM(ctx, ham); err != nil {
+		t.Fatalf("SendPM(ham) returned err: %v", err)
+	}
+	flagged, next, err := shim.ListFlaggedPMs(ctx, 0, "")
+	if err != nil {
+		t.Fatalf("ListFlaggedPMs returned err: %v", err)
+	}
+	if len(flagged) != 1 || flagged[0].ID != spam.ID || !flagged[0].Flagged || flagged[0].FromUser != "zoe" || next != "" {
+		t.Errorf("ListFlaggedPMs = %#v, %q, want only message %d from zoe", flagged, next, spam.ID)
+	}
+	if err := shim.UnflagPM(ctx, spam.ID); err != nil {
+		t.Errorf("UnflagPM(%d) returned err: %v", spam.ID, err)
+	}
+	if err := shim.UnflagPM(ctx, 9999); err != sql.ErrNoRows {
+		t.Errorf("UnflagPM(9999) returned err %v, want %v", err, sql.ErrNoRows)
+	}
+	if flagged, _, err = shim.ListFlaggedPMs(ctx, 0, ""); err != nil || len(flagged) != 0 {
+		t.Errorf("ListFlaggedPMs after UnflagPM = %#v, %v, want none", flagged, err)
+	}
+
+	// Blocked senders cannot reach the recipient.
+	for i := 0; i < 2; i++ {
+		if err := shim.BlockPMSender(ctx, bob, zoe); err != nil {
+			t.Fatalf("BlockPMSender(bob, zoe) returned err: %v", err)
+		}
+	}
+	blocks, err := shim.GetPMBlocks(ctx, bob)
+	if err != nil {
+		t.Fatalf("GetPMBlocks(bob) returned err: %v", err)
+	}
+	if want := []int64{zoe}; !reflect.DeepEqual(blocks, want) {
+		t.Errorf("GetPMBlocks(bob) = %v, want %v", blocks, want)
+	}
+	if err := shim.SendPM(ctx, &shimmie.PM{FromID: zoe, ToID: bob, Subject: "hey"}); err != shimmie.ErrPMBlocked {
+		t.Errorf("SendPM from blocked sender returned err %v, want %v", err, shimmie.ErrPMBlocked)
+	}
+	if err := shim.SendPM(ctx, &shimmie.PM{FromID: bob, ToID: zoe, Subject: "hey"}); err != nil {
+		t.Errorf("SendPM to a blocked user returned err: %v", err)
+	}
+	if err := shim.UnblockPMSender(ctx, bob, zoe); err != nil {
+		t.Fatalf("UnblockPMSender(bob, zoe) returned err: %v", err)
+	}
+	if err := shim.SendPM(ctx, &shimmie.PM{FromID: zoe, ToID: bob, Subject: "hey"}); err != nil {
+		t.Errorf("SendPM after unblock returned err: %v", err)
+	}
+	if blocks, err = shim.GetPMBlocks(ctx, bob); err != nil || len(blocks) != 0 {
+		t.Errorf("GetPMBlocks(bob) after unblock = %v, %v, want none", blocks, err)
+	}
+}
+
+func testPMRateLimit(t *testing.T, shim Store) {
+	ctx := context.Background()
+
+	var users = []*shimmie.User{
+		{Name: "bob", Pass: "bob123"},
+		{Name: "ann", Pass: "ann123"},
+	}
+	for _, u := range users {
+		if err := shim.CreateUser(ctx, u); err != nil {
+			t.Fatalf("CreateUser(%q) returned err: %v", u.Name, err)
+		}
+	}
+	bob, ann := users[0].ID, users[1].ID
+
+	limit, err := shim.GetPMRateLimit(ctx, bob)
+	if err != nil {
+		t.Fatalf("GetPMRateLimit(bob) returned err: %v", err)
+	}
+	if limit != shimmie.DefaultPMRateLimit {
+		t.Errorf("GetPMRateLimit(bob) = %v, want default %v", limit, shimmie.DefaultPMRateLimit)
+	}
+
+	want := shimmie.PMRateLimit{Messages: 2, Period: time.Hour}
+	for i := 0; i < 2; i++ {
+		if err := shim.SetPMRateLimit(ctx, bob, want); err != nil {
+			t.Fatalf("SetPMRateLimit(bob, %v) returned err: %v", want, err)
+		}
+	}
+	if limit, err = shim.GetPMRateLimit(ctx, bob); err != nil || limit != want {
+		t.Errorf("GetPMRateLimit(bob) = %v, %v, want %v", limit, err, want)
+	}
+
+	// Messages sent before the period do not count.
+	old := &shimmie.PM{FromID: bob, ToID: ann, Subject: "old", SentDate: time.Now().Add(-2 * time.Hour)}
+	if err := shim.CreatePM(ctx, old); err != nil {
+		t.Fatalf("CreatePM(old) returned err: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := shim.SendPM(ctx, &shimmie.PM{FromID: bob, ToID: ann, Subject: "hi"}); err != nil {
+			t.Fatalf("SendPM %d within limit returned err: %v", i, err)
+		}
+	}
+	if err := shim.SendPM(ctx, &shimmie.PM{FromID: bob, ToID: ann, Subject: "hi"}); err != shimmie.ErrPMRateLimited {
+		t.Errorf("SendPM above limit returned err %v, want %v", err, shimmie.ErrPMRateLimited)
+	}
+	backdated := &shimmie.PM{FromID: bob, ToID: ann, Subject: "hi", SentDate: time.Now().Add(-2 * time.Hour)}
+	if err := shim.SendPM(ctx, backdated); err != shimmie.ErrPMRateLimited {
+		t.Errorf("SendPM above limit with a past SentDate returned err %v, want %v", err, shimmie.ErrPMRateLimited)
+	}
+	if time.Since(backdated.SentDate) > time.Minute {
+		t.Errorf("SendPM kept SentDate %v, want the current time", backdated.SentDate)
+	}
+	if err := shim.ReplyPM(ctx, old.ID, &shimmie.PM{FromID: bob}); err != shimmie.ErrPMRateLimited {
+		t.Errorf("ReplyPM above limit returned err %v, want %v", err, shimmie.ErrPMRateLimited)
+	}
+	if err := shim.SendPM(ctx, &shimmie.PM{FromID: ann, ToID: bob, Subject: "hi"}); err != nil {
+		t.Errorf("SendPM by another sender returned err: %v", err)
+	}
+
+	// A zero limit means no limit.
+	if err := shim.SetPMRateLimit(ctx, bob, shimmie.PMRateLimit{}); err != nil {
+		t.Fatalf("SetPMRateLimit(bob, no limit) returned err: %v", err)
+	}
+	if err := shim.SendPM(ctx, &shimmie.PM{FromID: bob, ToID: ann, Subject: "hi"}); err != nil {
+		t.Errorf("SendPM without limit returned err: %v", err)
+	}
+
+	// Messages sent at the same time cannot exceed the limit together.
+	if err := shim.SetPMRateLimit(ctx, ann, want); err != nil {
+		t.Fatalf("SetPMRateLimit(ann, %v) returned err: %v", want, err)
+	}
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		sent int
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := shim.SendPM(ctx, &shimmie.PM{FromID: ann, ToID: bob, Subject: "hi"})
+			if err != nil && err != shimmie.ErrPMRateLimited {
+				t.Errorf("concurrent SendPM returned err: %v", err)
+			}
+			if err == nil {
+				mu.Lock()
+				sent++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	// ann has already sent one message within the period.
+	if sent != want.Messages-1 {
+		t.Errorf("%d concurrent messages were sent, want %d", sent, want.Messages-1)
+	}
+}
@@ -0,0 +1,271 @@
+package storetest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/kusubooru/shimmie"
+)
+
+func testPool(t *testing.T, shim Store) {
+	ctx := context.Background()
+
+	u := shimmie.User{Name: "bob"}
+	if err := shim.CreateUser(ctx, &u); err != nil {
+		t.Fatalf("CreateUser(%#v) returned err: %v", u, err)
+	}
+	var pools []shimmie.Pool
+	for i := 0; i < 3; i++ {
+		p := shimmie.Pool{UserID: u.ID, Title: fmt.Sprintf(" Comic %d ", i), Description: "pages", Public: i == 0}
+		if err := shim.CreatePool(ctx, &p); err != nil {
+			t.Fatalf("CreatePool(%q) returned err: %v", p.Title, err)
+		}
+		if p.ID == 0 || p.Date.IsZero() || p.Title != fmt.Sprintf("Comic %d", i) {
+			t.Errorf("CreatePool did not set the ID, Date and trimmed Title: %+v", p)
+		}
+		pools = append(pools, p)
+	}
+	for _, tt := range []struct {
+		title string
+		err   error
+	}{
+		{"comic 0", shimmie.ErrPoolTitleTaken},
+		{"  ", shimmie.ErrPoolTitleEmpty},
+	} {
+		if err := shim.CreatePool(ctx, &shimmie.Pool{UserID: u.ID, Title: tt.title}); err != tt.err {
+			t.Errorf("CreatePool(%q) err = %v, want %v", tt.title, err, tt.err)
+		}
+	}
+
+	got, err := shim.GetPool(ctx, pools[0].ID)
+	if err != nil {
+		t.Fatalf("GetPool returned err: %v", err)
+	}
+	if got.Title != "Comic 0" || got.Description != "pages" || !got.Public || got.UserID != u.ID || got.UserName != "bob" || got.Posts != 0 {
+		t.Errorf("GetPool = %+v, want public Comic 0 by bob", got)
+	}
+	if _, err := shim.GetPool(ctx, 999); err != sql.ErrNoRows {
+		t.Errorf("GetPool(missing) err = %v, want %v", err, sql.ErrNoRows)
+	}
+
+	edit := shimmie.Pool{ID: pools[0].ID, Title: "Comic 0", Description: "all pages"}
+	if err := shim.UpdatePool(ctx, &edit); err != nil {
+		t.Fatalf("UpdatePool returned err: %v", err)
+	}
+	got, err = shim.GetPool(ctx, pools[0].ID)
+	if err != nil {
+		t.Fatalf("GetPool returned err: %v", err)
+	}
+	if got.Description != "all pages" || got.Public || got.UserID != u.ID {
+		t.Errorf("GetPool after update = %+v, want private with new description", got)
+	}
+	if err := shim.UpdatePool(ctx, &shimmie.Pool{ID: pools[0].ID, Title: "COMIC 1"}); err != shimmie.ErrPoolTitleTaken {
+		t.Errorf("UpdatePool(taken title) err = %v, want %v", err, shimmie.ErrPoolTitleTaken)
+	}
+	if err := shim.UpdatePool(ctx, &shimmie.Pool{ID: 999, Title: "Other"}); err != sql.ErrNoRows {
+		t.Errorf("UpdatePool(missing) err = %v, want %v", err, sql.ErrNoRows)
+	}
+
+	var (
+		all    []shimmie.Pool
+		cursor string
+	)
+	for {
+		page, next, err := shim.ListPools(ctx, 2, cursor)
+		if err != nil {
+			t.Fatalf("ListPools returned err: %v", err)
+		}
+		all = append(all, page...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if len(all) != 3 || all[0].ID != pools[2].ID || all[2].ID != pools[0].ID {
+		t.Errorf("ListPools = %+v, want the 3 pools newest first", all)
+	}
+
+	if err := shim.DeletePool(ctx, pools[1].ID); err != nil {
+		t.Fatalf("DeletePool returned err: %v", err)
+	}
+	if err := shim.DeletePool(ctx, pools[1].ID); err != sql.ErrNoRows {
+		t.Errorf("DeletePool(deleted) err = %v, want %v", err, sql.ErrNoRows)
+	}
+	if _, err := shim.GetPool(ctx, pools[1].ID); err != sql.ErrNoRows {
+		t.Errorf("GetPool(deleted) err = %v, want %v", err, sql.ErrNoRows)
+	}
+	// The title of a deleted pool can be used again.
+	if err := shim.CreatePool(ctx, &shimmie.Pool{UserID: u.ID, Title: "Comic 1"}); err != nil {
+		t.Errorf("CreatePool(title of deleted pool) returned err: %v", err)
+	}
+}
+
+func testPoolImages(t *testing.T, shim Store) {
+	ctx := context.Background()
+
+	u := shimmie.User{Name: "bob"}
+	if err := shim.CreateUser(ctx, &u); err != nil {
+		t.Fatalf("CreateUser(%#v) returned err: %v", u, err)
+	}
+	var ids []int64
+	for i := 0; i < 5; i++ {
+		id, err := shim.CreateImage(ctx, shimmie.Image{OwnerID: u.ID, Hash: fmt.Sprintf("%032d", i)})
+		if err != nil {
+			t.Fatalf("CreateImage returned err: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	p := shimmie.Pool{UserID: u.ID, Title: "Comic"}
+	if err := shim.CreatePool(ctx, &p); err != nil {
+		t.Fatalf("CreatePool returned err: %v", err)
+	}
+	other := shimmie.Pool{UserID: u.ID, Title: "Other"}
+	if err := shim.CreatePool(ctx, &other); err != nil {
+		t.Fatalf("CreatePool returned err: %v", err)
+	}
+	poolImages := func(poolID int64) string {
+		t.Helper()
+		images, err := shim.GetPoolImages(ctx, poolID)
+		if err != nil {
+			t.Fatalf("GetPoolImages(%d) returned err: %v", poolID, err)
+		}
+		var got []int64
+		for _, img := range images {
+			got = append(got, img.ID)
+		}
+		return fmt.Sprint(got)
+	}
+	posts := func(poolID int64) int {
+		t.Helper()
+		p, err := shim.GetPool(ctx, poolID)
+		if err != nil {
+			t.Fatalf("GetPool(%d) returned err: %v", poolID, err)
+		}
+		return p.Posts
+	}
+
+	if err := shim.AddPoolImages(ctx, p.ID, u.ID, []int64{ids[0], ids[1], ids[2]}); err != nil {
+		t.Fatalf("AddPoolImages returned err: %v", err)
+	}
+	// Images already in the pool are skipped.
+	if err := shim.AddPoolImages(ctx, p.ID, u.ID, []int64{ids[1], ids[3], ids[4]}); err != nil {
+		t.Fatalf("AddPoolImages returned err: %v", err)
+	}
+	if err := shim.AddPoolImages(ctx, p.ID, u.ID, []int64{999}); err != sql.ErrNoRows {
+		t.Errorf("AddPoolImages(missing image) err = %v, want %v", err, sql.ErrNoRows)
+	}
+	if err := shim.AddPoolImages(ctx, 999, u.ID, []int64{ids[0]}); err != sql.ErrNoRows {
+		t.Errorf("AddPoolImages(missing pool) err = %v, want %v", err, sql.ErrNoRows)
+	}
+	if err := shim.AddPoolImages(ctx, other.ID, u.ID, []int64{ids[2]}); err != nil {
+		t.Fatalf("AddPoolImages returned err: %v", err)
+	}
+	if got, want := poolImages(p.ID), fmt.Sprint(ids); got != want {
+		t.Errorf("GetPoolImages = %v, want %v", got, want)
+	}
+	if got := posts(p.ID); got != 5 {
+		t.Errorf("pool has %d posts, want 5", got)
+	}
+
+	if err := shim.RemovePoolImages(ctx, p.ID, u.ID, []int64{ids[1], 999}); err != nil {
+		t.Fatalf("RemovePoolImages returned err: %v", err)
+	}
+	if err := shim.SetPoolOrder(ctx, p.ID, []int64{ids[4], ids[2]}); err != nil {
+		t.Fatalf("SetPoolOrder returned err: %v", err)
+	}
+	if err := shim.SetPoolOrder(ctx, p.ID, []int64{ids[1]}); err != sql.ErrNoRows {
+		t.Errorf("SetPoolOrder(image not in pool) err = %v, want %v", err, sql.ErrNoRows)
+	}
+	order := []int64{ids[4], ids[2], ids[0], ids[3]}
+	if got, want := poolImages(p.ID), fmt.Sprint(order); got != want {
+		t.Errorf("GetPoolImages after reorder = %v, want %v", got, want)
+	}
+	if got := posts(p.ID); got != 4 {
+		t.Errorf("pool has %d posts, want 4", got)
+	}
+
+	for i, id := range order {
+		prev, next, err := shim.PoolNeighbors(ctx, p.ID, id)
+		if err != nil {
+			t.Fatalf("PoolNeighbors(%d) returned err: %v", id, err)
+		}
+		var wantPrev, wantNext int64
+		if i > 0 {
+			wantPrev = order[i-1]
+		}
+		if i < len(order)-1 {
+			wantNext = order[i+1]
+		}
+		if prev != wantPrev || next != wantNext {
+			t.Errorf("PoolNeighbors(%d) = %d, %d, want %d, %d", id, prev, next, wantPrev, wantNext)
+		}
+	}
+	if _, _, err := shim.PoolNeighbors(ctx, p.ID, ids[1]); err != sql.ErrNoRows {
+		t.Errorf("PoolNeighbors(image not in pool) err = %v, want %v", err, sql.ErrNoRows)
+	}
+
+	pools, err := shim.ImagePools(ctx, ids[2])
+	if err != nil {
+		t.Fatalf("ImagePools returned err: %v", err)
+	}
+	if len(pools) != 2 || pools[0].ID != p.ID || pools[1].ID != other.ID {
+		t.Errorf("ImagePools(%d) = %+v, want pools %d and %d", ids[2], pools, p.ID, other.ID)
+	}
+
+	history, _, err := shim.ListPoolHistory(ctx, p.ID, 0, "")
+	if err != nil {
+		t.Fatalf("ListPoolHistory returned err: %v", err)
+	}
+	want := []struct {
+		action shimmie.PoolAction
+		images string
+		count  int
+	}{
+		{shimmie.PoolRemove, fmt.Sprint(ids[1:2]), 4},
+		{shimmie.PoolAdd, fmt.Sprint(ids[3:]), 5},
+		{shimmie.PoolAdd, fmt.Sprint(ids[:3]), 3},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("ListPoolHistory returned %d entries, want %d", len(history), len(want))
+	}
+	for i, h := range history {
+		w := want[i]
+		if h.PoolID != p.ID || h.UserID != u.ID || h.UserName != "bob" || h.Action != w.action || fmt.Sprint(h.Images) != w.images || h.Count != w.count || h.Date.IsZero() {
+			t.Errorf("history %d = %+v, want action %d of %s with count %d by bob", i, h, w.action, w.images, w.count)
+		}
+	}
+	var (
+		all    []shimmie.PoolHistory
+		cursor string
+	)
+	for {
+		page, next, err := shim.ListPoolHistory(ctx, 0, 2, cursor)
+		if err != nil {
+			t.Fatalf("ListPoolHistory returned err: %v", err)
+		}
+		all = append(all, page...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if len(all) != 4 || all[1].PoolID != other.ID {
+		t.Errorf("ListPoolHistory(all pools) = %+v, want 4 entries with pool %d second", all, other.ID)
+	}
+
+	// Deleting an image removes it from its pools.
+	if _, err := shim.DeleteImage(ctx, ids[2], shimmie.ImageDeletion{}); err != nil {
+		t.Fatalf("DeleteImage returned err: %v", err)
+	}
+	if got, want := poolImages(p.ID), fmt.Sprint([]int64{ids[4], ids[0], ids[3]}); got != want {
+		t.Errorf("GetPoolImages after DeleteImage = %v, want %v", got, want)
+	}
+	if got := posts(p.ID); got != 3 {
+		t.Errorf("pool has %d posts after DeleteImage, want 3", got)
+	}
+	if got := posts(other.ID); got != 0 {
+		t.Errorf("other pool has %d posts after DeleteImage, want 0", got)
+	}
+}
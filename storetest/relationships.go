@@ -0,0 +1,146 @@
+package storetest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/kusubooru/shimmie"
+)
+
+func testRelationships(t *testing.T, shim Store) {
+	ctx := context.Background()
+
+	u := shimmie.User{Name: "bob"}
+	if err := shim.CreateUser(ctx, &u); err != nil {
+		t.Fatalf("CreateUser(%#v) returned err: %v", u, err)
+	}
+	var ids []int64
+	for i := 0; i < 5; i++ {
+		id, err := shim.CreateImage(ctx, shimmie.Image{OwnerID: u.ID, Hash: fmt.Sprintf("%032d", i)})
+		if err != nil {
+			t.Fatalf("CreateImage returned err: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	setParent := func(child, parent int64) {
+		t.Helper()
+		if err := shim.SetParent(ctx, child, parent, &u, "10.0.0.1"); err != nil {
+			t.Fatalf("SetParent(%d, %d) returned err: %v", child, parent, err)
+		}
+	}
+	checkFlags := func(want map[int64]shimmie.Image) {
+		t.Helper()
+		for id, w := range want {
+			img, err := shim.GetImage(ctx, int(id))
+			if err != nil {
+				t.Fatalf("GetImage(%d) returned err: %v", id, err)
+			}
+			if img.ParentID != w.ParentID || img.HasChildren != w.HasChildren {
+				t.Errorf("image %d has parent %d and children %v, want %d and %v", id, img.ParentID, img.HasChildren, w.ParentID, w.HasChildren)
+			}
+		}
+	}
+	familyIDs := func(id int64) []int64 {
+		t.Helper()
+		family, err := shim.GetFamily(ctx, id)
+		if err != nil {
+			t.Fatalf("GetFamily(%d) returned err: %v", id, err)
+		}
+		var got []int64
+		for _, img := range family {
+			got = append(got, img.ID)
+		}
+		return got
+	}
+
+	// 0 is the parent of 1 and 2, and 1 is the parent of 3.
+	setParent(ids[1], ids[0])
+	setParent(ids[2], ids[0])
+	setParent(ids[3], ids[1])
+	checkFlags(map[int64]shimmie.Image{
+		ids[0]: {HasChildren: true},
+		ids[1]: {ParentID: ids[0], HasChildren: true},
+		ids[2]: {ParentID: ids[0]},
+		ids[3]: {ParentID: ids[1]},
+		ids[4]: {},
+	})
+
+	children, err := shim.GetChildren(ctx, ids[0])
+	if err != nil {
+		t.Fatalf("GetChildren returned err: %v", err)
+	}
+	if len(children) != 2 || children[0].ID != ids[1] || children[1].ID != ids[2] {
+		t.Errorf("GetChildren(%d) = %+v, want images %d and %d", ids[0], children, ids[1], ids[2])
+	}
+	want := fmt.Sprint(ids[:4])
+	for _, id := range ids[:4] {
+		if got := fmt.Sprint(familyIDs(id)); got != want {
+			t.Errorf("GetFamily(%d) = %v, want %v", id, got, want)
+		}
+	}
+	if got, want := fmt.Sprint(familyIDs(ids[4])), fmt.Sprint(ids[4:]); got != want {
+		t.Errorf("GetFamily(%d) = %v, want %v", ids[4], got, want)
+	}
+	if _, err := shim.GetFamily(ctx, 999); err != sql.ErrNoRows {
+		t.Errorf("GetFamily(missing) err = %v, want %v", err, sql.ErrNoRows)
+	}
+
+	for _, tt := range []struct {
+		child, parent int64
+		err           error
+	}{
+		{ids[0], ids[0], shimmie.ErrParentCycle},
+		{ids[0], ids[3], shimmie.ErrParentCycle},
+		{ids[0], 999, sql.ErrNoRows},
+		{999, ids[0], sql.ErrNoRows},
+	} {
+		if err := shim.SetParent(ctx, tt.child, tt.parent, &u, ""); err != tt.err {
+			t.Errorf("SetParent(%d, %d) err = %v, want %v", tt.child, tt.parent, err, tt.err)
+		}
+	}
+
+	// Moving 3 to 4 leaves 1 without children.
+	setParent(ids[3], ids[4])
+	if err := shim.RemoveParent(ctx, ids[2], &u, "10.0.0.1"); err != nil {
+		t.Fatalf("RemoveParent returned err: %v", err)
+	}
+	if err := shim.RemoveParent(ctx, ids[2], &u, "10.0.0.1"); err != nil {
+		t.Errorf("RemoveParent(no parent) returned err: %v", err)
+	}
+	if err := shim.RemoveParent(ctx, 999, &u, ""); err != sql.ErrNoRows {
+		t.Errorf("RemoveParent(missing) err = %v, want %v", err, sql.ErrNoRows)
+	}
+	checkFlags(map[int64]shimmie.Image{
+		ids[0]: {HasChildren: true},
+		ids[1]: {ParentID: ids[0]},
+		ids[2]: {},
+		ids[3]: {ParentID: ids[4]},
+		ids[4]: {HasChildren: true},
+	})
+
+	// Deleting a parent detaches its children and deleting the only child
+	// clears the flag of its parent.
+	if _, err := shim.DeleteImage(ctx, ids[4], shimmie.ImageDeletion{}); err != nil {
+		t.Fatalf("DeleteImage returned err: %v", err)
+	}
+	if _, err := shim.DeleteImage(ctx, ids[1], shimmie.ImageDeletion{}); err != nil {
+		t.Fatalf("DeleteImage returned err: %v", err)
+	}
+	checkFlags(map[int64]shimmie.Image{
+		ids[0]: {},
+		ids[3]: {},
+	})
+
+	logs, _, err := shim.QueryLogs(ctx, shimmie.LogFilter{Section: "relationships"}, 0, "")
+	if err != nil {
+		t.Fatalf("QueryLogs returned err: %v", err)
+	}
+	if len(logs) != 5 {
+		t.Fatalf("QueryLogs(relationships) returned %d logs, want 5", len(logs))
+	}
+	if got, want := logs[0].Message, shimmie.RemoveParentLogMessage(ids[2], ids[0]); got != want || logs[0].Username != "bob" {
+		t.Errorf("last relationships log = %q by %q, want %q by bob", got, logs[0].Username, want)
+	}
+}
@@ -0,0 +1,172 @@
+package storetest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kusubooru/shimmie"
+)
+
+func testVote(t *testing.T, shim Store) {
+	ctx := context.Background()
+
+	var users []shimmie.User
+	for i := 0; i < 3; i++ {
+		u := shimmie.User{Name: fmt.Sprintf("user%d", i)}
+		if err := shim.CreateUser(ctx, &u); err != nil {
+			t.Fatalf("CreateUser(%#v) returned err: %v", u, err)
+		}
+		users = append(users, u)
+	}
+	id, err := shim.CreateImage(ctx, shimmie.Image{OwnerID: users[0].ID, Hash: fmt.Sprintf("%032d", 0)})
+	if err != nil {
+		t.Fatalf("CreateImage returned err: %v", err)
+	}
+	vote := func(u shimmie.User, score int) {
+		t.Helper()
+		if err := shim.Vote(ctx, u.ID, id, score); err != nil {
+			t.Fatalf("Vote(%s, %d) returned err: %v", u.Name, score, err)
+		}
+	}
+	checkScore := func(want int) {
+		t.Helper()
+		img, err := shim.GetImage(ctx, int(id))
+		if err != nil {
+			t.Fatalf("GetImage returned err: %v", err)
+		}
+		if img.NumericScore != want {
+			t.Errorf("image has numeric score %d, want %d", img.NumericScore, want)
+		}
+	}
+
+	vote(users[0], 1)
+	vote(users[1], 1)
+	vote(users[2], -1)
+	checkScore(1)
+	// Voting again replaces the vote.
+	vote(users[2], 1)
+	checkScore(3)
+	vote(users[1], 0)
+	checkScore(2)
+
+	for _, tt := range []struct {
+		user int64
+		want int
+	}{
+		{users[0].ID, 1},
+		{users[1].ID, 0},
+		{999, 0},
+	} {
+		got, err := shim.GetVote(ctx, tt.user, id)
+		if err != nil {
+			t.Fatalf("GetVote returned err: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("GetVote(%d) = %d, want %d", tt.user, got, tt.want)
+		}
+	}
+
+	if err := shim.Vote(ctx, users[0].ID, id, 2); err != shimmie.ErrInvalidVote {
+		t.Errorf("Vote(2) err = %v, want %v", err, shimmie.ErrInvalidVote)
+	}
+	if err := shim.Vote(ctx, users[0].ID, 999, 1); err != sql.ErrNoRows {
+		t.Errorf("Vote(missing image) err = %v, want %v", err, sql.ErrNoRows)
+	}
+	if err := shim.Vote(ctx, 999, id, 1); err != sql.ErrNoRows {
+		t.Errorf("Vote(missing user) err = %v, want %v", err, sql.ErrNoRows)
+	}
+
+	// Deleting a user removes their votes.
+	if err := shim.DeleteUser(ctx, users[2].ID); err != nil {
+		t.Fatalf("DeleteUser returned err: %v", err)
+	}
+	checkScore(1)
+
+	// Votes of different users at the same time are all counted.
+	var voters []shimmie.User
+	for i := 0; i < 8; i++ {
+		u := shimmie.User{Name: fmt.Sprintf("voter%d", i)}
+		if err := shim.CreateUser(ctx, &u); err != nil {
+			t.Fatalf("CreateUser(%#v) returned err: %v", u, err)
+		}
+		voters = append(voters, u)
+	}
+	var wg sync.WaitGroup
+	want := 0
+	for i, u := range append(voters, users[0]) {
+		score := 1
+		if i%3 == 2 {
+			score = -1
+		}
+		want += score
+		wg.Add(1)
+		go func(u shimmie.User, score int) {
+			defer wg.Done()
+			if err := shim.Vote(ctx, u.ID, id, score); err != nil {
+				t.Errorf("concurrent Vote(%s, %d) returned err: %v", u.Name, score, err)
+			}
+		}(u, score)
+	}
+	wg.Wait()
+	checkScore(want)
+}
+
+func testTopImages(t *testing.T, shim Store) {
+	ctx := context.Background()
+
+	var users []shimmie.User
+	for i := 0; i < 3; i++ {
+		u := shimmie.User{Name: fmt.Sprintf("user%d", i)}
+		if err := shim.CreateUser(ctx, &u); err != nil {
+			t.Fatalf("CreateUser(%#v) returned err: %v", u, err)
+		}
+		users = append(users, u)
+	}
+	now := time.Now()
+	old := now.Add(-60 * 24 * time.Hour)
+	// The scores of the images are 3, 2, 1, -1 and 3 for the old one.
+	var ids []int64
+	for i, score := range []int{3, 2, 1, -1, 3} {
+		posted := now
+		if i == 4 {
+			posted = old
+		}
+		id, err := shim.CreateImage(ctx, shimmie.Image{OwnerID: users[0].ID, Hash: fmt.Sprintf("%032d", i), Posted: &posted})
+		if err != nil {
+			t.Fatalf("CreateImage returned err: %v", err)
+		}
+		ids = append(ids, id)
+		v := 1
+		if score < 0 {
+			v, score = -1, 1
+		}
+		for _, u := range users[:score] {
+			if err := shim.Vote(ctx, u.ID, id, v); err != nil {
+				t.Fatalf("Vote returned err: %v", err)
+			}
+		}
+	}
+	top := func(since time.Time, limit int) string {
+		t.Helper()
+		images, err := shim.TopImages(ctx, since, limit)
+		if err != nil {
+			t.Fatalf("TopImages returned err: %v", err)
+		}
+		var got []int64
+		for _, img := range images {
+			got = append(got, img.ID)
+		}
+		return fmt.Sprint(got)
+	}
+
+	if got, want := top(time.Time{}, 0), fmt.Sprint([]int64{ids[4], ids[0], ids[1], ids[2]}); got != want {
+		t.Errorf("TopImages(all time) = %v, want %v", got, want)
+	}
+	if got, want := top(now.Add(-time.Hour), 2), fmt.Sprint([]int64{ids[0], ids[1]}); got != want {
+		t.Errorf("TopImages(recent, 2) = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,93 @@
+// Package storetest provides a conformance test suite for implementations of
+// the shimmie stores.
+//
+// Every backend, like the MySQL shimmiedb.DB or the in-memory
+// shimmietest.Store, is expected to pass the same suite:
+//
+//	func TestStore(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) storetest.Store {
+//			return shimmietest.New()
+//		})
+//	}
+package storetest
+
+import (
+	"testing"
+
+	"github.com/kusubooru/shimmie"
+)
+
+// Store is the set of stores that a backend must implement to be validated by
+// the suite.
+type Store interface {
+	shimmie.UserStore
+	shimmie.ImageStore
+	shimmie.RelationshipStore
+	shimmie.FavoriteStore
+	shimmie.ScoreStore
+	shimmie.PHashStore
+	shimmie.HashBanStore
+	shimmie.IPBanStore
+	shimmie.PoolStore
+	shimmie.TagStore
+	shimmie.TagHistoryStore
+	shimmie.AliasStore
+	shimmie.PMStore
+	shimmie.LogStore
+	shimmie.ConfigStore
+}
+
+// Factory returns a new empty store for a test. Any clean up needed for the
+// store should be registered with t.Cleanup. The factory may call t.Skip if
+// the backend is not available.
+type Factory func(t *testing.T) Store
+
+// Run runs the conformance suite as subtests of t. Each subtest gets its own
+// store from newStore.
+func Run(t *testing.T, newStore Factory) {
+	tests := []struct {
+		name string
+		fn   func(*testing.T, Store)
+	}{
+		{"User", testUser},
+		{"GetAllUsers", testGetAllUsers},
+		{"ListUsers", testListUsers},
+		{"Verify", testVerify},
+		{"Alias", testAlias},
+		{"GetAllAlias", testGetAllAlias},
+		{"FindAlias", testFindAlias},
+		{"Autocomplete", testAutocomplete},
+		{"CreateImage", testCreateImage},
+		{"ListImages", testListImages},
+		{"GetRatedImages", testGetRatedImages},
+		{"Relationships", testRelationships},
+		{"Favorites", testFavorites},
+		{"MostFavorited", testMostFavorited},
+		{"Vote", testVote},
+		{"TopImages", testTopImages},
+		{"ImagePHash", testImagePHash},
+		{"DeleteImage", testDeleteImage},
+		{"HashBan", testHashBan},
+		{"IPBan", testIPBan},
+		{"Pool", testPool},
+		{"PoolImages", testPoolImages},
+		{"QueryLogs", testQueryLogs},
+		{"Config", testConfig},
+		{"GetPMs", testGetPMs},
+		{"CreatePM", testCreatePM},
+		{"PMThread", testPMThread},
+		{"PMInboxSummary", testPMInboxSummary},
+		{"SendPM", testSendPM},
+		{"PMRateLimit", testPMRateLimit},
+		{"CreateTagHistory", testCreateTagHistory},
+		{"TagHistory", testTagHistory},
+		{"MostImageUploads", testMostImageUploads},
+		{"MostTagEdits", testMostTagEdits},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package storetest
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/kusubooru/shimmie"
+)
+
+func testCreateTagHistory(t *testing.T, shim Store) {
+	ctx := context.Background()
+
+	u := shimmie.User{Name: "bob"}
+	if err := shim.CreateUser(ctx, &u); err != nil {
+		t.Fatalf("CreateUser(%#v) returned err: %v", u, err)
+	}
+
+	img := shimmie.Image{OwnerID: u.ID}
+	imgID, err := shim.CreateImage(ctx, img)
+	if err != nil {
+		t.Fatalf("CreateImage() for user %q returned err: %v", u.Name, err)
+	}
+
+	th := shimmie.TagHistory{ImageID: imgID, UserID: u.ID}
+	t.Logf("CreateTagHistory(th) should succeed: th=%#v", th)
+	id, err := shim.CreateTagHistory(ctx, th)
+	if err != nil {
+		t.Errorf("CreateTagHistory(th) returned error: %v", err)
+	}
+	if id == 0 {
+		t.Error("CreateTagHistory(th) should return a non-zero id")
+	}
+}
+
+func testTagHistory(t *testing.T, shim Store) {
+	ctx := context.Background()
+
+	owner := shimmie.User{Name: "bob"}
+	contributor := shimmie.User{Name: "ann"}
+	for _, u := range []*shimmie.User{&owner, &contributor} {
+		if err := shim.CreateUser(ctx, u); err != nil {
+			t.Fatalf("CreateUser(%#v) returned err: %v", u, err)
+		}
+	}
+
+	var imageIDs []int64
+	for _, hash := range []string{"0", "1"} {
+		img := shimmie.Image{OwnerID: owner.ID, Hash: hash}
+		id, err := shim.CreateImage(ctx, img)
+		if err != nil {
+			t.Fatalf("CreateImage(%#v) returned err: %v", img, err)
+		}
+		imageIDs = append(imageIDs, id)
+	}
+
+	// The contributor has the last word on the first image while the owner
+	// has the last word on the second.
+	histories := []shimmie.TagHistory{
+		{ImageID: imageIDs[0], UserID: owner.ID, UserIP: "1.1.1.1", Tags: "tagme"},
+		{ImageID: imageIDs[1], UserID: contributor.ID, UserIP: "2.2.2.2", Tags: "cat"},
+		{ImageID: imageIDs[0], UserID: contributor.ID, UserIP: "2.2.2.2", Tags: "dog"},
+		{ImageID: imageIDs[1], UserID: owner.ID, UserIP: "1.1.1.1", Tags: "cat cute"},
+	}
+	var ids []int64
+	for _, th := range histories {
+		id, err := shim.CreateTagHistory(ctx, th)
+		if err != nil {
+			t.Fatalf("CreateTagHistory(%#v) returned err: %v", th, err)
+		}
+		ids = append(ids, id)
+	}
+
+	imgID := int(imageIDs[0])
+	ths, err := shim.GetImageTagHistory(ctx, imgID)
+	if err != nil {
+		t.Fatalf("GetImageTagHistory(%d) returned err: %v", imgID, err)
+	}
+	if got, want := len(ths), 2; got != want {
+		t.Fatalf("GetImageTagHistory(%d) returned %d entries, want %d", imgID, got, want)
+	}
+	if got, want := ths[0].ID, ids[2]; got != want {
+		t.Errorf("GetImageTagHistory(%d)[0].ID = %d, want %d (latest first)", imgID, got, want)
+	}
+	if got, want := ths[0].Name, contributor.Name; got != want {
+		t.Errorf("GetImageTagHistory(%d)[0].Name = %q, want %q", imgID, got, want)
+	}
+
+	id := int(ids[1])
+	th, err := shim.GetTagHistory(ctx, id)
+	if err != nil {
+		t.Fatalf("GetTagHistory(%d) returned err: %v", id, err)
+	}
+	if got, want := th.Tags, histories[1].Tags; got != want {
+		t.Errorf("GetTagHistory(%d).Tags = %q, want %q", id, got, want)
+	}
+	if _, err := shim.GetTagHistory(ctx, 1000); err != sql.ErrNoRows {
+		t.Errorf("GetTagHistory(%d) for missing entry returned err = %v, want %v", 1000, err, sql.ErrNoRows)
+	}
+
+	cths, err := shim.GetContributedTagHistory(ctx, owner.Name)
+	if err != nil {
+		t.Fatalf("GetContributedTagHistory(%q) returned err: %v", owner.Name, err)
+	}
+	if got, want := len(cths), 1; got != want {
+		t.Fatalf("GetContributedTagHistory(%q) returned %d entries, want %d", owner.Name, got, want)
+	}
+	cth := cths[0]
+	if cth.ImageID != imgID || cth.TaggerName != contributor.Name || cth.OwnerName != owner.Name || cth.Tags != "dog" {
+		t.Errorf("GetContributedTagHistory(%q) = %#v, want tags %q on image %d by %q", owner.Name, cth, "dog", imgID, contributor.Name)
+	}
+}
@@ -1,6 +1,7 @@
-package shimmiedb_test
+package storetest
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"reflect"
@@ -9,9 +10,8 @@ import (
 	"github.com/kusubooru/shimmie"
 )
 
-func TestUser(t *testing.T) {
-	shim, schema := setup(t)
-	defer teardown(t, shim, schema)
+func testUser(t *testing.T, shim Store) {
+	ctx := context.Background()
 
 	username := "john"
 	password := "1234"
@@ -22,7 +22,7 @@ func TestUser(t *testing.T) {
 	}
 
 	// Create a user.
-	err := shim.CreateUser(u)
+	err := shim.CreateUser(ctx, u)
 	if err != nil {
 		t.Fatalf("CreateUser(%q) returned err: %v", u, err)
 	}
@@ -38,7 +38,7 @@ func TestUser(t *testing.T) {
 	}
 
 	// Attempt to get created user and compare.
-	got, err := shim.GetUserByName(username)
+	got, err := shim.GetUserByName(ctx, username)
 	if err != nil {
 		t.Fatalf("GetUserByName(%q) returned err: %v", username, err)
 	}
@@ -47,7 +47,7 @@ func TestUser(t *testing.T) {
 	}
 
 	// Also get user by ID just to test the method.
-	got, err = shim.GetUser(expectedID)
+	got, err = shim.GetUser(ctx, expectedID)
 	if err != nil {
 		t.Fatalf("GetUser(%d) returned err: %v", expectedID, err)
 	}
@@ -56,20 +56,19 @@ func TestUser(t *testing.T) {
 	}
 
 	// Delete created user.
-	if err := shim.DeleteUser(expectedID); err != nil {
+	if err := shim.DeleteUser(ctx, expectedID); err != nil {
 		t.Errorf("DeleteUser(%d) returned err: %v", expectedID, err)
 	}
 
 	// Attempt to get user again and expect no rows err.
-	_, err = shim.GetUserByName(username)
+	_, err = shim.GetUserByName(ctx, username)
 	if got, want := err, sql.ErrNoRows; got != want {
 		t.Errorf("GetUserByName(%q) after delete returned err = %v, want %v", username, got, want)
 	}
 }
 
-func TestGetAllUsers(t *testing.T) {
-	shim, schema := setup(t)
-	defer teardown(t, shim, schema)
+func testGetAllUsers(t *testing.T, shim Store) {
+	ctx := context.Background()
 
 	pass, max := "123", 10
 	for i := 0; i < max; i++ {
@@ -77,7 +76,7 @@ func TestGetAllUsers(t *testing.T) {
 			Name: fmt.Sprintf("user%d", i),
 			Pass: pass,
 		}
-		err := shim.CreateUser(u)
+		err := shim.CreateUser(ctx, u)
 		if err != nil {
 			t.Fatalf("CreateUser(%q) returned err: %v", u, err)
 		}
@@ -98,7 +97,7 @@ func TestGetAllUsers(t *testing.T) {
 
 	for _, tt := range getAllUserTests {
 		limit, offset := tt.limit, tt.offset
-		users, err := shim.GetAllUsers(limit, offset)
+		users, err := shim.GetAllUsers(ctx, limit, offset)
 		if err != nil {
 			t.Fatalf("GetAllUsers(%d, %d) returned err: %v", limit, offset, err)
 		}
@@ -107,3 +106,39 @@ func TestGetAllUsers(t *testing.T) {
 		}
 	}
 }
+
+func testListUsers(t *testing.T, shim Store) {
+	ctx := context.Background()
+
+	max := 10
+	for i := 0; i < max; i++ {
+		u := &shimmie.User{Name: fmt.Sprintf("user%d", i), Pass: "123"}
+		if err := shim.CreateUser(ctx, u); err != nil {
+			t.Fatalf("CreateUser(%q) returned err: %v", u, err)
+		}
+	}
+
+	var (
+		all    []shimmie.User
+		cursor string
+	)
+	for {
+		users, next, err := shim.ListUsers(ctx, 4, cursor)
+		if err != nil {
+			t.Fatalf("ListUsers(4, %q) returned err: %v", cursor, err)
+		}
+		all = append(all, users...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if got, want := len(all), max; got != want {
+		t.Fatalf("ListUsers returned %d users in total, want %d", got, want)
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i-1].ID >= all[i].ID {
+			t.Errorf("ListUsers returned user %d before user %d", all[i-1].ID, all[i].ID)
+		}
+	}
+}
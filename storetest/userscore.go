@@ -1,4 +1,4 @@
-package shimmiedb_test
+package storetest
 
 import (
 	"context"
@@ -8,9 +8,8 @@ import (
 	"github.com/kusubooru/shimmie"
 )
 
-func TestMostImageUploads(t *testing.T) {
-	shim, schema := setup(t)
-	defer teardown(t, shim, schema)
+func testMostImageUploads(t *testing.T, shim Store) {
+	ctx := context.Background()
 
 	fixtures := []struct {
 		user   shimmie.User
@@ -38,10 +37,9 @@ func TestMostImageUploads(t *testing.T) {
 			},
 		},
 	}
-	ctx := context.Background()
 	t.Log("After inserting:")
 	for _, f := range fixtures {
-		if err := shim.CreateUser(&f.user); err != nil {
+		if err := shim.CreateUser(ctx, &f.user); err != nil {
 			t.Fatalf("CreateUser(%v) returned err: %v", f.user, err)
 		}
 		t.Logf("User %q with images:", f.user.Name)
@@ -54,7 +52,7 @@ func TestMostImageUploads(t *testing.T) {
 		}
 	}
 
-	score, err := shim.MostImageUploads(10)
+	score, err := shim.MostImageUploads(ctx, 10)
 	if err != nil {
 		t.Fatalf("MostImageUploads() returned err: %v", err)
 	}
@@ -71,11 +69,11 @@ func TestMostImageUploads(t *testing.T) {
 	for i, s := range score {
 		prefix := fmt.Sprintf("score[%d]->", i)
 		t.Logf("%s Score: %d, Name: %q", prefix, s.Score, s.Name)
-		testUserScore(t, score[i], want[i], prefix)
+		checkUserScore(t, score[i], want[i], prefix)
 	}
 }
 
-func testUserScore(t *testing.T, got, want shimmie.UserScore, prefix string) {
+func checkUserScore(t *testing.T, got, want shimmie.UserScore, prefix string) {
 	t.Helper()
 	if got, want := got.Score, want.Score; got != want {
 		t.Errorf("%s Score: %d, want: %d", prefix, got, want)
@@ -85,9 +83,8 @@ func testUserScore(t *testing.T, got, want shimmie.UserScore, prefix string) {
 	}
 }
 
-func TestMostTagEdits(t *testing.T) {
-	shim, schema := setup(t)
-	defer teardown(t, shim, schema)
+func testMostTagEdits(t *testing.T, shim Store) {
+	ctx := context.Background()
 
 	fixtures := []struct {
 		user         shimmie.User
@@ -125,10 +122,9 @@ func TestMostTagEdits(t *testing.T) {
 			},
 		},
 	}
-	ctx := context.Background()
 	t.Log("After inserting:")
 	for _, f := range fixtures {
-		if err := shim.CreateUser(&f.user); err != nil {
+		if err := shim.CreateUser(ctx, &f.user); err != nil {
 			t.Fatalf("CreateUser(%v) returned err: %v", f.user, err)
 		}
 		t.Logf("User %q with images and tag histories:", f.user.Name)
@@ -148,7 +144,7 @@ func TestMostTagEdits(t *testing.T) {
 		}
 	}
 
-	score, err := shim.MostTagEdits(10)
+	score, err := shim.MostTagEdits(ctx, 10)
 	if err != nil {
 		t.Fatalf("MostTagEdits() returned err: %v", err)
 	}
@@ -165,6 +161,6 @@ func TestMostTagEdits(t *testing.T) {
 	for i, s := range score {
 		prefix := fmt.Sprintf("score[%d]->", i)
 		t.Logf("%s Score: %d, Name: %q", prefix, s.Score, s.Name)
-		testUserScore(t, score[i], want[i], prefix)
+		checkUserScore(t, score[i], want[i], prefix)
 	}
 }
@@ -0,0 +1,144 @@
+package shimmie
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+
+	// Formats that can be thumbnailed besides JPEG.
+	_ "image/gif"
+	_ "image/png"
+
+	_ "golang.org/x/image/bmp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// ThumbOptions are the sizes and quality of the thumbnails.
+type ThumbOptions struct {
+	Width   int
+	Height  int
+	Quality int
+}
+
+// ThumbOptionsFromConfig returns the thumbnail options of the thumb_width,
+// thumb_height and thumb_quality config values, using the defaults of
+// Shimmie for the missing ones.
+func ThumbOptionsFromConfig(v ConfigValues) ThumbOptions {
+	v = DefaultConfigSchema.Defaults(v)
+	return ThumbOptions{
+		Width:   v.Int("thumb_width", 192),
+		Height:  v.Int("thumb_height", 192),
+		Quality: v.Int("thumb_quality", 75),
+	}
+}
+
+// ThumbSize returns the size of the thumbnail of an image of width and
+// height. The image is scaled down, keeping its aspect ratio, to fit in the
+// thumbnail width and height. Images that already fit are not scaled up.
+func (o ThumbOptions) ThumbSize(width, height int) (int, int) {
+	if width <= 0 || height <= 0 {
+		return 0, 0
+	}
+	scale := 1.0
+	if s := float64(o.Width) / float64(width); s < scale {
+		scale = s
+	}
+	if s := float64(o.Height) / float64(height); s < scale {
+		scale = s
+	}
+	w, h := int(math.Round(float64(width)*scale)), int(math.Round(float64(height)*scale))
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	return w, h
+}
+
+// ImageFile returns the path of the image with the given hash, which is
+// stored by Shimmie in a directory named after the first two characters of
+// the hash.
+func (shim *Shimmie) ImageFile(hash string) string {
+	return hashPath(shim.ImagePath, hash)
+}
+
+// ThumbFile returns the path of the thumbnail of the image with the given
+// hash.
+func (shim *Shimmie) ThumbFile(hash string) string {
+	return hashPath(shim.ThumbPath, hash)
+}
+
+func hashPath(dir, hash string) string {
+	if len(hash) < 2 {
+		return filepath.Join(dir, hash)
+	}
+	return filepath.Join(dir, hash[:2], hash)
+}
+
+// MakeThumb creates or replaces the thumbnail of the image with the given
+// hash. The thumbnail is written to a temporary file that is renamed once
+// complete so the previous thumbnail is served until then.
+func (shim *Shimmie) MakeThumb(hash string, opts ThumbOptions) error {
+	f, err := os.Open(shim.ImageFile(hash))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	name := shim.ThumbFile(hash)
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := WriteThumb(tmp, f, opts); err != nil {
+		tmp.Close()
+		return fmt.Errorf("thumbnail of %s: %v", hash, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// WriteThumb decodes a JPEG, PNG, GIF, BMP or WebP image from r and writes
+// its thumbnail to w as a JPEG. Transparent areas become white.
+func WriteThumb(w io.Writer, r io.Reader, opts ThumbOptions) error {
+	src, _, err := image.Decode(r)
+	if err != nil {
+		return err
+	}
+	b := src.Bounds()
+	width, height := opts.ThumbSize(b.Dx(), b.Dy())
+	if width == 0 {
+		return fmt.Errorf("image is empty")
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Over, nil)
+	return jpeg.Encode(w, dst, &jpeg.Options{Quality: opts.Quality})
+}
+
+// RegenerateThumbs makes the thumbnails of the images of store, newest
+// first, with a pool of workers. Images that fail are counted and skipped.
+// If ctx is canceled, it returns the progress of the pages that were done,
+// whose Cursor can be used to resume later.
+func (shim *Shimmie) RegenerateThumbs(ctx context.Context, store ImageStore, thumb ThumbOptions, opts BatchOptions) (ImageProgress, error) {
+	return forEachImage(ctx, store, opts, func(img Image) error {
+		return shim.MakeThumb(img.Hash, thumb)
+	})
+}
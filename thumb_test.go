@@ -0,0 +1,142 @@
+package shimmie_test
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/kusubooru/shimmie"
+	"github.com/kusubooru/shimmie/shimmietest"
+)
+
+func TestThumbSize(t *testing.T) {
+	opts := ThumbOptions{Width: 192, Height: 192}
+	var tests = []struct {
+		w, h         int
+		wantW, wantH int
+	}{
+		{1920, 1080, 192, 108},
+		{1080, 1920, 108, 192},
+		{100, 50, 100, 50},
+		{384, 192, 192, 96},
+		{10000, 10, 192, 1},
+		{0, 10, 0, 0},
+	}
+	for _, tt := range tests {
+		w, h := opts.ThumbSize(tt.w, tt.h)
+		if w != tt.wantW || h != tt.wantH {
+			t.Errorf("ThumbSize(%d, %d) = %d, %d, want %d, %d", tt.w, tt.h, w, h, tt.wantW, tt.wantH)
+		}
+	}
+}
+
+func TestThumbOptionsFromConfig(t *testing.T) {
+	got := ThumbOptionsFromConfig(ConfigValues{"thumb_width": "250", "thumb_quality": ""})
+	want := ThumbOptions{Width: 250, Height: 192, Quality: 75}
+	if got != want {
+		t.Errorf("ThumbOptionsFromConfig() = %+v, want %+v", got, want)
+	}
+}
+
+// writeImage writes a PNG image of the given size to the image file of
+// hash.
+func writeImage(t *testing.T, shim *Shimmie, hash string, width, height int) {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		img.Set(x, 0, color.NRGBA{R: 255, A: 255})
+	}
+	name := shim.ImageFile(hash)
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// thumbSize decodes the thumbnail of hash and returns its size.
+func thumbSize(t *testing.T, shim *Shimmie, hash string) (int, int) {
+	t.Helper()
+	f, err := os.Open(shim.ThumbFile(hash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cfg, err := jpeg.DecodeConfig(f)
+	if err != nil {
+		t.Fatalf("thumbnail of %s is not a JPEG: %v", hash, err)
+	}
+	return cfg.Width, cfg.Height
+}
+
+func TestRegenerateThumbs(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	shim := &Shimmie{ImagePath: filepath.Join(dir, "images"), ThumbPath: filepath.Join(dir, "thumbs")}
+	if got, want := shim.ThumbFile("abcdef"), filepath.Join(dir, "thumbs", "ab", "abcdef"); got != want {
+		t.Errorf("ThumbFile() = %q, want %q", got, want)
+	}
+
+	store := shimmietest.New()
+	if err := store.CreateUser(ctx, &User{Name: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	hashes := []string{"aa01", "ab02", "ac03", "ad04", "ae05"}
+	for i, hash := range hashes {
+		if _, err := store.CreateImage(ctx, Image{OwnerID: 1, Hash: hash}); err != nil {
+			t.Fatal(err)
+		}
+		// The file of the last image is missing.
+		if i < len(hashes)-1 {
+			writeImage(t, shim, hash, 400, 200)
+		}
+	}
+
+	thumb := ThumbOptions{Width: 100, Height: 100, Quality: 80}
+	opts := BatchOptions{
+		Workers:  2,
+		PageSize: 2,
+	}
+	var failed []string
+	opts.OnError = func(img Image, err error) { failed = append(failed, img.Hash) }
+	// Stop after the first page to resume from its cursor.
+	cctx, cancel := context.WithCancel(ctx)
+	opts.Progress = func(ImageProgress) { cancel() }
+	p, err := shim.RegenerateThumbs(cctx, store, thumb, opts)
+	if err != context.Canceled {
+		t.Fatalf("RegenerateThumbs() err = %v, want %v", err, context.Canceled)
+	}
+	if p.Done != 1 || p.Failed != 1 || p.Cursor == "" {
+		t.Fatalf("RegenerateThumbs() progress = %+v, want 1 done, 1 failed and a cursor", p)
+	}
+	if len(failed) != 1 || failed[0] != "ae05" {
+		t.Errorf("failed images = %q, want [ae05]", failed)
+	}
+
+	var pages int
+	opts.Progress = func(ImageProgress) { pages++ }
+	opts.Cursor = p.Cursor
+	p, err = shim.RegenerateThumbs(ctx, store, thumb, opts)
+	if err != nil {
+		t.Fatalf("RegenerateThumbs() resume failed: %v", err)
+	}
+	if p.Done != 3 || p.Failed != 0 || p.Cursor != "" || pages != 2 {
+		t.Errorf("RegenerateThumbs() resume progress = %+v after %d pages, want 3 done in 2 pages", p, pages)
+	}
+	for _, hash := range hashes[:len(hashes)-1] {
+		if w, h := thumbSize(t, shim, hash); w != 100 || h != 50 {
+			t.Errorf("thumbnail of %s is %dx%d, want 100x50", hash, w, h)
+		}
+	}
+}